@@ -0,0 +1,164 @@
+package gopifinder
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"time"
+)
+
+// GenerateCA creates a new self-signed certificate authority used to issue the
+// certificates of the finder servers in a cluster.
+// The certificate and private key are returned PEM encoded.
+func GenerateCA(name string, validFor time.Duration) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, errors.New("Error generating CA key. " + err.Error())
+	}
+	tmpl, err := newCertTemplate(name, validFor)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, errors.New("Error creating CA certificate. " + err.Error())
+	}
+	return encodeCertAndKey(der, key)
+}
+
+// GenerateCert creates a certificate for a finder server that is valid for the
+// specified host names and IP addresses.  The certificate can be used both to serve
+// HTTPS and as a client certificate for mutual TLS.
+// If the CA certificate and key are nil, a self-signed certificate is created.
+// The certificate and private key are returned PEM encoded.
+func GenerateCert(hosts []string, validFor time.Duration, caCertPEM []byte, caKeyPEM []byte) ([]byte, []byte, error) {
+	if len(hosts) == 0 {
+		return nil, nil, errors.New("At least one host name or IP address is required")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, errors.New("Error generating certificate key. " + err.Error())
+	}
+	tmpl, err := newCertTemplate(hosts[0], validFor)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	parent := tmpl
+	var signer interface{} = key
+	if caCertPEM != nil && caKeyPEM != nil {
+		ca, err := tls.X509KeyPair(caCertPEM, caKeyPEM)
+		if err != nil {
+			return nil, nil, errors.New("Error reading CA certificate. " + err.Error())
+		}
+		parent, err = x509.ParseCertificate(ca.Certificate[0])
+		if err != nil {
+			return nil, nil, errors.New("Error parsing CA certificate. " + err.Error())
+		}
+		signer = ca.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		return nil, nil, errors.New("Error creating certificate. " + err.Error())
+	}
+	return encodeCertAndKey(der, key)
+}
+
+// LoadCertPool reads the PEM encoded CA certificates in the specified file into a certificate pool.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("Error reading CA file. " + err.Error())
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, errors.New("No certificates found in CA file " + path)
+	}
+	return pool, nil
+}
+
+// SaveCertAndKey writes the PEM encoded certificate and private key to the specified files.
+// The private key file is only readable by the owner.
+func SaveCertAndKey(certFile string, keyFile string, certPEM []byte, keyPEM []byte) error {
+	if err := ioutil.WriteFile(certFile, certPEM, 0644); err != nil {
+		return errors.New("Error writing certificate file. " + err.Error())
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return errors.New("Error writing key file. " + err.Error())
+	}
+	return nil
+}
+
+func newCertTemplate(name string, validFor time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.New("Error generating certificate serial number. " + err.Error())
+	}
+	if validFor <= 0 {
+		validFor = 10 * 365 * 24 * time.Hour
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"gopi-finder"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validFor),
+	}, nil
+}
+
+func encodeCertAndKey(der []byte, key *ecdsa.PrivateKey) ([]byte, []byte, error) {
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, errors.New("Error encoding private key. " + err.Error())
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb})
+	return certPEM, keyPEM, nil
+}
+
+// NewClientTLSConfig creates the TLS configuration used to connect to HTTPS finder servers.
+// Peers are verified against the cluster CA in caFile, or against the system's root
+// certificates if no CA file is specified.  Servers using self-signed certificates can
+// only be reached without a CA if insecure is set, which switches off the verification
+// of peer certificates altogether.  If a certificate and key file are specified, they
+// are presented as the client certificate for mutual TLS.
+func NewClientTLSConfig(caFile string, certFile string, keyFile string, insecure bool) (*tls.Config, error) {
+	c := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: insecure}
+	if caFile != "" {
+		pool, err := LoadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = pool
+	}
+	if certFile != "" && keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.New("Error loading client certificate. " + err.Error())
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
@@ -0,0 +1,71 @@
+package gopifinder
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCanIssueNodeCertificateFromCA(t *testing.T) {
+	caCert, caKey, err := GenerateCA("Test CA", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, keyPEM, err := GenerateCert([]string{"node1", "192.168.1.10"}, time.Hour, caCert, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caCert)
+	for _, host := range []string{"node1", "192.168.1.10"} {
+		opts := x509.VerifyOptions{
+			Roots:     pool,
+			DNSName:   host,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}
+		if _, err := leaf.Verify(opts); err != nil {
+			t.Error("Certificate did not verify for", host, err)
+		}
+	}
+}
+
+func TestProbeFindsPeersServingEitherScheme(t *testing.T) {
+	online := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(DeviceInfo{MachineID: "peer", HostName: "peer"})
+	})
+	for _, tc := range []struct {
+		name     string
+		server   *httptest.Server
+		useTLS   bool
+		insecure bool
+		found    bool
+	}{
+		{"https peer from http finder", httptest.NewTLSServer(online), false, true, true},
+		{"http peer from https finder", httptest.NewServer(online), true, false, true},
+		{"unverified https peer", httptest.NewTLSServer(online), false, false, false},
+	} {
+		d := newTestDevice(t, "peer", tc.server)
+		cfg, err := NewClientTLSConfig("", "", "", tc.insecure)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := Finder{Timeout: 1, PortNo: d.PortNo, UseTLS: tc.useTLS, TLSConfig: cfg}
+		if got := f.checkIfOnline(d.IPAddress[0]); (got.MachineID == "peer") != tc.found {
+			t.Errorf("%s: expected found to be %v, got %+v", tc.name, tc.found, got)
+		}
+		tc.server.Close()
+	}
+}
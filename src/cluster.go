@@ -0,0 +1,75 @@
+package gopifinder
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HeaderCluster holds the comma separated list of clusters the sender of a request belongs to.
+const HeaderCluster = "X-Finder-Cluster"
+
+// ParseClusters splits a comma separated list of cluster names.
+// Blank names are dropped.
+func ParseClusters(s string) []string {
+	l := []string{}
+	for _, c := range strings.Split(s, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			l = append(l, c)
+		}
+	}
+	return l
+}
+
+// SharesCluster returns whether or not the two lists of clusters have a cluster in common.
+// An empty list stands for the default, unnamed cluster, so two empty lists share
+// a cluster while an empty list never shares one with a list of named clusters.
+func SharesCluster(a []string, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == 0 && len(b) == 0
+	}
+	for _, i := range a {
+		for _, j := range b {
+			if i == j {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetRequestClusters returns the clusters the sender of the request belongs to.
+func GetRequestClusters(r *http.Request) []string {
+	return ParseClusters(r.Header.Get(HeaderCluster))
+}
+
+// InCluster returns whether or not the device belongs to one of the specified clusters.
+func (d *DeviceInfo) InCluster(clusters []string) bool {
+	return SharesCluster(d.Clusters, clusters)
+}
+
+// InCluster returns whether or not the service is registered in one of the specified clusters.
+func (s *ServiceInfo) InCluster(clusters []string) bool {
+	return SharesCluster(s.Clusters, clusters)
+}
+
+// FilterDevices returns the devices that belong to one of the specified clusters.
+func FilterDevices(dl []DeviceInfo, clusters []string) []DeviceInfo {
+	l := []DeviceInfo{}
+	for _, d := range dl {
+		if d.InCluster(clusters) {
+			l = append(l, d)
+		}
+	}
+	return l
+}
+
+// FilterServices returns the services that are registered in one of the specified clusters.
+func FilterServices(sl []ServiceInfo, clusters []string) []ServiceInfo {
+	l := []ServiceInfo{}
+	for _, s := range sl {
+		if s.InCluster(clusters) {
+			l = append(l, s)
+		}
+	}
+	return l
+}
@@ -0,0 +1,49 @@
+package gopifinder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSharesCluster(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want bool
+	}{
+		{nil, nil, true},
+		{nil, []string{"lab"}, false},
+		{[]string{"lab"}, []string{"lab"}, true},
+		{[]string{"lab"}, []string{"prod"}, false},
+		{[]string{"lab", "prod"}, []string{"prod"}, true},
+	}
+	for _, i := range tests {
+		if got := SharesCluster(i.a, i.b); got != i.want {
+			t.Error("SharesCluster", i.a, i.b, "returned", got, "expected", i.want)
+		}
+	}
+}
+
+func TestCheckIfOnlineIgnoresOtherClusters(t *testing.T) {
+	var got string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(HeaderCluster)
+		d := DeviceInfo{MachineID: "peer", Clusters: []string{"prod"}}
+		d.WriteTo(w)
+	}))
+	defer ts.Close()
+	d := newTestDevice(t, "peer", ts)
+
+	f := Finder{PortNo: d.PortNo, Timeout: 1, Clusters: []string{"lab", "prod"}}
+	if i := f.checkIfOnline(d.IPAddress[0]); i.MachineID != "peer" {
+		t.Error("Expected the device in a shared cluster to be found.")
+	}
+	if got != "lab,prod" {
+		t.Error("Expected the cluster header to be sent, got", got)
+	}
+
+	f.Clusters = []string{"lab"}
+	if i := f.checkIfOnline(d.IPAddress[0]); i.MachineID != "" {
+		t.Error("Expected the device in another cluster to be ignored.")
+	}
+}
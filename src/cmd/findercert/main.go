@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+func main() {
+	// Subcommands
+	caCmd := flag.Bool("ca", false, "Create a new cluster CA certificate and key.")
+	nodeCmd := flag.Bool("node", false, "Create a node certificate and key issued by the cluster CA.")
+
+	// Flag pointers
+	name := flag.String("name", "gopi-finder CA", "Common name of the cluster CA.")
+	hosts := flag.String("hosts", "", "Comma separated list of host names and IP addresses for the node certificate.")
+	out := flag.String("out", "", "Output file name, without extension. Defaults to 'ca' or the first host name.")
+	caCert := flag.String("cacert", "ca.crt", "Cluster CA certificate file.")
+	caKey := flag.String("cakey", "ca.key", "Cluster CA private key file.")
+	days := flag.Int("days", 3650, "Number of days the certificate is valid for.")
+
+	flag.Parse()
+
+	validFor := time.Duration(*days) * 24 * time.Hour
+
+	if *caCmd {
+		fn := *out
+		if fn == "" {
+			fn = "ca"
+		}
+		certPEM, keyPEM, err := gopifinder.GenerateCA(*name, validFor)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := gopifinder.SaveCertAndKey(fn+".crt", fn+".key", certPEM, keyPEM); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println("Created cluster CA", fn+".crt", fn+".key")
+	} else if *nodeCmd {
+		if *hosts == "" {
+			fmt.Println("At least one host name or IP address must be specified with -hosts.")
+			return
+		}
+		h := strings.Split(*hosts, ",")
+		fn := *out
+		if fn == "" {
+			fn = h[0]
+		}
+		caCertPEM, err := ioutil.ReadFile(*caCert)
+		if err != nil {
+			fmt.Println("Error reading CA certificate.", err)
+			return
+		}
+		caKeyPEM, err := ioutil.ReadFile(*caKey)
+		if err != nil {
+			fmt.Println("Error reading CA key.", err)
+			return
+		}
+		certPEM, keyPEM, err := gopifinder.GenerateCert(h, validFor, caCertPEM, caKeyPEM)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := gopifinder.SaveCertAndKey(fn+".crt", fn+".key", certPEM, keyPEM); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println("Created node certificate", fn+".crt", fn+".key")
+	} else {
+		flag.Usage()
+	}
+}
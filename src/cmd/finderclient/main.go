@@ -1,8 +1,15 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/brumawen/gopi-finder/src"
@@ -12,6 +19,8 @@ func main() {
 	// Subcommands
 	devCmd := flag.Bool("devices", false, "The app will get a list of devices from the specified device.")
 	srvCmd := flag.Bool("services", false, "The app will get a list of services from the specified device.")
+	logsCmd := flag.Bool("logs", false, "The app will collect the logs from every device, or the devices listed in -hosts.")
+	statusCmd := flag.Bool("status", false, "The app will read the status of every device, or the devices listed in -hosts.")
 
 	// Flag pointers
 	ip := flag.String("ip", "", "IP Address of the device.")
@@ -19,11 +28,40 @@ func main() {
 	all := flag.Bool("a", false, "Show all device or service information.")
 	verbose := flag.Bool("v", false, "Verbose logging.")
 	timeout := flag.Int("t", 2, "Timeout waiting for a response from a IP probe. Defaults to 2 seconds.")
+	secret := flag.String("secret", "", "Shared cluster secret used to sign requests.")
+	useTLS := flag.Bool("tls", false, "Probe the LAN with HTTPS before HTTP.")
+	caFile := flag.String("ca", "", "Cluster CA certificate file used to verify devices.")
+	certFile := flag.String("cert", "", "Client certificate file for mutual TLS.")
+	keyFile := flag.String("key", "", "Client private key file for mutual TLS.")
+	insecure := flag.Bool("insecure", false, "Connect to HTTPS devices without verifying their certificates.")
+	cluster := flag.String("cluster", "", "Comma separated list of clusters to search. Devices in other clusters are ignored.")
 
-	flag.Parse()
+	// Log flags
+	hosts := flag.String("hosts", "", "Comma separated list of the host names, machine IDs or IP addresses of the devices to collect the logs or status from.")
+	unit := flag.String("unit", "", "The unit or log file to read. Defaults to the finder server's journal.")
+	since := flag.String("since", "", "Only show entries logged since this time, for example 2026-10-19T10:00:00Z, 30m or '2 hours ago'. Defaults to 1 hour ago.")
+	until := flag.String("until", "", "Only show entries logged before this time.")
+	priority := flag.String("priority", "", "Only show entries with this priority or a more severe one, from emerg to debug.")
+	grep := flag.String("grep", "", "Only show entries whose message matches this regular expression.")
+	lines := flag.Int("lines", 0, "The maximum number of entries read from each device. Defaults to 1000.")
+	asJSON := flag.Bool("json", false, "Write the log entries or device status as JSON, one per line.")
+
+	// Status flags
+	underVoltage := flag.Bool("undervoltage", false, "Only show the devices that are under-voltage, or have been since they booted.")
+
+	// The logs and status subcommands may also be given as the first argument
+	if len(os.Args) > 1 && os.Args[1] == "logs" {
+		*logsCmd = true
+		flag.CommandLine.Parse(os.Args[2:])
+	} else if len(os.Args) > 1 && os.Args[1] == "status" {
+		*statusCmd = true
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
 
 	var d []gopifinder.DeviceInfo
-	var s []gopifinder.ServiceInfo
+	var s gopifinder.ServiceSearchResult
 	var err error
 
 	start := time.Now()
@@ -31,6 +69,68 @@ func main() {
 	f := gopifinder.Finder{
 		VerboseLogging: *verbose,
 		Timeout:        *timeout,
+		Secret:         *secret,
+		UseTLS:         *useTLS,
+		Clusters:       gopifinder.ParseClusters(*cluster),
+	}
+	if *insecure {
+		fmt.Fprintln(os.Stderr, "Warning: device certificates will not be verified.")
+	}
+	if f.TLSConfig, err = gopifinder.NewClientTLSConfig(*caFile, *certFile, *keyFile, *insecure); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if *logsCmd || *statusCmd {
+		if *port > 0 {
+			f.PortNo = *port
+		}
+		if *ip != "" {
+			// Get the list of devices from the specified device
+			if i, err := gopifinder.NewDeviceInfo(); err != nil {
+				fmt.Println(err)
+			} else {
+				i.IPAddress = []string{*ip}
+				i.PortNo = *port
+				i.TLS = *useTLS
+				f.AddDevice(i)
+				f.ForceSearch = true
+			}
+		}
+	}
+
+	if *statusCmd {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		showStatus(ctx, &f, splitList(*hosts), *underVoltage, *asJSON, *verbose)
+		if *verbose {
+			fmt.Println("Completed in", time.Since(start).Seconds(), "sec")
+		}
+		return
+	}
+
+	if *logsCmd {
+		v := url.Values{}
+		v.Set("unit", *unit)
+		v.Set("since", *since)
+		v.Set("until", *until)
+		v.Set("priority", *priority)
+		v.Set("grep", *grep)
+		if *lines > 0 {
+			v.Set("lines", fmt.Sprint(*lines))
+		}
+		q, err := gopifinder.ParseLogQuery(v)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		showLogs(ctx, &f, q, splitList(*hosts), *asJSON, *verbose)
+		if *verbose {
+			fmt.Println("Completed in", time.Since(start).Seconds(), "sec")
+		}
+		return
 	}
 
 	if *devCmd {
@@ -44,6 +144,7 @@ func main() {
 			if *port > 0 {
 				i.PortNo = *port
 			}
+			i.TLS = *useTLS
 			f.AddDevice(i)
 		}
 		d, err = f.SearchForDevices()
@@ -63,6 +164,7 @@ func main() {
 			if *port > 0 {
 				i.PortNo = *port
 			}
+			i.TLS = *useTLS
 			f.AddDevice(i)
 		}
 		s, err = f.SearchForServices()
@@ -93,20 +195,127 @@ func main() {
 		}
 	}
 
-	if len(s) != 0 {
-		for _, i := range s {
+	if len(s.Services) != 0 {
+		for _, i := range s.Services {
 			if *all {
-				fmt.Printf("%s\t%s\t%s\t%d\t%s\t%s\n", i.HostName, i.ServiceName, i.IPAddress, i.PortNo, i.APIStub, i.MachineID)
+				fmt.Printf("%s\t%s\t%s\t%d\t%s\t%s\t%s\n", i.HostName, i.ServiceName, i.IPAddress, i.PortNo, i.APIStub, i.MachineID, i.ReportedBy)
 			} else {
 				fmt.Printf("%s\t%s\t%s\t%d\t%s\n", i.HostName, i.ServiceName, i.IPAddress, i.PortNo, i.APIStub)
 			}
 		}
 		if *verbose {
-			fmt.Println("Found", len(s), "Service(s).")
+			fmt.Println("Found", len(s.Services), "Service(s).")
 		}
 	}
+	if s.TimedOut {
+		fmt.Println("The search timed out before every device had answered.")
+	}
 
 	if *verbose {
 		fmt.Println("Completed in", time.Since(start).Seconds(), "sec")
 	}
 }
+
+// selectDevices returns the devices listed in hosts, or nil if every device is wanted.
+func selectDevices(f *gopifinder.Finder, hosts []string) ([]gopifinder.DeviceInfo, error) {
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+	d, err := f.SearchForDevices()
+	if err != nil {
+		return nil, err
+	}
+	d = gopifinder.SelectDevices(d, hosts)
+	if len(d) == 0 {
+		return nil, errors.New("None of the hosts were found.")
+	}
+	return d, nil
+}
+
+// showStatus reads the status of the devices and writes one line for each device,
+// listing the throttled flags that are set.
+func showStatus(ctx context.Context, f *gopifinder.Finder, hosts []string, underVoltage bool, asJSON bool, verbose bool) {
+	d, err := selectDevices(f, hosts)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	var r gopifinder.StatusCollectionResult
+	if d == nil {
+		if r, err = f.CollectStatus(ctx); err != nil {
+			fmt.Println(err)
+			return
+		}
+	} else {
+		r = f.CollectStatusFrom(ctx, d)
+	}
+
+	l := r.Devices
+	if underVoltage {
+		l = r.UnderVoltage()
+	}
+	enc := json.NewEncoder(os.Stdout)
+	for _, i := range l {
+		if asJSON {
+			enc.Encode(i)
+			continue
+		}
+		flags := []string{}
+		for _, b := range gopifinder.ThrottleFlags {
+			if i.Status.Throttled&(1<<b.Bit) != 0 {
+				flags = append(flags, b.Name)
+			}
+		}
+		fmt.Printf("%s\t%s\t%s\t%.1f\t0x%x\t%s\n", i.Device.HostName, i.Device.IPAddress, i.Status.HWType, i.Status.CPUTemp, i.Status.Throttled, strings.Join(flags, ","))
+	}
+	if verbose {
+		fmt.Println("Found", len(l), "Device(s).")
+	}
+	for _, i := range r.Failed {
+		fmt.Fprintf(os.Stderr, "Failed to read the status of %s %s. %s\n", i.Device.HostName, i.Device.IPAddress, i.Err)
+	}
+}
+
+// showLogs collects the logs from the devices and writes them as a single timeline.
+func showLogs(ctx context.Context, f *gopifinder.Finder, q gopifinder.LogQuery, hosts []string, asJSON bool, verbose bool) {
+	d, err := selectDevices(f, hosts)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	var r gopifinder.LogCollectionResult
+	if d == nil {
+		if r, err = f.CollectLogs(ctx, q); err != nil {
+			fmt.Println(err)
+			return
+		}
+	} else {
+		r = f.CollectLogsFrom(ctx, d, q)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, e := range r.Entries {
+		if asJSON {
+			enc.Encode(e)
+		} else {
+			fmt.Println(e.Text())
+		}
+	}
+	if verbose {
+		fmt.Println("Read", len(r.Entries), "Entries.")
+	}
+	for _, i := range r.Failed {
+		fmt.Fprintf(os.Stderr, "Failed to read the logs from %s %s. %s\n", i.Device.HostName, i.Device.IPAddress, i.Err)
+	}
+}
+
+// splitList splits a comma separated list, dropping blank entries.
+func splitList(s string) []string {
+	l := []string{}
+	for _, i := range strings.Split(s, ",") {
+		if i = strings.TrimSpace(i); i != "" {
+			l = append(l, i)
+		}
+	}
+	return l
+}
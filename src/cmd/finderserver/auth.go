@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+// Authenticate is a router middleware that requires requests to be signed with the
+// cluster secret.  Requests that change the registry are always checked, while read
+// requests are only checked if ProtectReads is set.
+// No requests are checked if the server does not have a Secret, except for replicas,
+// which must come from a peer that presents a verified client certificate.
+func (s *Server) Authenticate(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.cfgMu.RLock()
+		verifier, protectReads := s.verifier, s.ProtectReads
+		s.cfgMu.RUnlock()
+		if verifier != nil && (protectReads || !isReadRequest(r)) {
+			if err := verifier.Verify(r); err != nil {
+				s.logDebug("Rejected unsigned request", append(requestFields(r), gopifinder.ErrField(err))...)
+				http.Error(w, "Unauthorized. "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+		if verifier == nil && isReplicaRequest(r) && !isReadRequest(r) && !hasVerifiedCert(r) {
+			s.logDebug("Rejected replica from an unauthenticated peer", requestFields(r)...)
+			http.Error(w, "Unauthorized. Replicas are only accepted from peers that sign their requests or present a client certificate.", http.StatusUnauthorized)
+			return
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// isReplicaRequest returns whether or not the request replicates the registry.
+func isReplicaRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/replica/")
+}
+
+// hasVerifiedCert returns whether or not the sender of the request presented a
+// client certificate that was verified against the cluster CA.
+func hasVerifiedCert(r *http.Request) bool {
+	return r.TLS != nil && len(r.TLS.VerifiedChains) != 0
+}
+
+// isReadRequest returns whether or not the request only reads from the server.
+func isReadRequest(r *http.Request) bool {
+	return r.Method == "GET" || r.Method == "HEAD"
+}
+
+// newVerifier creates the request verifier for the server's Secret.
+func (s *Server) newVerifier() *gopifinder.RequestVerifier {
+	if s.Secret == "" {
+		return nil
+	}
+	return &gopifinder.RequestVerifier{Secret: s.Secret}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+// CheckCluster is a router middleware that rejects requests from finder servers and
+// clients in other clusters.  Requests that name their clusters must share one with
+// this server.  Replication and gossip requests are only sent by other servers,
+// so they must share a cluster with this server even if they do not name one.
+func (s *Server) CheckCluster(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(gopifinder.HeaderCluster) != "" || isPeerRequest(r) {
+			if !gopifinder.SharesCluster(gopifinder.GetRequestClusters(r), s.Clusters) {
+				s.logDebug("Rejected request from another cluster", requestFields(r)...)
+				http.Error(w, "Forbidden. The request is from another cluster.", http.StatusForbidden)
+				return
+			}
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// isPeerRequest returns whether or not the request can only have been sent by another finder server.
+func isPeerRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/replica/") || strings.HasPrefix(r.URL.Path, "/gossip/")
+}
+
+// filterSync returns the devices and service registrations that belong to
+// the specified clusters, along with all of the device tombstones.
+func (s *Server) filterSync(clusters []string) ([]gopifinder.DeviceInfo, []gopifinder.ServiceInfo, []gopifinder.DeviceTombstone) {
+	dl := gopifinder.FilterDevices(s.GetDevices(), clusters)
+	sl := gopifinder.FilterServices(s.GetRegistry(), clusters)
+	return dl, sl, s.GetDeviceTombstones()
+}
+
+// requestDevices returns the devices that belong to the clusters of the sender of the request.
+func (s *Server) requestDevices(r *http.Request) []gopifinder.DeviceInfo {
+	return gopifinder.FilterDevices(s.GetDevices(), gopifinder.GetRequestClusters(r))
+}
+
+// requestServices returns the service registrations in the clusters of the sender of the request.
+func (s *Server) requestServices(r *http.Request) []gopifinder.ServiceInfo {
+	return gopifinder.FilterServices(s.GetServices(), gopifinder.GetRequestClusters(r))
+}
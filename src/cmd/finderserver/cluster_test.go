@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+func TestListsAreFilteredByTheCallersClusters(t *testing.T) {
+	s := newTestServer()
+	s.Devices = []gopifinder.DeviceInfo{
+		{MachineID: "lab", Clusters: []string{"lab"}},
+		{MachineID: "prod", Clusters: []string{"prod"}},
+		{MachineID: "default"},
+	}
+	s.Services = []gopifinder.ServiceInfo{
+		{ServiceName: "lab", Clusters: []string{"lab"}},
+		{ServiceName: "prod", Clusters: []string{"prod"}},
+	}
+	dc := DeviceController{Srv: s}
+	sc := ServiceController{Srv: s}
+
+	tests := []struct {
+		cluster string
+		device  string
+		service string
+	}{
+		{"lab", "lab", "lab"},
+		{"prod", "prod", "prod"},
+		{"", "default", ""},
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest("GET", "/device/get", nil)
+		r.Header.Set(gopifinder.HeaderCluster, tc.cluster)
+		w := httptest.NewRecorder()
+		dc.handleGetDevices(w, r)
+		dl := gopifinder.DeviceInfoList{}
+		if err := dl.ReadFrom(w.Result().Body); err != nil {
+			t.Fatal(err)
+		}
+		if len(dl.Devices) != 1 || dl.Devices[0].MachineID != tc.device {
+			t.Errorf("Cluster %q: expected device %q, got %v", tc.cluster, tc.device, dl.Devices)
+		}
+
+		r = httptest.NewRequest("GET", "/service/get", nil)
+		r.Header.Set(gopifinder.HeaderCluster, tc.cluster)
+		w = httptest.NewRecorder()
+		sc.handleGetLocal(w, r)
+		sl := gopifinder.ServiceInfoList{}
+		if err := sl.ReadFrom(w.Result().Body); err != nil {
+			t.Fatal(err)
+		}
+		if tc.service == "" {
+			if len(sl.Services) != 0 {
+				t.Errorf("Cluster %q: expected no services, got %v", tc.cluster, sl.Services)
+			}
+		} else if len(sl.Services) != 1 || sl.Services[0].ServiceName != tc.service {
+			t.Errorf("Cluster %q: expected service %q, got %v", tc.cluster, tc.service, sl.Services)
+		}
+	}
+}
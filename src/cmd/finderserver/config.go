@@ -0,0 +1,584 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brumawen/gopi-finder/src"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+const serviceName = "FinderService" // Name of the installed service, also used as the default journal unit
+
+// Config holds the server configuration.
+// The configuration is built from the defaults, then the configuration file, then the
+// FINDER_ environment variables and finally the command line flags, each overriding the last.
+type Config struct {
+	Port         int            `yaml:"port"`         // Port Number to listen on
+	BindAddress  string         `yaml:"bindAddress"`  // IP address to listen on, empty listens on all addresses
+	Timeout      time.Duration  `yaml:"timeout"`      // Time to wait for a response from an IP probe
+	SyncInterval time.Duration  `yaml:"syncInterval"` // Interval between registry syncs with a peer
+	ScanInterval time.Duration  `yaml:"scanInterval"` // Interval between network scans after the first, 0 only scans on start up
+	TombstoneTTL time.Duration  `yaml:"tombstoneTTL"` // How long removed devices and service registrations are remembered
+	Interfaces   []string       `yaml:"interfaces"`   // Network interfaces whose LANs are searched, empty searches all of them
+	Seeds        []string       `yaml:"seeds"`        // Peer IP addresses to join instead of searching the LAN
+	Clusters     []string       `yaml:"clusters"`     // Clusters the server belongs to
+	DataDir      string         `yaml:"dataDir"`      // Directory holding the identity, pinned keys and generated certificate
+	Security     SecurityConfig `yaml:"security"`     // Request signing and ownership settings
+	TLS          TLSConfig      `yaml:"tls"`          // HTTPS settings
+	Limits       LimitsConfig   `yaml:"limits"`       // Request and registry limits
+	Logging      LoggingConfig  `yaml:"logging"`      // Logging settings
+	Status       StatusConfig   `yaml:"status"`       // Status history settings
+	Features     Features       `yaml:"features"`     // Optional features of the server
+	file         string         // The configuration file that was loaded, if any
+	args         []string       // The command line arguments the configuration was built from
+	dir          string         // The working directory the configuration was built in
+}
+
+// SecurityConfig holds the request signing and ownership settings.
+type SecurityConfig struct {
+	Secret       string `yaml:"secret"`       // Shared cluster secret used to sign requests
+	ProtectReads bool   `yaml:"protectReads"` // Require read requests to be signed as well
+	KeyPolicy    string `yaml:"keyPolicy"`    // Action taken when a device's key does not match its pinned key
+	AdminToken   string `yaml:"adminToken"`   // Token that allows the holder to change any service registration
+	PolicyFile   string `yaml:"policy"`       // JSON file holding the registration policy
+}
+
+// TLSConfig holds the HTTPS settings.
+type TLSConfig struct {
+	Enabled  bool   `yaml:"enabled"`  // Serve HTTPS
+	CertFile string `yaml:"cert"`     // Server certificate file
+	KeyFile  string `yaml:"key"`      // Server private key file
+	CAFile   string `yaml:"ca"`       // Cluster CA certificate file used to verify peers
+	Mutual   bool   `yaml:"mutual"`   // Require peers to present a certificate issued by the cluster CA
+	Insecure bool   `yaml:"insecure"` // Connect to HTTPS peers without verifying their certificates
+}
+
+// LimitsConfig holds the request and registry limits.
+type LimitsConfig struct {
+	MaxBodySize int64   `yaml:"maxBodySize"` // Maximum size in bytes of a request body
+	RateLimit   float64 `yaml:"rateLimit"`   // Requests per second allowed from each client IP address, negative switches it off
+	RateBurst   float64 `yaml:"rateBurst"`   // Number of requests a client IP address may send at once
+	MaxDevices  int     `yaml:"maxDevices"`  // Maximum number of devices in the registry
+	MaxServices int     `yaml:"maxServices"` // Maximum number of services in the registry
+}
+
+// LoggingConfig holds the logging settings.
+type LoggingConfig struct {
+	Verbose     bool              `yaml:"verbose"`     // Log debug records, always on when running in a terminal
+	Level       string            `yaml:"level"`       // Minimum level logged, optionally followed by component=level pairs
+	Components  map[string]string `yaml:"components"`  // Minimum level logged by each component
+	Format      string            `yaml:"format"`      // Output format, text or json
+	JournalUnit string            `yaml:"journalUnit"` // The systemd unit whose journal is returned by /log/get
+	Units       []string          `yaml:"units"`       // Other systemd units whose journals may be read from /log/get
+	Files       map[string]string `yaml:"files"`       // Log files that may be read from /log/get, by name
+}
+
+// StatusConfig holds the status history settings.
+type StatusConfig struct {
+	Interval time.Duration `yaml:"interval"` // Interval between device status samples
+	Samples  int           `yaml:"samples"`  // Number of samples kept in the history
+	Persist  bool          `yaml:"persist"`  // Save the history in the data directory while running and when the server stops
+}
+
+// Features switches the optional features of the server on or off.
+type Features struct {
+	Scan             bool `yaml:"scan"`             // Search the LAN for other devices on start up
+	Gossip           bool `yaml:"gossip"`           // Probe peers to detect failed devices
+	Replication      bool `yaml:"replication"`      // Push registrations and device removals to the peers
+	RegistrySync     bool `yaml:"registrySync"`     // Periodically sync the registry with a random peer
+	Metrics          bool `yaml:"metrics"`          // Serve the /metrics endpoint
+	ServiceDiscovery bool `yaml:"serviceDiscovery"` // Serve the /service/sd endpoint
+	StatusHistory    bool `yaml:"statusHistory"`    // Sample the device status and serve the /status/history endpoint
+}
+
+// DefaultConfig returns the configuration used when nothing else is specified.
+func DefaultConfig() *Config {
+	return &Config{
+		Port:         gopifinder.DefaultPort,
+		Timeout:      5 * time.Second,
+		SyncInterval: 30 * time.Second,
+		TombstoneTTL: defaultTombstoneTTL,
+		Security:     SecurityConfig{KeyPolicy: "reject"},
+		Limits: LimitsConfig{
+			MaxBodySize: defaultMaxBodySize,
+			RateLimit:   defaultRateLimit,
+			RateBurst:   defaultRateBurst,
+			MaxDevices:  defaultMaxDevices,
+			MaxServices: defaultMaxServices,
+		},
+		Logging:  LoggingConfig{Level: "info", Format: gopifinder.LogFormatText, JournalUnit: serviceName},
+		Status:   StatusConfig{Interval: defaultStatusInterval, Samples: defaultStatusSamples, Persist: true},
+		Features: Features{Scan: true, Gossip: true, Metrics: true, ServiceDiscovery: true, StatusHistory: true},
+	}
+}
+
+// loadConfig builds the configuration from the defaults, the configuration file, the
+// environment and the command line arguments, and validates it.  Relative paths are
+// resolved against the specified directory.
+func loadConfig(args []string, dir string) (*Config, options, error) {
+	// Read the flags once to find the configuration file, then build the
+	// configuration so that the flags override the file and environment.
+	opts := options{}
+	DefaultConfig().FlagSet(&opts).Parse(args)
+
+	c := DefaultConfig()
+	c.args = args
+	c.dir = dir
+	if opts.ConfigFile != "" {
+		fn := opts.ConfigFile
+		if !filepath.IsAbs(fn) {
+			fn = filepath.Join(dir, fn)
+		}
+		if err := c.LoadFile(fn); err != nil {
+			return nil, opts, err
+		}
+	}
+	if err := c.ApplyEnv(os.Getenv); err != nil {
+		return nil, opts, err
+	}
+	c.FlagSet(&opts).Parse(args)
+	c.resolvePaths(dir)
+	return c, opts, c.Validate()
+}
+
+// LoadFile reads the YAML configuration file over the current configuration.
+// Settings missing from the file keep their current values.  Relative paths in
+// the file are relative to the directory holding the file.
+func (c *Config) LoadFile(fn string) error {
+	fn, err := filepath.Abs(fn)
+	if err != nil {
+		return errors.New("Error resolving the configuration file path. " + err.Error())
+	}
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return errors.New("Error reading the configuration file. " + err.Error())
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return errors.New("Error parsing the configuration file " + fn + ". " + err.Error())
+	}
+	c.file = fn
+	c.resolvePaths(filepath.Dir(fn))
+	return nil
+}
+
+// envFlags maps the environment variables to the command line flags they override.
+var envFlags = []struct {
+	env  string
+	flag string
+}{
+	{"FINDER_PORT", "p"},
+	{"FINDER_BIND", "bind"},
+	{"FINDER_TIMEOUT", "t"},
+	{"FINDER_SYNC", "sync"},
+	{"FINDER_SCAN_INTERVAL", "scaninterval"},
+	{"FINDER_TOMBSTONE_TTL", "tombstonettl"},
+	{"FINDER_INTERFACES", "interfaces"},
+	{"FINDER_SEEDS", "seeds"},
+	{"FINDER_CLUSTER", "cluster"},
+	{"FINDER_DATA_DIR", "datadir"},
+	{"FINDER_SECRET", "secret"},
+	{"FINDER_PROTECT_READS", "protectreads"},
+	{"FINDER_KEY_POLICY", "keypolicy"},
+	{"FINDER_ADMIN_TOKEN", "admintoken"},
+	{"FINDER_POLICY", "policy"},
+	{"FINDER_TLS", "tls"},
+	{"FINDER_TLS_CERT", "cert"},
+	{"FINDER_TLS_KEY", "key"},
+	{"FINDER_TLS_CA", "ca"},
+	{"FINDER_TLS_MUTUAL", "mtls"},
+	{"FINDER_TLS_INSECURE", "tlsinsecure"},
+	{"FINDER_MAX_BODY", "maxbody"},
+	{"FINDER_RATE_LIMIT", "ratelimit"},
+	{"FINDER_RATE_BURST", "rateburst"},
+	{"FINDER_MAX_DEVICES", "maxdevices"},
+	{"FINDER_MAX_SERVICES", "maxservices"},
+	{"FINDER_VERBOSE", "verbose"},
+	{"FINDER_LOG_LEVEL", "loglevel"},
+	{"FINDER_LOG_FORMAT", "logformat"},
+	{"FINDER_JOURNAL_UNIT", "journalunit"},
+	{"FINDER_LOG_UNITS", "logunits"},
+	{"FINDER_STATUS_INTERVAL", "statusinterval"},
+	{"FINDER_STATUS_SAMPLES", "statussamples"},
+	{"FINDER_STATUS_PERSIST", "statuspersist"},
+	{"FINDER_SCAN", "scan"},
+	{"FINDER_GOSSIP", "gossip"},
+	{"FINDER_REPLICATION", "replication"},
+	{"FINDER_REGISTRY_SYNC", "registrysync"},
+	{"FINDER_METRICS", "metrics"},
+	{"FINDER_SERVICE_DISCOVERY", "sd"},
+	{"FINDER_STATUS_HISTORY", "statushistory"},
+}
+
+// ApplyEnv applies the FINDER_ environment variables that are set, using the
+// same syntax as the matching command line flags.
+func (c *Config) ApplyEnv(getenv func(string) string) error {
+	fs := c.FlagSet(nil)
+	for _, i := range envFlags {
+		if v := getenv(i.env); v != "" {
+			if err := fs.Set(i.flag, v); err != nil {
+				return errors.New("Error reading environment variable " + i.env + ". " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// FlagSet returns a flag set that sets the configuration values.
+// The -config and -service flags are only added if the variables are passed.
+func (c *Config) FlagSet(opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	if opts != nil {
+		fs.StringVar(&opts.ConfigFile, "config", "", "YAML configuration file. Environment variables and flags override the values in the file.")
+		fs.StringVar(&opts.Service, "service", "", "Service action.  Valid actions are: 'start', 'stop', 'restart', 'install' and 'uninstall'")
+	}
+	fs.IntVar(&c.Port, "p", c.Port, "Port Number to listen on.")
+	fs.StringVar(&c.BindAddress, "bind", c.BindAddress, "IP address to listen on. All addresses are used if not set.")
+	secondsVar(fs, &c.Timeout, "t", "Timeout in seconds to wait for a response from a IP probe.")
+	secondsVar(fs, &c.SyncInterval, "sync", "Interval in seconds between registry syncs with a peer.")
+	fs.DurationVar(&c.ScanInterval, "scaninterval", c.ScanInterval, "Interval between network scans after the first. The network is only scanned on start up if not set.")
+	fs.DurationVar(&c.TombstoneTTL, "tombstonettl", c.TombstoneTTL, "How long removed devices and service registrations are remembered.")
+	listVar(fs, &c.Interfaces, "interfaces", "Comma separated list of the network interfaces whose LANs are searched. All interfaces are searched if not set.")
+	listVar(fs, &c.Seeds, "seeds", "Comma separated list of peer IP addresses to join instead of searching the LAN.")
+	listVar(fs, &c.Clusters, "cluster", "Comma separated list of the clusters this server belongs to. Peers in other clusters are ignored.")
+	fs.StringVar(&c.DataDir, "datadir", c.DataDir, "Directory holding the device identity, pinned keys and generated certificate.")
+	fs.StringVar(&c.Security.Secret, "secret", c.Security.Secret, "Shared cluster secret used to sign requests between servers and clients.")
+	fs.BoolVar(&c.Security.ProtectReads, "protectreads", c.Security.ProtectReads, "Require read requests to be signed with the cluster secret as well.")
+	fs.StringVar(&c.Security.KeyPolicy, "keypolicy", c.Security.KeyPolicy, "Action taken when a device's key does not match its pinned key. Valid actions are 'reject' and 'flag'.")
+	fs.StringVar(&c.Security.AdminToken, "admintoken", c.Security.AdminToken, "Admin token that allows the holder to change any service registration.")
+	fs.StringVar(&c.Security.PolicyFile, "policy", c.Security.PolicyFile, "JSON file holding the policy that limits which services each node may register.")
+	fs.BoolVar(&c.TLS.Enabled, "tls", c.TLS.Enabled, "Serve HTTPS. A self-signed certificate is generated if no certificate is specified.")
+	fs.StringVar(&c.TLS.CertFile, "cert", c.TLS.CertFile, "Server certificate file.")
+	fs.StringVar(&c.TLS.KeyFile, "key", c.TLS.KeyFile, "Server private key file.")
+	fs.StringVar(&c.TLS.CAFile, "ca", c.TLS.CAFile, "Cluster CA certificate file used to verify peers.")
+	fs.BoolVar(&c.TLS.Mutual, "mtls", c.TLS.Mutual, "Require peers to present a certificate issued by the cluster CA.")
+	fs.BoolVar(&c.TLS.Insecure, "tlsinsecure", c.TLS.Insecure, "Connect to HTTPS peers without verifying their certificates, such as peers with self-signed certificates and no cluster CA.")
+	fs.Int64Var(&c.Limits.MaxBodySize, "maxbody", c.Limits.MaxBodySize, "Maximum size in bytes of a request body.")
+	fs.Float64Var(&c.Limits.RateLimit, "ratelimit", c.Limits.RateLimit, "Requests per second allowed from each client IP address. A negative rate switches rate limiting off, 0 is not allowed.")
+	fs.Float64Var(&c.Limits.RateBurst, "rateburst", c.Limits.RateBurst, "Number of requests a client IP address may send at once.")
+	fs.IntVar(&c.Limits.MaxDevices, "maxdevices", c.Limits.MaxDevices, "Maximum number of devices in the registry.")
+	fs.IntVar(&c.Limits.MaxServices, "maxservices", c.Limits.MaxServices, "Maximum number of services in the registry.")
+	fs.BoolVar(&c.Logging.Verbose, "verbose", c.Logging.Verbose, "Switch on verbose logging.")
+	fs.StringVar(&c.Logging.Level, "loglevel", c.Logging.Level, "Minimum level logged, optionally followed by component=level pairs. For example info,finder=debug,http=warn")
+	fs.StringVar(&c.Logging.Format, "logformat", c.Logging.Format, "Log output format. Valid formats are 'text' and 'json'.")
+	fs.StringVar(&c.Logging.JournalUnit, "journalunit", c.Logging.JournalUnit, "The systemd unit whose journal is returned by /log/get.")
+	listVar(fs, &c.Logging.Units, "logunits", "Comma separated list of the other systemd units whose journals may be read from /log/get.")
+	fs.DurationVar(&c.Status.Interval, "statusinterval", c.Status.Interval, "Interval between the device status samples kept in the status history.")
+	fs.IntVar(&c.Status.Samples, "statussamples", c.Status.Samples, "Number of device status samples kept in the status history.")
+	fs.BoolVar(&c.Status.Persist, "statuspersist", c.Status.Persist, "Save the status history in the data directory every 10 minutes and when the server stops.")
+	fs.BoolVar(&c.Features.Scan, "scan", c.Features.Scan, "Search the LAN for other devices on start up.")
+	fs.BoolVar(&c.Features.Gossip, "gossip", c.Features.Gossip, "Probe peers to detect failed devices.")
+	fs.BoolVar(&c.Features.Replication, "replication", c.Features.Replication, "Push registrations and device removals to the peers.  Requires a secret or mutual TLS.")
+	fs.BoolVar(&c.Features.RegistrySync, "registrysync", c.Features.RegistrySync, "Periodically sync the registry with a random peer.  Requires a secret or mutual TLS.")
+	fs.BoolVar(&c.Features.Metrics, "metrics", c.Features.Metrics, "Serve the /metrics endpoint.")
+	fs.BoolVar(&c.Features.ServiceDiscovery, "sd", c.Features.ServiceDiscovery, "Serve the /service/sd endpoint.")
+	fs.BoolVar(&c.Features.StatusHistory, "statushistory", c.Features.StatusHistory, "Sample the device status and serve the /status/history endpoint.")
+	return fs
+}
+
+// ServiceArgs returns the arguments the installed service is started with, so that it
+// runs with the same configuration file and command line flags as the install command.
+// The flag values are taken from the configuration, so relative paths are passed resolved.
+func (c *Config) ServiceArgs() []string {
+	l := []string{}
+	if c.file != "" {
+		l = append(l, "-config", c.file)
+	}
+	set := DefaultConfig().FlagSet(&options{})
+	set.Parse(c.args)
+	cur := c.FlagSet(nil)
+	set.Visit(func(f *flag.Flag) {
+		if v := cur.Lookup(f.Name); v != nil {
+			l = append(l, "-"+f.Name+"="+v.Value.String())
+		}
+	})
+	return l
+}
+
+// EnvSettings returns the FINDER_ environment variables that are set.
+func EnvSettings(getenv func(string) string) []string {
+	l := []string{}
+	for _, i := range envFlags {
+		if getenv(i.env) != "" {
+			l = append(l, i.env)
+		}
+	}
+	return l
+}
+
+// options holds the command line flags that are not part of the configuration.
+type options struct {
+	ConfigFile string // The configuration file to load
+	Service    string // The service control action
+}
+
+// Validate checks the configuration and returns an error listing all of the problems found.
+func (c *Config) Validate() error {
+	l := []string{}
+	add := func(format string, v ...interface{}) {
+		l = append(l, fmt.Sprintf(format, v...))
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		add("port %d must be between 1 and 65535", c.Port)
+	}
+	if c.BindAddress != "" && net.ParseIP(c.BindAddress) == nil {
+		add("bindAddress %q is not an IP address", c.BindAddress)
+	}
+	if c.Timeout < time.Second {
+		add("timeout %s must be at least 1s", c.Timeout)
+	}
+	if c.SyncInterval <= 0 {
+		add("syncInterval %s must be greater than 0", c.SyncInterval)
+	}
+	if c.TombstoneTTL <= 0 {
+		add("tombstoneTTL %s must be greater than 0", c.TombstoneTTL)
+	}
+	for _, i := range c.Interfaces {
+		if strings.TrimSpace(i) == "" {
+			add("interfaces must not contain an empty name")
+		}
+	}
+	for _, i := range c.Seeds {
+		if net.ParseIP(i) == nil {
+			add("seed %q is not an IP address", i)
+		}
+	}
+	switch c.Security.KeyPolicy {
+	case "reject", "flag":
+	default:
+		add("keyPolicy %q is invalid, valid policies are 'reject' and 'flag'", c.Security.KeyPolicy)
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		add("tls cert and key must be specified together")
+	}
+	if c.TLS.Mutual && c.TLS.CAFile == "" {
+		add("tls mutual requires a ca file")
+	}
+	// Peers reject replicas that are neither signed nor sent with a client certificate
+	if c.Security.Secret == "" && !c.TLS.Mutual {
+		if c.Features.Replication {
+			add("replication requires a secret or mutual tls")
+		}
+		if c.Features.RegistrySync {
+			add("registrySync requires a secret or mutual tls")
+		}
+	}
+	for _, i := range []struct{ name, fn string }{
+		{"tls cert", c.TLS.CertFile},
+		{"tls key", c.TLS.KeyFile},
+		{"tls ca", c.TLS.CAFile},
+		{"policy", c.Security.PolicyFile},
+	} {
+		if i.fn == "" {
+			continue
+		}
+		if _, err := os.Stat(i.fn); err != nil {
+			add("%s file %s cannot be read", i.name, i.fn)
+		}
+	}
+	if c.DataDir != "" {
+		if fi, err := os.Stat(c.DataDir); err != nil || !fi.IsDir() {
+			add("dataDir %s is not a directory", c.DataDir)
+		}
+	}
+	if c.ScanInterval < 0 {
+		add("scanInterval %s must not be negative", c.ScanInterval)
+	}
+	if c.Limits.MaxBodySize <= 0 {
+		add("maxBodySize %d must be greater than 0", c.Limits.MaxBodySize)
+	}
+	if c.Limits.RateLimit == 0 {
+		add("rateLimit must not be 0, use a negative rate to switch rate limiting off")
+	}
+	if c.Limits.RateLimit > 0 && c.Limits.RateBurst < 1 {
+		add("rateBurst %g must be at least 1", c.Limits.RateBurst)
+	}
+	if c.Limits.MaxDevices <= 0 {
+		add("maxDevices %d must be greater than 0", c.Limits.MaxDevices)
+	}
+	if c.Limits.MaxServices <= 0 {
+		add("maxServices %d must be greater than 0", c.Limits.MaxServices)
+	}
+	if _, err := c.logLevels(false); err != nil {
+		add("logging level: %s", err.Error())
+	}
+	if c.Logging.Format != gopifinder.LogFormatText && c.Logging.Format != gopifinder.LogFormatJSON {
+		add("logging format %q is invalid, valid formats are 'text' and 'json'", c.Logging.Format)
+	}
+	if c.Logging.JournalUnit == "" {
+		add("journalUnit must not be empty")
+	}
+	for k, v := range c.Logging.Files {
+		if k == "" || v == "" {
+			add("logging files must have a name and a path")
+		}
+	}
+	if c.Status.Interval < time.Second {
+		add("status interval %s must be at least 1s", c.Status.Interval)
+	}
+	if c.Status.Samples <= 0 {
+		add("status samples %d must be greater than 0", c.Status.Samples)
+	}
+	if len(l) != 0 {
+		src := "configuration"
+		if c.file != "" {
+			src = "configuration in " + c.file
+		}
+		return errors.New("Invalid " + src + ":\n  " + strings.Join(l, "\n  "))
+	}
+	return nil
+}
+
+// resolvePaths makes the relative file paths absolute, relative to the specified directory.
+// The server changes to the directory of its executable on start up, so relative paths
+// must be resolved first.
+func (c *Config) resolvePaths(dir string) {
+	for _, p := range []*string{&c.DataDir, &c.TLS.CertFile, &c.TLS.KeyFile, &c.TLS.CAFile, &c.Security.PolicyFile} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	for k, v := range c.Logging.Files {
+		if v != "" && !filepath.IsAbs(v) {
+			c.Logging.Files[k] = filepath.Join(dir, v)
+		}
+	}
+}
+
+// NewServer creates a server from the configuration.
+func NewServer(c *Config) *Server {
+	s := &Server{
+		PortNo:            c.Port,
+		BindAddress:       c.BindAddress,
+		Timeout:           int(c.Timeout / time.Second),
+		SyncInterval:      c.SyncInterval,
+		ScanInterval:      c.ScanInterval,
+		TombstoneTTL:      c.TombstoneTTL,
+		Interfaces:        c.Interfaces,
+		Seeds:             c.Seeds,
+		Clusters:          c.Clusters,
+		Secret:            c.Security.Secret,
+		ProtectReads:      c.Security.ProtectReads,
+		RejectKeyMismatch: c.Security.KeyPolicy != "flag",
+		AdminToken:        c.Security.AdminToken,
+		PolicyFile:        c.Security.PolicyFile,
+		TLS:               c.TLS.Enabled || c.TLS.Mutual,
+		CertFile:          c.TLS.CertFile,
+		KeyFile:           c.TLS.KeyFile,
+		CAFile:            c.TLS.CAFile,
+		MutualTLS:         c.TLS.Mutual,
+		TLSInsecure:       c.TLS.Insecure,
+		MaxBodySize:       c.Limits.MaxBodySize,
+		RateLimit:         c.Limits.RateLimit,
+		RateBurst:         c.Limits.RateBurst,
+		MaxDevices:        c.Limits.MaxDevices,
+		MaxServices:       c.Limits.MaxServices,
+		JournalUnit:       c.Logging.JournalUnit,
+		LogUnits:          c.Logging.Units,
+		LogFiles:          c.Logging.Files,
+		StatusInterval:    c.Status.Interval,
+		StatusSamples:     c.Status.Samples,
+		PersistStatus:     c.Status.Persist,
+		Features:          c.Features,
+		DataDir:           c.DataDir,
+		config:            c,
+		started:           c,
+	}
+	// Log to standard error until the caller sets up its own logger
+	levels, err := c.logLevels(false)
+	if err != nil {
+		levels = gopifinder.NewLogLevels(gopifinder.LevelInfo)
+	}
+	s.LogLevels = levels
+	s.Log = gopifinder.NewLogger(gopifinder.NewWriterSink(os.Stderr, c.Logging.Format), levels)
+	return s
+}
+
+// logLevels returns the levels logged by each component.  Verbose logging logs
+// debug records from the components that have not been given their own level.
+func (c *Config) logLevels(verbose bool) (*gopifinder.LogLevels, error) {
+	l, err := gopifinder.ParseLogLevels(c.Logging.Level)
+	if err != nil {
+		return nil, err
+	}
+	if verbose || c.Logging.Verbose {
+		l.Set("", gopifinder.LevelDebug)
+	}
+	for k, v := range c.Logging.Components {
+		level, err := gopifinder.ParseLogLevel(v)
+		if err != nil {
+			return nil, errors.New("Component " + k + ". " + err.Error())
+		}
+		l.Set(k, level)
+	}
+	return l, nil
+}
+
+// listValue is a flag holding a comma separated list.
+type listValue struct {
+	l *[]string
+}
+
+func (v listValue) String() string {
+	if v.l == nil {
+		return ""
+	}
+	return strings.Join(*v.l, ",")
+}
+
+func (v listValue) Set(s string) error {
+	*v.l = nil
+	for _, i := range strings.Split(s, ",") {
+		if i = strings.TrimSpace(i); i != "" {
+			*v.l = append(*v.l, i)
+		}
+	}
+	return nil
+}
+
+func listVar(fs *flag.FlagSet, l *[]string, name string, usage string) {
+	fs.Var(listValue{l: l}, name, usage)
+}
+
+// secondsValue is a flag holding a duration given as a whole number of seconds.
+// Duration strings like 1m30s are accepted as well.
+type secondsValue struct {
+	d *time.Duration
+}
+
+func (v secondsValue) String() string {
+	if v.d == nil {
+		return ""
+	}
+	return strconv.Itoa(int(*v.d / time.Second))
+}
+
+func (v secondsValue) Set(s string) error {
+	if n, err := strconv.Atoi(s); err == nil {
+		*v.d = time.Duration(n) * time.Second
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.New("invalid number of seconds")
+	}
+	*v.d = d
+	return nil
+}
+
+func secondsVar(fs *flag.FlagSet, d *time.Duration, name string, usage string) {
+	fs.Var(secondsValue{d: d}, name, usage)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes the YAML configuration file to the directory.
+func writeConfig(t *testing.T, dir string, yaml string) string {
+	fn := filepath.Join(dir, "finder.yml")
+	if err := ioutil.WriteFile(fn, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "port: 20510\ntimeout: 3s\nseeds: [10.0.0.1]\nclusters: [lab]\n")
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		args     []string
+		port     int
+		timeout  time.Duration
+		seeds    []string
+		clusters []string
+	}{
+		{"defaults", nil, nil, 20502, 5 * time.Second, nil, nil},
+		{"file", nil, []string{"-config", "finder.yml"}, 20510, 3 * time.Second, []string{"10.0.0.1"}, []string{"lab"}},
+		{"env over file", map[string]string{"FINDER_PORT": "20520", "FINDER_SEEDS": "10.0.0.2,10.0.0.3"},
+			[]string{"-config", "finder.yml"}, 20520, 3 * time.Second, []string{"10.0.0.2", "10.0.0.3"}, []string{"lab"}},
+		{"flag over env", map[string]string{"FINDER_PORT": "20520", "FINDER_TIMEOUT": "7"},
+			[]string{"-config", "finder.yml", "-p", "20530", "-cluster", "prod"}, 20530, 7 * time.Second, []string{"10.0.0.1"}, []string{"prod"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			c, _, err := loadConfig(tc.args, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Port != tc.port || c.Timeout != tc.timeout {
+				t.Errorf("Expected port %d and timeout %s, got %d and %s", tc.port, tc.timeout, c.Port, c.Timeout)
+			}
+			if !reflect.DeepEqual(c.Seeds, tc.seeds) || !reflect.DeepEqual(c.Clusters, tc.clusters) {
+				t.Errorf("Expected seeds %v and clusters %v, got %v and %v", tc.seeds, tc.clusters, c.Seeds, c.Clusters)
+			}
+		})
+	}
+}
+
+func TestConfigResolvesRelativePaths(t *testing.T) {
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "conf")
+	for _, d := range []string{confDir, filepath.Join(confDir, "data"), filepath.Join(dir, "flagdata")} {
+		if err := os.Mkdir(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig(t, confDir, "dataDir: data\ntls:\n  ca: ca.crt\nlogging:\n  files:\n    app: app.log\n")
+	if err := ioutil.WriteFile(filepath.Join(confDir, "ca.crt"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Paths in the file are relative to the file, and flags to the working directory
+	c, _, err := loadConfig([]string{"-config", "conf/finder.yml"}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.DataDir != filepath.Join(confDir, "data") || c.TLS.CAFile != filepath.Join(confDir, "ca.crt") ||
+		c.Logging.Files["app"] != filepath.Join(confDir, "app.log") {
+		t.Errorf("Expected the file paths to be relative to the file, got %s, %s and %s", c.DataDir, c.TLS.CAFile, c.Logging.Files["app"])
+	}
+
+	c, _, err = loadConfig([]string{"-config", "conf/finder.yml", "-datadir", "flagdata"}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.DataDir != filepath.Join(dir, "flagdata") {
+		t.Errorf("Expected the flag path to be relative to the working directory, got %s", c.DataDir)
+	}
+}
+
+func TestConfigValidateListsEveryProblem(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(c *Config)
+		msg   string
+		alone bool // The problem cannot be combined with the others
+	}{
+		{"port", func(c *Config) { c.Port = 70000 }, "port 70000 must be between 1 and 65535", false},
+		{"rate limit", func(c *Config) { c.Limits.RateLimit = 0 }, "rateLimit must not be 0", false},
+		{"rate burst", func(c *Config) { c.Limits.RateBurst = 0 }, "rateBurst 0 must be at least 1", true},
+		{"max body", func(c *Config) { c.Limits.MaxBodySize = 0 }, "maxBodySize 0 must be greater than 0", false},
+		{"log format", func(c *Config) { c.Logging.Format = "xml" }, `logging format "xml" is invalid`, false},
+		{"status samples", func(c *Config) { c.Status.Samples = 0 }, "status samples 0 must be greater than 0", false},
+		{"data dir", func(c *Config) { c.DataDir = "/does/not/exist" }, "dataDir /does/not/exist is not a directory", false},
+		{"replication", func(c *Config) { c.Features.Replication = true }, "replication requires a secret or mutual tls", false},
+		{"registry sync", func(c *Config) { c.Features.RegistrySync = true }, "registrySync requires a secret or mutual tls", false},
+	}
+	all := DefaultConfig()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := DefaultConfig()
+			tc.edit(c)
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), tc.msg) {
+				t.Errorf("Expected %q, got %v", tc.msg, err)
+			}
+		})
+		if !tc.alone {
+			tc.edit(all)
+		}
+	}
+
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Errorf("Expected the defaults to be valid, got %v", err)
+	}
+	c := DefaultConfig()
+	c.Security.Secret = "s3cret"
+	c.Features.Replication, c.Features.RegistrySync = true, true
+	if err := c.Validate(); err != nil {
+		t.Errorf("Expected replication with a secret to be valid, got %v", err)
+	}
+	err := all.Validate()
+	if err == nil {
+		t.Fatal("Expected the configuration to be invalid")
+	}
+	for _, tc := range tests {
+		if !tc.alone && !strings.Contains(err.Error(), tc.msg) {
+			t.Errorf("Expected every problem to be listed, %q is missing", tc.msg)
+		}
+	}
+}
+
+func TestServiceArgsKeepTheInstallFlags(t *testing.T) {
+	dir := t.TempDir()
+	fn := writeConfig(t, dir, "port: 20510\n")
+	if err := os.Mkdir(filepath.Join(dir, "data"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	c, _, err := loadConfig([]string{"-service", "install", "-config", "finder.yml", "-p", "20530", "-secret", "s3cret", "-datadir", "data"}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-config", fn, "-datadir=" + filepath.Join(dir, "data"), "-p=20530", "-secret=s3cret"}
+	if l := c.ServiceArgs(); !reflect.DeepEqual(l, want) {
+		t.Errorf("Expected %v, got %v", want, l)
+	}
+}
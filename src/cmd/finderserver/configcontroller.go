@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// ConfigController handles the Web Methods used to manage the server configuration.
+type ConfigController struct {
+	Srv *Server
+}
+
+// AddController adds the routes associated with the controller to the router.
+func (c *ConfigController) AddController(router *mux.Router, s *Server) {
+	c.Srv = s
+	router.Methods("POST").Path("/config/reload").Name("ReloadConfig").
+		HandlerFunc(c.handleReload)
+}
+
+// handleReload handles the /config/reload web method call.
+// Only admins may reload the configuration.
+func (c *ConfigController) handleReload(w http.ResponseWriter, r *http.Request) {
+	caller, err := c.Srv.NewCaller(r)
+	if err != nil {
+		http.Error(w, "Unauthorized. "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !caller.Admin {
+		http.Error(w, "Only admins may reload the configuration.", http.StatusForbidden)
+		return
+	}
+	res, err := c.Srv.Reload()
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, "Error serializing reload result. "+err.Error(), 500)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"net/http"
 
 	"github.com/brumawen/gopi-finder/src"
@@ -18,16 +17,16 @@ type DeviceController struct {
 func (c *DeviceController) AddController(router *mux.Router, s *Server) {
 	c.Srv = s
 	router.Methods("GET").Path("/device/get").Name("GetDevices").
-		Handler(Logger(c, http.HandlerFunc(c.handleGetDevices)))
+		HandlerFunc(c.handleGetDevices)
 	router.Methods("DELETE").Path("/device/remove/{id}").Name("RemoveDevice").
-		Handler(Logger(c, http.HandlerFunc(c.handleRemoveDevice)))
+		HandlerFunc(c.handleRemoveDevice)
 	router.Methods("GET").Path("/device/refresh").Name("RefreshDevices").
-		Handler(Logger(c, http.HandlerFunc(c.handleRefreshDevices)))
+		HandlerFunc(c.handleRefreshDevices)
 }
 
 // handleGetDevices handles the /device/getdevices web method call
 func (c *DeviceController) handleGetDevices(w http.ResponseWriter, r *http.Request) {
-	l := gopifinder.DeviceInfoList{Devices: c.Srv.Devices}
+	l := gopifinder.DeviceInfoList{Devices: c.Srv.requestDevices(r)}
 	if err := l.WriteTo(w); err != nil {
 		http.Error(w, "Error serializing Device list. "+err.Error(), 500)
 	}
@@ -38,9 +37,13 @@ func (c *DeviceController) handleRemoveDevice(w http.ResponseWriter, r *http.Req
 	id := vars["id"]
 	if id == "" {
 		http.Error(w, "Invalid ID", 400)
+	} else if caller, err := c.Srv.NewCaller(r); err != nil {
+		http.Error(w, "Unauthorized. "+err.Error(), http.StatusUnauthorized)
 	} else {
 		// Remove the device from the list
-		c.Srv.RemoveDevice(id)
+		if err := c.Srv.RemoveDevice(id, caller); err != nil {
+			writeError(w, err, err.Error())
+		}
 	}
 }
 
@@ -48,9 +51,3 @@ func (c *DeviceController) handleRefreshDevices(w http.ResponseWriter, r *http.R
 	go c.Srv.ScanForDevices()
 	w.Write([]byte("Refresh Started."))
 }
-
-// LogInfo is used to log information messages for this controller.
-func (c *DeviceController) LogInfo(v ...interface{}) {
-	a := fmt.Sprint(v)
-	logger.Info("DeviceController: ", a[1:len(a)-1])
-}
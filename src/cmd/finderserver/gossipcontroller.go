@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/brumawen/gopi-finder/src"
+
+	"github.com/gorilla/mux"
+)
+
+// GossipController handles the Web Methods used by the gossip failure detector.
+type GossipController struct {
+	Srv *Server
+}
+
+// AddController adds the routes associated with the controller to the router.
+func (c *GossipController) AddController(router *mux.Router, s *Server) {
+	c.Srv = s
+	router.Methods("POST").Path("/gossip/ping").Name("GossipPing").
+		HandlerFunc(c.handlePing)
+	router.Methods("POST").Path("/gossip/pingreq").Name("GossipPingReq").
+		HandlerFunc(c.handlePingReq)
+	router.Methods("GET").Path("/gossip/members").Name("GetMembers").
+		HandlerFunc(c.handleGetMembers)
+}
+
+// handlePing handles the /gossip/ping web method call
+func (c *GossipController) handlePing(w http.ResponseWriter, r *http.Request) {
+	msg := gopifinder.GossipMessage{}
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	c.writeMessage(w, c.Srv.Members.HandlePing(msg))
+}
+
+// handlePingReq handles the /gossip/pingreq web method call
+func (c *GossipController) handlePingReq(w http.ResponseWriter, r *http.Request) {
+	msg := gopifinder.GossipMessage{}
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	ack, ok := c.Srv.Members.HandlePingReq(msg)
+	if !ok {
+		http.Error(w, "Target did not respond.", 504)
+		return
+	}
+	c.writeMessage(w, ack)
+}
+
+// handleGetMembers handles the /gossip/members web method call
+func (c *GossipController) handleGetMembers(w http.ResponseWriter, r *http.Request) {
+	l := gopifinder.MemberList{Members: c.Srv.Members.Members()}
+	if err := l.WriteTo(w); err != nil {
+		http.Error(w, "Error serializing Member list. "+err.Error(), 500)
+	}
+}
+
+func (c *GossipController) writeMessage(w http.ResponseWriter, msg gopifinder.GossipMessage) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		http.Error(w, "Error serializing gossip message. "+err.Error(), 500)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+}
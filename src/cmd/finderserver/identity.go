@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+const (
+	defaultIdentityFile   = "identity.key"    // Device identity key file
+	defaultPinnedKeysFile = "pinnedkeys.json" // Pinned peer keys file
+)
+
+// checkDeviceKey checks the device's signature and public key against the key pinned
+// for its MachineID.  The key is pinned the first time a signed device is seen, after
+// which the device must always be signed.  Device information signed before the
+// information already held for the device is rejected as a replay.
+// A device whose key does not match the pinned key is rejected if RejectKeyMismatch
+// is set, otherwise it is flagged as untrusted.
+// Returns whether or not the device must be accepted.
+func (s *Server) checkDeviceKey(d *gopifinder.DeviceInfo) bool {
+	if d.MachineID == "" {
+		return true
+	}
+	d.Untrusted = false
+	signed := d.PublicKey != "" || d.Signature != ""
+	if signed {
+		if err := d.VerifySignature(); err != nil {
+			s.logError("Rejected device", append(deviceFields(*d), gopifinder.ErrField(err))...)
+			return false
+		}
+		if held, ok := s.getDevice(d.MachineID); ok && held.PublicKey == d.PublicKey && d.Signed.Before(held.Signed) {
+			s.logDebug("Ignoring device information older than the information held", deviceFields(*d)...)
+			return false
+		}
+	}
+
+	s.pinMu.Lock()
+	defer s.pinMu.Unlock()
+	if s.pinnedKeys == nil {
+		s.pinnedKeys = map[string]string{}
+	}
+	pinned, ok := s.pinnedKeys[d.MachineID]
+	if !ok {
+		if signed {
+			s.logDebug("Pinned key for device", deviceFields(*d)...)
+			s.pinnedKeys[d.MachineID] = d.PublicKey
+			s.savePinnedKeys()
+		}
+		return true
+	}
+	if !signed {
+		s.logError("Rejected unsigned device as a key is pinned for it", deviceFields(*d)...)
+		return false
+	}
+	if pinned == d.PublicKey {
+		return true
+	}
+	s.cfgMu.RLock()
+	reject := s.RejectKeyMismatch
+	s.cfgMu.RUnlock()
+	if reject {
+		s.logError("Rejected device as its key does not match the pinned key", deviceFields(*d)...)
+		return false
+	}
+	s.logWarn("Device key does not match the pinned key", deviceFields(*d)...)
+	d.Untrusted = true
+	return true
+}
+
+// pinnedMachineID returns the MachineID the public key is pinned for, or an empty
+// string if the key is not pinned.
+func (s *Server) pinnedMachineID(key string) string {
+	if key == "" {
+		return ""
+	}
+	s.pinMu.Lock()
+	defer s.pinMu.Unlock()
+	for id, k := range s.pinnedKeys {
+		if k == key {
+			return id
+		}
+	}
+	return ""
+}
+
+// loadPinnedKeys reads the pinned peer keys from the pinned keys file.
+func (s *Server) loadPinnedKeys() {
+	s.pinMu.Lock()
+	defer s.pinMu.Unlock()
+	s.pinnedKeys = map[string]string{}
+	b, err := ioutil.ReadFile(s.getPinnedKeysFile())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.logError("Error reading pinned keys", gopifinder.ErrField(err))
+		}
+		return
+	}
+	if err := json.Unmarshal(b, &s.pinnedKeys); err != nil {
+		s.logError("Error parsing pinned keys", gopifinder.ErrField(err))
+	}
+}
+
+// savePinnedKeys writes the pinned peer keys to the pinned keys file.
+// The caller must hold the pin lock.
+func (s *Server) savePinnedKeys() {
+	b, err := json.MarshalIndent(s.pinnedKeys, "", "  ")
+	if err != nil {
+		s.logError("Error serializing pinned keys", gopifinder.ErrField(err))
+		return
+	}
+	if err := ioutil.WriteFile(s.getPinnedKeysFile(), b, 0600); err != nil {
+		s.logError("Error writing pinned keys", gopifinder.ErrField(err))
+	}
+}
+
+func (s *Server) getIdentityFile() string {
+	if s.IdentityFile == "" {
+		return s.dataFile(defaultIdentityFile)
+	}
+	return s.IdentityFile
+}
+
+func (s *Server) getPinnedKeysFile() string {
+	if s.PinnedKeysFile == "" {
+		return s.dataFile(defaultPinnedKeysFile)
+	}
+	return s.PinnedKeysFile
+}
+
+// dataFile returns the path of a state file the server writes, in the DataDir if one is set.
+func (s *Server) dataFile(fn string) string {
+	if s.DataDir == "" {
+		return fn
+	}
+	return filepath.Join(s.DataDir, fn)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+func TestPinnedDeviceMustStaySigned(t *testing.T) {
+	s := newTestServer()
+	s.DataDir = t.TempDir()
+	s.RejectKeyMismatch = true
+	id, err := gopifinder.LoadIdentity(filepath.Join(s.DataDir, "peer.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := gopifinder.DeviceInfo{MachineID: "peer", HostName: "peer", IPAddress: []string{"192.168.1.20"}}
+	id.SignDevice(&d)
+	if !s.addDevice(d) {
+		t.Fatal("Expected the signed device to be accepted")
+	}
+
+	// A forged copy with the victim's key but no signature is rejected
+	forged := d
+	forged.IPAddress = []string{"192.168.1.66"}
+	forged.Signature = ""
+	if s.addDevice(forged) {
+		t.Error("Expected an unsigned device with a pinned key to be rejected")
+	}
+	forged.PublicKey = ""
+	if s.addDevice(forged) {
+		t.Error("Expected an unsigned device without a key to be rejected once a key is pinned")
+	}
+
+	// Newer device information is accepted, and the older information cannot be replayed
+	time.Sleep(time.Millisecond)
+	newer := d
+	id.SignDevice(&newer)
+	if !s.addDevice(newer) {
+		t.Error("Expected newer device information to be accepted")
+	}
+	if s.addDevice(d) {
+		t.Error("Expected older device information to be rejected")
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+const (
+	defaultMaxBodySize = 1 << 20 // Default maximum size in bytes of a request body
+	defaultRateLimit   = 20      // Default requests per second allowed from each client
+	defaultRateBurst   = 40      // Default number of requests a client may send at once
+	defaultMaxDevices  = 256     // Default maximum number of devices in the registry
+	defaultMaxServices = 1000    // Default maximum number of services in the registry
+	registryRetryAfter = "60"    // Seconds a client turned away by a full registry should wait
+)
+
+// ErrRegistryFull is returned when a registration would take the registry over its maximum size.
+var ErrRegistryFull = errors.New("The service registry is full")
+
+// limitCounters counts the requests and registrations rejected by the server's limits.
+type limitCounters struct {
+	BodyTooLarge int64 // Requests rejected because the body was too large
+	RateLimited  int64 // Requests rejected by the per client rate limit
+	RegistryFull int64 // Devices and services rejected because the registry was full
+}
+
+// LimitRequests is a router middleware that applies the per client rate limit and the
+// maximum request body size.  The body is read up front, so that the handlers and the
+// request signature checks never read more than MaxBodySize bytes.
+func (s *Server) LimitRequests(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.cfgMu.RLock()
+		limiter := s.limiter
+		s.cfgMu.RUnlock()
+		if limiter != nil && !limiter.Allow(clientIP(r)) {
+			atomic.AddInt64(&s.limits.RateLimited, 1)
+			s.logDebug("Rate limited request", requestFields(r)...)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many requests.", http.StatusTooManyRequests)
+			return
+		}
+
+		max := s.getMaxBodySize()
+		if r.ContentLength > max {
+			s.rejectBody(w, r)
+			return
+		}
+		if r.Body != nil && r.Body != http.NoBody {
+			b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, max))
+			r.Body.Close()
+			if err != nil {
+				var mbe *http.MaxBytesError
+				if errors.As(err, &mbe) {
+					s.rejectBody(w, r)
+				} else {
+					http.Error(w, "Error reading request. "+err.Error(), http.StatusBadRequest)
+				}
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// rejectBody responds to a request whose body is over the maximum size.
+func (s *Server) rejectBody(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&s.limits.BodyTooLarge, 1)
+	s.logDebug("Rejected request as the body is too large", requestFields(r)...)
+	http.Error(w, "Request body is larger than "+strconv.FormatInt(s.getMaxBodySize(), 10)+" bytes.", http.StatusRequestEntityTooLarge)
+}
+
+// newRateLimiter creates the per client rate limiter.
+// Returns nil if rate limiting has been switched off.  The configuration does not
+// allow a rate of 0, which only a Server created without one has, and which gets
+// the default rate.
+func (s *Server) newRateLimiter() *rateLimiter {
+	if s.RateLimit < 0 {
+		return nil
+	}
+	l := &rateLimiter{Rate: s.RateLimit, Burst: s.RateBurst}
+	if l.Rate == 0 {
+		l.Rate = defaultRateLimit
+	}
+	if l.Burst <= 0 {
+		l.Burst = 2 * l.Rate
+	}
+	return l
+}
+
+// getMaxBodySize returns the maximum size of a request body in bytes.
+func (s *Server) getMaxBodySize() int64 {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	if s.MaxBodySize <= 0 {
+		return defaultMaxBodySize
+	}
+	return s.MaxBodySize
+}
+
+// getMaxDevices returns the maximum number of devices in the Devices list.
+func (s *Server) getMaxDevices() int {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	if s.MaxDevices <= 0 {
+		return defaultMaxDevices
+	}
+	return s.MaxDevices
+}
+
+// getMaxServices returns the maximum number of registrations in the Services list.
+func (s *Server) getMaxServices() int {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	if s.MaxServices <= 0 {
+		return defaultMaxServices
+	}
+	return s.MaxServices
+}
+
+// rejectFull counts a device or service that was rejected because the registry is full.
+func (s *Server) rejectFull(kind string, name string) {
+	atomic.AddInt64(&s.limits.RegistryFull, 1)
+	s.logWarn("Registry is full", gopifinder.Field("kind", kind), gopifinder.Field("name", name))
+}
+
+// clientIP returns the IP address of the client that sent the request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimiter applies a token bucket rate limit to each client.
+type rateLimiter struct {
+	Rate    float64 // The number of requests allowed per second
+	Burst   float64 // The maximum number of requests allowed at once
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	pruned  time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Allow takes a token from the client's bucket.
+// Returns false if the bucket is empty.
+func (l *rateLimiter) Allow(client string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.buckets == nil {
+		l.buckets = map[string]*tokenBucket{}
+	}
+	if now.Sub(l.pruned) > time.Minute {
+		// Forget the clients whose buckets have filled up again
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*l.Rate >= l.Burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.pruned = now
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: l.Burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.Rate
+	if b.tokens > l.Burst {
+		b.tokens = l.Burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -1,15 +1,26 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os/exec"
+	"strings"
 
 	"github.com/brumawen/gopi-finder/src"
 
 	"github.com/gorilla/mux"
 )
 
+var (
+	// ErrLogNotAllowed is returned when a log that has not been configured is requested.
+	ErrLogNotAllowed = errors.New("The log may not be read")
+	// ErrNoJournal is returned when a journal is requested on a system without journalctl.
+	ErrNoJournal = errors.New("The systemd journal is not available on this device")
+)
+
 // LogController handles the Web Methods for reading log records.
 type LogController struct {
 	Srv *Server
@@ -19,25 +30,141 @@ type LogController struct {
 func (c *LogController) AddController(router *mux.Router, s *Server) {
 	c.Srv = s
 	router.Methods("GET").Path("/log/get").Name("GetLogs").
-		Handler(Logger(c, http.HandlerFunc(c.handleGetLogs)))
+		HandlerFunc(c.handleGetLogs)
 }
 
+// handleGetLogs handles the /log/get web method call.
+// The entries are filtered with the unit, since, until, priority, grep and lines query
+// parameters, and written as text or, if format=json, as JSON.  If follow=true, new
+// entries are streamed as they are logged, as server-sent events if the client accepts them.
 func (c *LogController) handleGetLogs(w http.ResponseWriter, r *http.Request) {
-	myInfo, err := gopifinder.NewDeviceInfo()
+	q, err := gopifinder.ParseLogQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "text" && format != "json" {
+		http.Error(w, "Invalid format. Valid formats are text and json", 400)
+		return
+	}
+	src, err := c.Srv.getLogSource(q.Unit)
+	if err != nil {
+		writeError(w, err, err.Error())
+		return
+	}
+
+	if q.Follow {
+		c.followLogs(w, r, src, q, format == "json")
+		return
+	}
+
+	l, err := src.Read(q)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
-	if myInfo.OS != "Linux" {
-		http.Error(w, "Not supported.", 500)
+	if format == "json" {
+		b, err := json.Marshal(l)
+		if err != nil {
+			http.Error(w, "Error serializing log entries. "+err.Error(), 500)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		w.Write(b)
 		return
 	}
-	out, _ := exec.Command("journalctl", "--no-pager", "-u", "SoilMonitor", "-S", "1 hour ago").CombinedOutput()
-	w.Write([]byte(out))
+	w.Header().Set("content-type", "text/plain; charset=utf-8")
+	for _, e := range l {
+		fmt.Fprintln(w, e.Text())
+	}
 }
 
-// LogInfo is used to log information messages for this controller.
-func (c *LogController) LogInfo(v ...interface{}) {
-	a := fmt.Sprint(v)
-	logger.Info("LogController: ", a[1:len(a)-1])
+// followLogs streams the log entries to the client until it disconnects or the server stops.
+func (c *LogController) followLogs(w http.ResponseWriter, r *http.Request, src gopifinder.LogSource, q gopifinder.LogQuery, asJSON bool) {
+	fl, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported.", 500)
+		return
+	}
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	switch {
+	case sse:
+		w.Header().Set("content-type", "text/event-stream")
+		w.Header().Set("cache-control", "no-cache")
+	case asJSON:
+		w.Header().Set("content-type", "application/x-ndjson")
+	default:
+		w.Header().Set("content-type", "text/plain; charset=utf-8")
+	}
+	w.WriteHeader(http.StatusOK)
+	fl.Flush()
+
+	// Shutting down the web server waits for the requests to complete, so the
+	// stream is stopped when the server exits.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.Srv.exit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := src.Follow(ctx, q, func(e gopifinder.LogEntry) error {
+		line := e.Text()
+		if asJSON {
+			b, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			line = string(b)
+		}
+		var err error
+		if sse {
+			_, err = fmt.Fprintf(w, "data: %s\n\n", line)
+		} else {
+			_, err = fmt.Fprintln(w, line)
+		}
+		fl.Flush()
+		return err
+	})
+	if err != nil && ctx.Err() == nil {
+		c.Srv.logDebug("Log stream stopped", append(requestFields(r), gopifinder.ErrField(err))...)
+	}
+}
+
+// getLogSource returns the source of the named log.  Only the server's journal unit
+// and the units and files listed in the configuration may be read.
+func (s *Server) getLogSource(unit string) (gopifinder.LogSource, error) {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	journalUnit := s.JournalUnit
+	if journalUnit == "" {
+		journalUnit = serviceName
+	}
+	if unit == "" {
+		unit = journalUnit
+	}
+	if fn, ok := s.LogFiles[unit]; ok {
+		return &gopifinder.FileSource{Unit: unit, Path: fn}, nil
+	}
+	if unit != journalUnit && !inList(unit, s.LogUnits) {
+		return nil, ErrLogNotAllowed
+	}
+	if _, err := exec.LookPath("journalctl"); err != nil {
+		return nil, ErrNoJournal
+	}
+	return &gopifinder.JournalSource{Unit: unit}, nil
+}
+
+// inList returns whether or not the value is in the list.
+func inList(v string, l []string) bool {
+	for _, i := range l {
+		if i == v {
+			return true
+		}
+	}
+	return false
 }
@@ -2,14 +2,81 @@ package main
 
 import (
 	"net/http"
+	"os"
 	"time"
+
+	"github.com/brumawen/gopi-finder/src"
 )
 
-// Logger will create a Logger Handler wrapper for the specified handler.
-func Logger(c Controller, inner http.Handler) http.Handler {
+// quietRoutes are called every few seconds, so their requests are logged at debug level.
+var quietRoutes = map[string]bool{
+	"GossipPing":       true,
+	"GossipPingReq":    true,
+	"Metrics":          true,
+	"ServiceDiscovery": true,
+	"SyncReplica":      true,
+}
+
+// LogRequests is a router middleware that logs each request, along with the route
+// that handled it, the client's IP address and the response status.
+func (s *Server) LogRequests(inner http.Handler) http.Handler {
+	log := s.getLog("http")
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		inner.ServeHTTP(w, r)
-		c.LogInfo(r.Method, r.RequestURI, "from", r.RemoteAddr, "took", time.Since(start))
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		inner.ServeHTTP(rec, r)
+		route := routeName(r)
+		level := gopifinder.LevelInfo
+		if quietRoutes[route] {
+			level = gopifinder.LevelDebug
+		}
+		log.Log(level, "Handled request",
+			gopifinder.Field("route", route),
+			gopifinder.Field("method", r.Method),
+			gopifinder.Field("uri", r.RequestURI),
+			gopifinder.Field("remoteIP", clientIP(r)),
+			gopifinder.Field("status", rec.status),
+			gopifinder.Field("duration", time.Since(start)))
 	})
 }
+
+// fallbackLog is used by servers that have no Log, and writes to standard error.
+var fallbackLog = gopifinder.NewLogger(gopifinder.NewWriterSink(os.Stderr, gopifinder.LogFormatText), gopifinder.NewLogLevels(gopifinder.LevelInfo))
+
+// getLog returns the logger for the named component of the server.
+func (s *Server) getLog(component string) *gopifinder.Logger {
+	if s.Log == nil {
+		return fallbackLog.Named(component)
+	}
+	return s.Log.Named(component)
+}
+
+func (s *Server) logDebug(msg string, fields ...gopifinder.LogField) {
+	s.getLog("server").Debug(msg, fields...)
+}
+
+func (s *Server) logInfo(msg string, fields ...gopifinder.LogField) {
+	s.getLog("server").Info(msg, fields...)
+}
+
+func (s *Server) logWarn(msg string, fields ...gopifinder.LogField) {
+	s.getLog("server").Warn(msg, fields...)
+}
+
+func (s *Server) logError(msg string, fields ...gopifinder.LogField) {
+	s.getLog("server").Error(msg, fields...)
+}
+
+// deviceFields returns the log fields identifying a device.
+func deviceFields(d gopifinder.DeviceInfo) []gopifinder.LogField {
+	return []gopifinder.LogField{gopifinder.Field("host", d.HostName), gopifinder.Field("machineID", d.MachineID)}
+}
+
+// requestFields returns the log fields identifying a request.
+func requestFields(r *http.Request) []gopifinder.LogField {
+	return []gopifinder.LogField{
+		gopifinder.Field("method", r.Method),
+		gopifinder.Field("uri", r.RequestURI),
+		gopifinder.Field("remoteIP", clientIP(r)),
+	}
+}
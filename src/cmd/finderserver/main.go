@@ -1,34 +1,39 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"log"
+	"os"
 	"strings"
 
+	"github.com/brumawen/gopi-finder/src"
+
 	"github.com/kardianos/service"
 )
 
 var logger service.Logger
 
 func main() {
-	port := flag.Int("p", 20502, "Port Number to listen on.")
-	timeout := flag.Int("t", 5, "Timeout in seconds to wait for a response from a IP probe.")
-	svcFlag := flag.String("service", "", "Service action.  Valid actions are: 'start', 'stop', 'restart', 'instal' and 'uninstall'")
-	flag.Parse()
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+	c, opts, err := loadConfig(os.Args[1:], wd)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Create a new server
-	s := &Server{
-		PortNo:  *port,
-		Timeout: *timeout,
-	}
+	s := NewServer(c)
 
 	// Create the service
 	svcConfig := &service.Config{
-		Name:        "FinderService",
+		Name:        serviceName,
 		DisplayName: "Finder Service",
 		Description: "Finds and registerd devices and micro-services on the local LAN.",
 	}
+	// The installed service reads the same configuration file and flags
+	svcConfig.Arguments = c.ServiceArgs()
 	v, err := service.New(s, svcConfig)
 	if err != nil {
 		log.Fatal(err)
@@ -49,20 +54,29 @@ func main() {
 		}
 	}()
 
-	if *svcFlag != "" {
+	if opts.Service != "" {
 		// Service control request
-		if err := service.Control(v, *svcFlag); err != nil {
+		if l := EnvSettings(os.Getenv); opts.Service == "install" && len(l) != 0 {
+			fmt.Println("Warning: the installed service does not keep the environment variables", strings.Join(l, ", ")+".",
+				"Set them in the service's environment or use flags or a configuration file instead.")
+		}
+		if err := service.Control(v, opts.Service); err != nil {
 			e := err.Error()
 			if strings.Contains(e, "Unknown action") {
-				fmt.Println(*svcFlag, "is an invalid action.")
+				fmt.Println(opts.Service, "is an invalid action.")
 				fmt.Println("Valid actions are", service.ControlAction)
 			} else {
 				fmt.Println(err.Error())
 			}
 		}
 	} else {
-		// Start the service in debug if we are running in a terminal
-		s.VerboseLogging = service.Interactive()
+		// Log verbosely if we are running in a terminal
+		levels, err := c.logLevels(service.Interactive())
+		if err != nil {
+			log.Fatal(err)
+		}
+		s.LogLevels = levels
+		s.Log = gopifinder.NewLogger(gopifinder.NewServiceSink(logger, c.Logging.Format), s.LogLevels)
 		if err := v.Run(); err != nil {
 			log.Fatal(err)
 		}
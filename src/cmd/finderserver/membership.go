@@ -0,0 +1,402 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+const (
+	maxPiggyback    = 8         // Maximum number of membership updates piggybacked on a message
+	retransmitMult  = 3         // Multiplier for the number of times an update is piggybacked
+	deadMemberTTL   = time.Hour // How long dead members are remembered
+	defaultIndirect = 3         // Default number of members asked to perform an indirect probe
+)
+
+// memberEntry holds a member along with the time its state last changed.
+type memberEntry struct {
+	gopifinder.Member
+	changed time.Time
+}
+
+// gossipUpdate holds a membership update waiting to be piggybacked on messages.
+type gossipUpdate struct {
+	member    gopifinder.Member
+	transmits int
+}
+
+// Membership implements a SWIM style gossip failure detector.
+// Each protocol period a member is probed directly and, if it does not respond,
+// indirectly through other members.  A member that fails both probes is suspected,
+// and is declared dead if it does not refute the suspicion within the suspect timeout.
+// Membership changes are piggybacked on the probe messages.
+type Membership struct {
+	Srv            *Server
+	ProbeInterval  time.Duration // The protocol period between probes
+	ProbeTimeout   time.Duration // The time to wait for a direct probe to be acknowledged
+	SuspectTimeout time.Duration // The time a suspect member has to refute the suspicion
+	IndirectProbes int           // The number of members asked to perform an indirect probe
+	mu             sync.Mutex
+	incarnation    int64
+	members        map[string]*memberEntry
+	updates        []*gossipUpdate
+	probeList      []string
+	probeIdx       int
+}
+
+// NewMembership creates an empty membership list for the server, with the
+// default probe timings, which is ready to handle messages from other members.
+func NewMembership(srv *Server) *Membership {
+	return &Membership{
+		Srv:            srv,
+		ProbeInterval:  time.Second,
+		ProbeTimeout:   time.Second / 2,
+		SuspectTimeout: 5 * time.Second,
+		IndirectProbes: defaultIndirect,
+		members:        map[string]*memberEntry{},
+	}
+}
+
+// Start starts the probe loop.  The loop runs until the exit channel is closed.
+func (m *Membership) Start(exit chan struct{}) {
+	m.mu.Lock()
+	// Use the current time so a restarted server always has a higher incarnation
+	m.incarnation = time.Now().UnixNano()
+	m.queueUpdate(m.self())
+	m.mu.Unlock()
+
+	go func() {
+		t := time.NewTicker(m.ProbeInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-exit:
+				return
+			case <-t.C:
+				m.checkSuspects()
+				m.probeNext()
+			}
+		}
+	}()
+}
+
+// Members returns the current membership list, including this server.
+func (m *Membership) Members() []gopifinder.Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := []gopifinder.Member{m.self()}
+	for _, e := range m.members {
+		l = append(l, e.Member)
+	}
+	return l
+}
+
+// IsDead returns whether or not the member with the specified MachineID has been declared dead.
+func (m *Membership) IsDead(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.members[id]
+	return ok && e.State == gopifinder.MemberDead
+}
+
+// Observe adds the device to the membership list if it is not already known.
+// If direct is true, the device has been in contact with this server, which
+// revives it if it had been declared dead.
+func (m *Membership) Observe(d gopifinder.DeviceInfo, direct bool) {
+	if d.MachineID == "" || d.MachineID == m.Srv.myMachineID() {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.members[d.MachineID]
+	if !ok {
+		m.members[d.MachineID] = &memberEntry{
+			Member:  gopifinder.Member{Device: d, State: gopifinder.MemberAlive},
+			changed: time.Now(),
+		}
+		return
+	}
+	e.Device = d
+	if direct && e.State != gopifinder.MemberAlive {
+		m.setState(e, gopifinder.MemberAlive, e.Incarnation)
+	}
+}
+
+// Remove declares the member with the specified MachineID dead and gossips the change.
+func (m *Membership) Remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.members[id]; ok && e.State != gopifinder.MemberDead {
+		m.setState(e, gopifinder.MemberDead, e.Incarnation)
+	}
+}
+
+// HandlePing processes a direct probe and returns the acknowledgement.
+func (m *Membership) HandlePing(msg gopifinder.GossipMessage) gopifinder.GossipMessage {
+	m.handleMessage(msg)
+	return m.newMessage()
+}
+
+// HandlePingReq probes the message Target on behalf of the sender.
+// Returns the acknowledgement and true if the Target responded.
+func (m *Membership) HandlePingReq(msg gopifinder.GossipMessage) (gopifinder.GossipMessage, bool) {
+	m.handleMessage(msg)
+	if msg.Target == nil {
+		return gopifinder.GossipMessage{}, false
+	}
+	ack, err := m.Srv.Finder.SendPing(*msg.Target, m.newMessage(), m.ProbeTimeout)
+	if err != nil {
+		return gopifinder.GossipMessage{}, false
+	}
+	m.handleMessage(ack)
+	return m.newMessage(), true
+}
+
+// probeNext probes the next member in the probe list.
+func (m *Membership) probeNext() {
+	target, ok := m.nextTarget()
+	if !ok {
+		return
+	}
+	ack, err := m.Srv.Finder.SendPing(target.Device, m.newMessage(), m.ProbeTimeout)
+	if err == nil {
+		m.handleMessage(ack)
+		return
+	}
+	m.log().Debug("Direct probe failed", append(deviceFields(target.Device), gopifinder.ErrField(err))...)
+
+	// Ask other members to probe the target
+	helpers := m.randomMembers(m.IndirectProbes, target.Device.MachineID)
+	if len(helpers) != 0 {
+		msg := m.newMessage()
+		msg.Target = &target.Device
+		c := make(chan bool, len(helpers))
+		for _, h := range helpers {
+			go func(h gopifinder.Member) {
+				ack, err := m.Srv.Finder.SendPingReq(h.Device, msg, m.ProbeInterval)
+				if err == nil {
+					m.handleMessage(ack)
+				}
+				c <- err == nil
+			}(h)
+		}
+		for range helpers {
+			if <-c {
+				return
+			}
+		}
+	}
+
+	// No one could reach the target
+	m.mu.Lock()
+	if e, ok := m.members[target.Device.MachineID]; ok && e.State == gopifinder.MemberAlive {
+		m.setState(e, gopifinder.MemberSuspect, e.Incarnation)
+	}
+	m.mu.Unlock()
+}
+
+// nextTarget returns the next member to probe.  The probe list is walked in a
+// random order which is reshuffled each time the end of the list is reached.
+func (m *Membership) nextTarget() (gopifinder.Member, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for tries := 0; tries <= len(m.probeList); tries++ {
+		if m.probeIdx >= len(m.probeList) {
+			m.probeList = m.probeList[:0]
+			for id, e := range m.members {
+				if e.State != gopifinder.MemberDead {
+					m.probeList = append(m.probeList, id)
+				}
+			}
+			rand.Shuffle(len(m.probeList), func(i, j int) {
+				m.probeList[i], m.probeList[j] = m.probeList[j], m.probeList[i]
+			})
+			m.probeIdx = 0
+			if len(m.probeList) == 0 {
+				return gopifinder.Member{}, false
+			}
+		}
+		id := m.probeList[m.probeIdx]
+		m.probeIdx++
+		if e, ok := m.members[id]; ok && e.State != gopifinder.MemberDead {
+			return e.Member, true
+		}
+	}
+	return gopifinder.Member{}, false
+}
+
+// randomMembers returns up to n random live members, excluding the specified member.
+func (m *Membership) randomMembers(n int, exclude string) []gopifinder.Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := []gopifinder.Member{}
+	for id, e := range m.members {
+		if id != exclude && e.State == gopifinder.MemberAlive {
+			l = append(l, e.Member)
+		}
+	}
+	rand.Shuffle(len(l), func(i, j int) { l[i], l[j] = l[j], l[i] })
+	if len(l) > n {
+		l = l[:n]
+	}
+	return l
+}
+
+// checkSuspects declares dead any suspect member whose suspect timeout has expired
+// and forgets dead members once they have been dead for long enough.
+func (m *Membership) checkSuspects() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, e := range m.members {
+		switch {
+		case e.State == gopifinder.MemberSuspect && time.Since(e.changed) > m.SuspectTimeout:
+			m.setState(e, gopifinder.MemberDead, e.Incarnation)
+		case e.State == gopifinder.MemberDead && time.Since(e.changed) > deadMemberTTL:
+			delete(m.members, id)
+		}
+	}
+}
+
+// handleMessage applies the sender and the piggybacked updates in the message.
+func (m *Membership) handleMessage(msg gopifinder.GossipMessage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if msg.From.Device.MachineID != "" {
+		// The sender is alive
+		from := msg.From
+		from.State = gopifinder.MemberAlive
+		m.applyUpdate(from)
+	}
+	for _, u := range msg.Updates {
+		m.applyUpdate(u)
+	}
+}
+
+// applyUpdate applies a membership update using the SWIM precedence rules.
+// The caller must hold the lock.
+func (m *Membership) applyUpdate(u gopifinder.Member) {
+	id := u.Device.MachineID
+	if id == "" || !u.Device.InCluster(m.Srv.Clusters) {
+		return
+	}
+	if id == m.Srv.myMachineID() {
+		if u.State != gopifinder.MemberAlive && u.Incarnation >= m.incarnation {
+			// Refute the suspicion
+			m.incarnation = u.Incarnation + 1
+			m.queueUpdate(m.self())
+		}
+		return
+	}
+
+	e, ok := m.members[id]
+	if !ok {
+		if u.State == gopifinder.MemberDead {
+			return
+		}
+		m.members[id] = &memberEntry{Member: u, changed: time.Now()}
+		m.queueUpdate(u)
+		m.log().Info("Member joined", append(deviceFields(u.Device), gopifinder.Field("state", u.State))...)
+		go m.Srv.addMemberDevice(u.Device)
+		return
+	}
+	switch u.State {
+	case gopifinder.MemberAlive:
+		if u.Incarnation > e.Incarnation {
+			e.Device = u.Device
+			m.setState(e, gopifinder.MemberAlive, u.Incarnation)
+		}
+	case gopifinder.MemberSuspect:
+		if (e.State == gopifinder.MemberAlive && u.Incarnation >= e.Incarnation) ||
+			(e.State == gopifinder.MemberSuspect && u.Incarnation > e.Incarnation) {
+			m.setState(e, gopifinder.MemberSuspect, u.Incarnation)
+		}
+	case gopifinder.MemberDead:
+		if e.State != gopifinder.MemberDead && u.Incarnation >= e.Incarnation {
+			m.setState(e, gopifinder.MemberDead, u.Incarnation)
+		}
+	}
+}
+
+// setState changes the state of the member, queues the change to be gossiped
+// and updates the server's device lists.
+// The caller must hold the lock.
+func (m *Membership) setState(e *memberEntry, state gopifinder.MemberState, incarnation int64) {
+	changed := e.State != state
+	e.State = state
+	e.Incarnation = incarnation
+	e.changed = time.Now()
+	m.queueUpdate(e.Member)
+	if !changed {
+		return
+	}
+	m.log().Info("Member state changed", append(deviceFields(e.Device), gopifinder.Field("state", state))...)
+
+	d := e.Device
+	switch state {
+	case gopifinder.MemberAlive:
+		go m.Srv.addMemberDevice(d)
+	case gopifinder.MemberDead:
+		go m.Srv.dropMemberDevice(d.MachineID)
+	}
+}
+
+// queueUpdate queues the membership update to be piggybacked on messages,
+// replacing any update already queued for the same member.
+// The caller must hold the lock.
+func (m *Membership) queueUpdate(u gopifinder.Member) {
+	for n, i := range m.updates {
+		if i.member.Device.MachineID == u.Device.MachineID {
+			m.updates = append(m.updates[:n], m.updates[n+1:]...)
+			break
+		}
+	}
+	m.updates = append(m.updates, &gossipUpdate{member: u})
+}
+
+// newMessage creates a new gossip message with the updates that have been
+// transmitted the least piggybacked on it.
+func (m *Membership) newMessage() gopifinder.GossipMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msg := gopifinder.GossipMessage{From: m.self(), Updates: []gopifinder.Member{}}
+
+	// Each update is transmitted a multiple of log(n) times
+	limit := retransmitMult * int(math.Ceil(math.Log2(float64(len(m.members)+2))))
+	sort.SliceStable(m.updates, func(i, j int) bool {
+		return m.updates[i].transmits < m.updates[j].transmits
+	})
+	for _, u := range m.updates {
+		if len(msg.Updates) >= maxPiggyback {
+			break
+		}
+		msg.Updates = append(msg.Updates, u.member)
+		u.transmits++
+	}
+	l := m.updates[:0]
+	for _, u := range m.updates {
+		if u.transmits < limit {
+			l = append(l, u)
+		}
+	}
+	m.updates = l
+	return msg
+}
+
+// self returns the member information for this server.
+// The caller must hold the lock.
+func (m *Membership) self() gopifinder.Member {
+	d := gopifinder.DeviceInfo{}
+	if m.Srv.Finder != nil && m.Srv.Finder.MyInfo != nil {
+		d = *m.Srv.Finder.MyInfo
+	}
+	return gopifinder.Member{Device: d, State: gopifinder.MemberAlive, Incarnation: m.incarnation}
+}
+
+// log returns the logger for the membership list.
+func (m *Membership) log() *gopifinder.Logger {
+	return m.Srv.getLog("gossip")
+}
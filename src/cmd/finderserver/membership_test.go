@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+// newTestMembership returns the membership list of a test server.
+func newTestMembership() *Membership {
+	m := NewMembership(newTestServer())
+	m.ProbeTimeout = 100 * time.Millisecond
+	m.SuspectTimeout = 10 * time.Millisecond
+	m.incarnation = 1
+	m.Srv.Members = m
+	return m
+}
+
+func member(id string, state gopifinder.MemberState, incarnation int64) gopifinder.Member {
+	return gopifinder.Member{Device: gopifinder.DeviceInfo{MachineID: id, HostName: id, IPAddress: []string{"127.0.0.1"}}, State: state, Incarnation: incarnation}
+}
+
+func stateOf(m *Membership, id string) gopifinder.MemberState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.members[id].State
+}
+
+func TestUnreachableMemberIsSuspectedThenDeclaredDead(t *testing.T) {
+	m := newTestMembership()
+	// A closed server refuses the connection
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+	d := newTestDevice(t, "peer", ts.URL)
+	m.Observe(d, true)
+	m.Srv.addDevice(d)
+
+	m.probeNext()
+	if s := stateOf(m, "peer"); s != gopifinder.MemberSuspect {
+		t.Fatal("Expected the member to be suspect, got", s)
+	}
+
+	time.Sleep(2 * m.SuspectTimeout)
+	m.checkSuspects()
+	if s := stateOf(m, "peer"); s != gopifinder.MemberDead {
+		t.Fatal("Expected the member to be dead, got", s)
+	}
+	if !m.IsDead("peer") {
+		t.Error("Expected IsDead to report the dead member")
+	}
+	// The dead member is dropped from the server's device list
+	for i := 0; i < 100 && len(m.Srv.getPeers()) != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if l := m.Srv.getPeers(); len(l) != 0 {
+		t.Error("Expected the dead member to be removed from the devices, got", l)
+	}
+}
+
+func TestMemberRefutesSuspicion(t *testing.T) {
+	m := newTestMembership()
+	self := m.Members()[0]
+	self.State = gopifinder.MemberSuspect
+	self.Incarnation = 5
+	m.handleMessage(gopifinder.GossipMessage{Updates: []gopifinder.Member{self}})
+
+	msg := m.newMessage()
+	if msg.From.State != gopifinder.MemberAlive || msg.From.Incarnation != 6 {
+		t.Fatal("Expected the server to stay alive with incarnation 6, got", msg.From)
+	}
+	found := false
+	for _, u := range msg.Updates {
+		if u.Device.MachineID == "self" {
+			found = u.State == gopifinder.MemberAlive && u.Incarnation == 6
+		}
+	}
+	if !found {
+		t.Error("Expected the refutation to be gossiped, got", msg.Updates)
+	}
+
+	// A suspicion about an older incarnation is ignored
+	self.Incarnation = 3
+	m.handleMessage(gopifinder.GossipMessage{Updates: []gopifinder.Member{self}})
+	if msg := m.newMessage(); msg.From.Incarnation != 6 {
+		t.Error("Expected the incarnation to stay at 6, got", msg.From.Incarnation)
+	}
+}
+
+func TestUpdatesFollowIncarnationPrecedence(t *testing.T) {
+	m := newTestMembership()
+	apply := func(u gopifinder.Member) {
+		m.mu.Lock()
+		m.applyUpdate(u)
+		m.mu.Unlock()
+	}
+
+	apply(member("peer", gopifinder.MemberAlive, 5))
+	for _, tc := range []struct {
+		update gopifinder.Member
+		want   gopifinder.MemberState
+	}{
+		{member("peer", gopifinder.MemberSuspect, 4), gopifinder.MemberAlive},   // Older suspicion is ignored
+		{member("peer", gopifinder.MemberSuspect, 5), gopifinder.MemberSuspect}, // Suspicion of the same incarnation
+		{member("peer", gopifinder.MemberAlive, 5), gopifinder.MemberSuspect},   // Alive needs a higher incarnation
+		{member("peer", gopifinder.MemberAlive, 6), gopifinder.MemberAlive},     // Refuted by the member
+		{member("peer", gopifinder.MemberDead, 5), gopifinder.MemberAlive},      // Older death is ignored
+		{member("peer", gopifinder.MemberDead, 6), gopifinder.MemberDead},
+		{member("peer", gopifinder.MemberAlive, 6), gopifinder.MemberDead}, // Revival needs a higher incarnation
+		{member("peer", gopifinder.MemberAlive, 7), gopifinder.MemberAlive},
+	} {
+		apply(tc.update)
+		if s := stateOf(m, "peer"); s != tc.want {
+			t.Errorf("After %s at incarnation %d, got %s, want %s", tc.update.State, tc.update.Incarnation, s, tc.want)
+		}
+	}
+
+	// Unknown members are not added by a death notice
+	apply(member("gone", gopifinder.MemberDead, 1))
+	m.mu.Lock()
+	_, ok := m.members["gone"]
+	m.mu.Unlock()
+	if ok {
+		t.Error("Expected a dead unknown member to be ignored")
+	}
+}
+
+func TestPingIsHandledBeforeTheProbeLoopStarts(t *testing.T) {
+	s := newTestServer()
+	s.Members = NewMembership(s)
+	c := GossipController{Srv: s}
+
+	body, _ := json.Marshal(gopifinder.GossipMessage{From: member("peer", gopifinder.MemberAlive, 1)})
+	w := httptest.NewRecorder()
+	c.handlePing(w, httptest.NewRequest("POST", "/gossip/ping", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatal("Expected the ping to be acknowledged, got", w.Code, w.Body.String())
+	}
+	if s := stateOf(s.Members, "peer"); s != gopifinder.MemberAlive {
+		t.Error("Expected the sender to be added as alive, got", s)
+	}
+	if s.Members.ProbeTimeout <= 0 {
+		t.Error("Expected a probe timeout for indirect probes, got", s.Members.ProbeTimeout)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Default histogram bucket upper bounds, in seconds.
+var (
+	latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	lagBuckets     = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+	scanBuckets    = []float64{1, 2, 5, 10, 20, 30, 60, 120}
+)
+
+// Metrics collects the counters and histograms reported on the /metrics endpoint.
+type Metrics struct {
+	mu          sync.Mutex
+	requests    map[requestKey]int64  // Request count for each route, method and status code
+	latency     map[string]*histogram // Request latency for each route
+	scans       map[string]int64      // Network scan count for each outcome
+	scanTime    *histogram            // Network scan duration
+	lastScan    time.Time             // The date and time the last network scan completed
+	syncs       map[string]int64      // Registry sync count for each outcome
+	replicated  int64                 // Number of replicated registrations applied
+	replication *histogram            // Time between a registration changing on its origin server and being applied here
+}
+
+type requestKey struct {
+	route  string
+	method string
+	code   int
+}
+
+// Instrument is a router middleware that counts the requests and measures their
+// latency, labelled with the name of the route that handled them.
+func (s *Server) Instrument(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		inner.ServeHTTP(rec, r)
+		s.metrics.ObserveRequest(routeName(r), r.Method, rec.status, time.Since(start))
+	})
+}
+
+// routeName returns the name of the route that matched the request.
+func routeName(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil && route.GetName() != "" {
+		return route.GetName()
+	}
+	return "unknown"
+}
+
+// ObserveRequest records a request handled by the named route.
+func (m *Metrics) ObserveRequest(route string, method string, code int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.requests == nil {
+		m.requests = map[requestKey]int64{}
+		m.latency = map[string]*histogram{}
+	}
+	m.requests[requestKey{route: route, method: method, code: code}]++
+	h, ok := m.latency[route]
+	if !ok {
+		h = newHistogram(latencyBuckets)
+		m.latency[route] = h
+	}
+	h.Observe(d.Seconds())
+}
+
+// ObserveScan records the duration and outcome of a network scan.
+func (m *Metrics) ObserveScan(d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.scans == nil {
+		m.scans = map[string]int64{}
+		m.scanTime = newHistogram(scanBuckets)
+	}
+	m.scans[outcome(err)]++
+	m.scanTime.Observe(d.Seconds())
+	m.lastScan = time.Now()
+}
+
+// ObserveSync records the outcome of a registry sync with a peer.
+func (m *Metrics) ObserveSync(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.syncs == nil {
+		m.syncs = map[string]int64{}
+	}
+	m.syncs[outcome(err)]++
+}
+
+// ObserveReplication records a replicated registration that was applied.
+// The lag is measured from the time the registration changed on its origin server.
+func (m *Metrics) ObserveReplication(updated time.Time) {
+	if updated.IsZero() {
+		return
+	}
+	lag := time.Since(updated).Seconds()
+	if lag < 0 {
+		// The origin server's clock is ahead of ours
+		lag = 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.replication == nil {
+		m.replication = newHistogram(lagBuckets)
+	}
+	m.replicated++
+	m.replication.Observe(lag)
+}
+
+// WriteText writes the collected metrics in the Prometheus text format.
+func (m *Metrics) WriteText(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeHeader(w, "finder_http_requests_total", "counter", "Number of HTTP requests handled, by route, method and status code.")
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "finder_http_requests_total{route=%s,method=%s,code=\"%d\"} %d\n",
+			quoteLabel(k.route), quoteLabel(k.method), k.code, m.requests[k])
+	}
+
+	writeHeader(w, "finder_http_request_duration_seconds", "histogram", "Latency of the HTTP requests handled, by route.")
+	routes := make([]string, 0, len(m.latency))
+	for route := range m.latency {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		m.latency[route].WriteText(w, "finder_http_request_duration_seconds", "route="+quoteLabel(route))
+	}
+
+	writeHeader(w, "finder_scans_total", "counter", "Number of network device scans, by outcome.")
+	for _, o := range sortedKeys(m.scans) {
+		fmt.Fprintf(w, "finder_scans_total{outcome=%s} %d\n", quoteLabel(o), m.scans[o])
+	}
+	if m.scanTime != nil {
+		writeHeader(w, "finder_scan_duration_seconds", "histogram", "Duration of the network device scans.")
+		m.scanTime.WriteText(w, "finder_scan_duration_seconds", "")
+		writeHeader(w, "finder_last_scan_timestamp_seconds", "gauge", "Unix time the last network device scan completed.")
+		fmt.Fprintf(w, "finder_last_scan_timestamp_seconds %d\n", m.lastScan.Unix())
+	}
+
+	writeHeader(w, "finder_registry_syncs_total", "counter", "Number of registry syncs with a peer, by outcome.")
+	for _, o := range sortedKeys(m.syncs) {
+		fmt.Fprintf(w, "finder_registry_syncs_total{outcome=%s} %d\n", quoteLabel(o), m.syncs[o])
+	}
+
+	writeHeader(w, "finder_replicated_registrations_total", "counter", "Number of replicated service registrations applied.")
+	fmt.Fprintf(w, "finder_replicated_registrations_total %d\n", m.replicated)
+	if m.replication != nil {
+		writeHeader(w, "finder_replication_lag_seconds", "histogram", "Time between a registration changing on its origin server and being applied here.")
+		m.replication.WriteText(w, "finder_replication_lag_seconds", "")
+	}
+}
+
+// statusRecorder records the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Flush passes flushes through to the wrapped writer, so that streamed responses still work.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// histogram counts observations in cumulative buckets, as used by Prometheus.
+type histogram struct {
+	bounds []float64
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]int64, len(bounds))}
+}
+
+// Observe adds the value to the histogram.
+func (h *histogram) Observe(v float64) {
+	for n, b := range h.bounds {
+		if v <= b {
+			h.counts[n]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// WriteText writes the histogram samples with the specified labels.
+func (h *histogram) WriteText(w io.Writer, name string, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	for n, b := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, strconv.FormatFloat(b, 'g', -1, 64), h.counts[n])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric.
+func writeHeader(w io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeGauge writes a metric with a single value.
+func writeGauge(w io.Writer, name string, help string, v int64) {
+	writeHeader(w, name, "gauge", help)
+	fmt.Fprintf(w, "%s %d\n", name, v)
+}
+
+// writeFloatGauge writes a metric with a single floating point value.
+func writeFloatGauge(w io.Writer, name string, help string, v float64) {
+	writeHeader(w, name, "gauge", help)
+	fmt.Fprintf(w, "%s %s\n", name, strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+// quoteLabel returns the label value quoted and escaped for the Prometheus text format.
+func quoteLabel(v string) string {
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, `"`, `\"`, -1)
+	v = strings.Replace(v, "\n", `\n`, -1)
+	return `"` + v + `"`
+}
+
+// outcome returns the outcome label for an operation that returned the error.
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys(m map[string]int64) []string {
+	l := make([]string, 0, len(m))
+	for k := range m {
+		l = append(l, k)
+	}
+	sort.Strings(l)
+	return l
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+// sample is a single line of the Prometheus text format.
+type sample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// parseMetrics parses the Prometheus text format, checking that every sample
+// follows the HELP and TYPE lines of its metric.
+func parseMetrics(t *testing.T, text string) ([]sample, map[string]string) {
+	types := map[string]string{}
+	help := map[string]bool{}
+	l := []sample{}
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if strings.HasPrefix(line, "# HELP ") {
+			f := strings.SplitN(line[7:], " ", 2)
+			if len(f) != 2 || f[1] == "" {
+				t.Fatalf("HELP line has no text: %q", line)
+			}
+			help[f[0]] = true
+			continue
+		}
+		if strings.HasPrefix(line, "# TYPE ") {
+			f := strings.Fields(line[7:])
+			if len(f) != 2 || !help[f[0]] {
+				t.Fatalf("TYPE line must follow the HELP line: %q", line)
+			}
+			types[f[0]] = f[1]
+			continue
+		}
+		s, err := parseSample(line)
+		if err != nil {
+			t.Fatalf("Invalid sample %q. %s", line, err.Error())
+		}
+		family := s.name
+		if _, ok := types[family]; !ok {
+			for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+				if strings.HasSuffix(family, suffix) && types[strings.TrimSuffix(family, suffix)] == "histogram" {
+					family = strings.TrimSuffix(family, suffix)
+				}
+			}
+		}
+		if _, ok := types[family]; !ok {
+			t.Fatalf("Sample %q has no TYPE line", line)
+		}
+		l = append(l, s)
+	}
+	return l, types
+}
+
+// parseSample parses a sample line, unescaping its label values.
+func parseSample(line string) (sample, error) {
+	s := sample{labels: map[string]string{}}
+	sp := strings.LastIndex(line, " ")
+	if sp < 0 {
+		return s, errors.New("No value")
+	}
+	v, err := strconv.ParseFloat(line[sp+1:], 64)
+	if err != nil {
+		return s, err
+	}
+	s.value = v
+	line = line[:sp]
+	br := strings.Index(line, "{")
+	if br < 0 {
+		s.name = line
+		return s, nil
+	}
+	if !strings.HasSuffix(line, "}") {
+		return s, errors.New("Unterminated labels")
+	}
+	s.name = line[:br]
+	rest := line[br+1 : len(line)-1]
+	for rest != "" {
+		eq := strings.Index(rest, `="`)
+		if eq < 0 {
+			return s, errors.New("Label has no quoted value")
+		}
+		name := rest[:eq]
+		rest = rest[eq+2:]
+		b := strings.Builder{}
+		n := 0
+		for ; n < len(rest) && rest[n] != '"'; n++ {
+			if rest[n] == '\\' {
+				n++
+				if n == len(rest) {
+					return s, errors.New("Unterminated escape")
+				}
+				switch rest[n] {
+				case 'n':
+					b.WriteByte('\n')
+				case '\\', '"':
+					b.WriteByte(rest[n])
+				default:
+					return s, errors.New("Invalid escape")
+				}
+				continue
+			}
+			if rest[n] == '\n' {
+				return s, errors.New("Unescaped new line")
+			}
+			b.WriteByte(rest[n])
+		}
+		if n == len(rest) {
+			return s, errors.New("Unterminated label value")
+		}
+		s.labels[name] = b.String()
+		rest = strings.TrimPrefix(rest[n+1:], ",")
+	}
+	return s, nil
+}
+
+func TestMetricsTextFormat(t *testing.T) {
+	route := "odd \"route\"\\name\nline"
+	m := Metrics{}
+	for _, d := range []time.Duration{2 * time.Millisecond, 20 * time.Millisecond, 20 * time.Millisecond, 3 * time.Second, time.Minute} {
+		m.ObserveRequest(route, "GET", 200, d)
+	}
+	m.ObserveScan(3*time.Second, nil)
+	m.ObserveReplication(time.Now().Add(-2 * time.Second))
+
+	b := new(bytes.Buffer)
+	m.WriteText(b)
+	l, types := parseMetrics(t, b.String())
+
+	if types["finder_http_request_duration_seconds"] != "histogram" || types["finder_http_requests_total"] != "counter" {
+		t.Errorf("Unexpected metric types %v", types)
+	}
+
+	found := false
+	for _, s := range l {
+		if s.name == "finder_http_requests_total" {
+			found = true
+			if s.labels["route"] != route || s.labels["code"] != "200" || s.value != 5 {
+				t.Errorf("Expected the escaped route to read back, got %v", s)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected a request count")
+	}
+
+	for _, name := range []string{"finder_http_request_duration_seconds", "finder_scan_duration_seconds", "finder_replication_lag_seconds"} {
+		last := 0.0
+		bound := 0.0
+		buckets := 0
+		count := -1.0
+		for _, s := range l {
+			switch s.name {
+			case name + "_bucket":
+				le := s.labels["le"]
+				ub, err := strconv.ParseFloat(le, 64)
+				if le == "+Inf" {
+					ub, err = bound+1, nil
+				}
+				if err != nil || ub <= bound && buckets != 0 {
+					t.Errorf("%s: bucket bounds must increase, got le=%q", name, le)
+				}
+				if s.value < last {
+					t.Errorf("%s: bucket counts must be cumulative, got %g after %g", name, s.value, last)
+				}
+				bound, last = ub, s.value
+				buckets++
+			case name + "_count":
+				count = s.value
+			}
+		}
+		if buckets == 0 || count != last {
+			t.Errorf("%s: expected the +Inf bucket %g to equal the count %g", name, last, count)
+		}
+	}
+
+	// 2ms, 20ms and 20ms are within 25ms, and 3s is within 5s
+	for _, s := range l {
+		if s.name != "finder_http_request_duration_seconds_bucket" {
+			continue
+		}
+		want := map[string]float64{"0.001": 0, "0.025": 3, "5": 4, "+Inf": 5}
+		if v, ok := want[s.labels["le"]]; ok && s.value != v {
+			t.Errorf("Expected le=%s to count %g, got %g", s.labels["le"], v, s.value)
+		}
+	}
+}
+
+func TestMetricsEndpointIsValid(t *testing.T) {
+	s := newTestServer()
+	s.Devices = []gopifinder.DeviceInfo{{MachineID: "pi"}}
+	s.metrics.ObserveRequest("GetDevices", "GET", 200, time.Millisecond)
+	s.status = gopifinder.DeviceStatus{HostName: `pi "one"`, OS: "Linux", HWModel: "Raspberry Pi 4 Model B", HWProcessor: "BCM2711",
+		HWMemory: 4096, HWManufacturer: "Sony UK", DiskUsedPerc: 26, Created: time.Now()}
+	c := MetricsController{Srv: s}
+
+	w := httptest.NewRecorder()
+	c.handleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	l, _ := parseMetrics(t, w.Body.String())
+	for _, i := range l {
+		if i.name == "finder_devices" && i.value != 1 {
+			t.Errorf("Expected 1 device, got %g", i.value)
+		}
+		if i.name == "finder_device_info" && (i.labels["hostname"] != `pi "one"` || i.labels["hw_model"] != "Raspberry Pi 4 Model B" ||
+			i.labels["hw_processor"] != "BCM2711" || i.labels["hw_memory_mb"] != "4096" || i.labels["hw_manufacturer"] != "Sony UK") {
+			t.Errorf("Expected the host name and hardware to read back, got %v", i.labels)
+		}
+		if i.name == "finder_disk_used_ratio" && i.value != 0.26 {
+			t.Errorf("Expected a used ratio of 0.26, got %g", i.value)
+		}
+	}
+}
+
+func TestMetricsLeaveOutFailedCollectors(t *testing.T) {
+	s := newTestServer()
+	s.status = gopifinder.DeviceStatus{OS: "Linux", DiskUsed: 10, Created: time.Now(), Errors: []gopifinder.StatusError{
+		{Collector: "cpu"}, {Collector: "gpu"}, {Collector: "throttling"},
+	}}
+	c := MetricsController{Srv: s}
+
+	w := httptest.NewRecorder()
+	c.handleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	l, _ := parseMetrics(t, w.Body.String())
+	got := map[string]float64{}
+	for _, i := range l {
+		got[i.name] = i.value
+	}
+	for _, name := range []string{"finder_cpu_temperature_celsius", "finder_gpu_temperature_celsius", "finder_throttled_bits", "finder_throttled"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("Expected %s to be left out", name)
+		}
+	}
+	if got["finder_disk_available_bytes"] != 10240 {
+		t.Errorf("Expected 10240 available disk bytes, got %g", got["finder_disk_available_bytes"])
+	}
+}
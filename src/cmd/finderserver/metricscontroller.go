@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/brumawen/gopi-finder/src"
+
+	"github.com/gorilla/mux"
+)
+
+// MetricsController handles the Web Methods used to scrape the server's metrics.
+type MetricsController struct {
+	Srv *Server
+}
+
+// AddController adds the routes associated with the controller to the router.
+func (c *MetricsController) AddController(router *mux.Router, s *Server) {
+	c.Srv = s
+	router.Methods("GET").Path("/metrics").Name("Metrics").
+		HandlerFunc(c.handleMetrics)
+}
+
+// handleMetrics handles the /metrics web method call
+func (c *MetricsController) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	b := new(bytes.Buffer)
+	c.Srv.metrics.WriteText(b)
+	c.Srv.writeRegistryMetrics(b)
+	c.Srv.writeDeviceStatusMetrics(b)
+	w.Header().Set("content-type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(b.Bytes())
+}
+
+// writeRegistryMetrics writes the gauges that are read from the server's state when it is scraped.
+func (s *Server) writeRegistryMetrics(b *bytes.Buffer) {
+	s.mu.RLock()
+	devices, services := len(s.Devices), len(s.Services)
+	removed, removedDevices := len(s.removed), len(s.removedDevices)
+	s.mu.RUnlock()
+	writeGauge(b, "finder_devices", "Number of devices in the registry.", int64(devices))
+	writeGauge(b, "finder_services", "Number of service registrations in the registry.", int64(services))
+	writeGauge(b, "finder_service_tombstones", "Number of removed service registrations remembered.", int64(removed))
+	writeGauge(b, "finder_device_tombstones", "Number of removed devices remembered.", int64(removedDevices))
+
+	if s.Members != nil {
+		counts := map[gopifinder.MemberState]int64{}
+		for _, m := range s.Members.Members() {
+			if m.Device.MachineID != s.myMachineID() {
+				counts[m.State]++
+			}
+		}
+		writeHeader(b, "finder_peers", "gauge", "Number of peers in the gossip membership list, by state.")
+		for _, st := range []gopifinder.MemberState{gopifinder.MemberAlive, gopifinder.MemberSuspect, gopifinder.MemberDead} {
+			fmt.Fprintf(b, "finder_peers{state=%s} %d\n", quoteLabel(st.String()), counts[st])
+		}
+	}
+
+	writeHeader(b, "finder_rejected_requests_total", "counter", "Number of requests rejected by the server's limits, by reason.")
+	fmt.Fprintf(b, "finder_rejected_requests_total{reason=\"body_too_large\"} %d\n", atomic.LoadInt64(&s.limits.BodyTooLarge))
+	fmt.Fprintf(b, "finder_rejected_requests_total{reason=\"rate_limited\"} %d\n", atomic.LoadInt64(&s.limits.RateLimited))
+	writeHeader(b, "finder_registry_full_total", "counter", "Number of devices and services rejected because the registry was full.")
+	fmt.Fprintf(b, "finder_registry_full_total %d\n", atomic.LoadInt64(&s.limits.RegistryFull))
+}
+
+// writeDeviceStatusMetrics writes the hardware status of the device as gauges.
+// The status is read at most once every 10 seconds, as reading it runs several commands.
+func (s *Server) writeDeviceStatusMetrics(b *bytes.Buffer) {
+	s.statusMu.Lock()
+	if time.Since(s.status.Created) > 10*time.Second {
+		s.status, s.statusErr = gopifinder.NewDeviceStatus()
+		if s.statusErr != nil {
+			s.logDebug("Error getting device status", gopifinder.ErrField(s.statusErr))
+		}
+	}
+	d, err := s.status, s.statusErr
+	s.statusMu.Unlock()
+
+	up := int64(1)
+	if err != nil || len(d.Errors) != 0 {
+		// Some of the values could not be read, the rest are still reported
+		up = 0
+	}
+	writeGauge(b, "finder_device_status_up", "Whether or not all of the device status values could be read.", up)
+	writeHeader(b, "finder_device_status_collector_failed", "gauge", "Status collectors that could not read their values.")
+	for _, i := range d.Errors {
+		fmt.Fprintf(b, "finder_device_status_collector_failed{collector=%s} 1\n", quoteLabel(i.Collector))
+	}
+
+	writeHeader(b, "finder_device_info", "gauge", "Operating system and hardware information of the device.")
+	fmt.Fprintf(b, "finder_device_info{hostname=%s,os=%s,os_name=%s,os_version=%s,hw_type=%s,hw_serial=%s,hw_model=%s,hw_processor=%s,hw_memory_mb=%s,hw_manufacturer=%s} 1\n",
+		quoteLabel(d.HostName), quoteLabel(d.OS), quoteLabel(d.OSName), quoteLabel(d.OSVersion),
+		quoteLabel(d.HWType), quoteLabel(d.HWSerialNo), quoteLabel(d.HWModel), quoteLabel(d.HWProcessor),
+		quoteLabel(strconv.Itoa(d.HWMemory)), quoteLabel(d.HWManufacturer))
+
+	// Leave out the values of the collectors that failed, rather than report them as 0
+	failed := map[string]bool{}
+	for _, i := range d.Errors {
+		failed[i.Collector] = true
+	}
+	if err != nil {
+		// None of the collectors could read their values
+		return
+	}
+	if !failed["cpu"] {
+		writeFloatGauge(b, "finder_cpu_temperature_celsius", "CPU temperature.", d.CPUTemp)
+	}
+	if !failed["gpu"] {
+		writeFloatGauge(b, "finder_gpu_temperature_celsius", "GPU temperature.", d.GPUTemp)
+	}
+	if !failed["throttling"] {
+		writeGauge(b, "finder_throttled_bits", "Throttled state bits reported by vcgencmd get_throttled.", int64(d.Throttled))
+		writeHeader(b, "finder_throttled", "gauge", "Throttled state of the device, by flag.")
+		for _, i := range gopifinder.ThrottleFlags {
+			fmt.Fprintf(b, "finder_throttled{flag=%s} %d\n", quoteLabel(i.Name), (d.Throttled>>i.Bit)&1)
+		}
+	}
+	if !failed["disk"] {
+		// Despite its name, DiskUsed holds the available space, in 1K blocks on Linux.
+		// DiskUsedPerc is the used percentage on Linux, but the free one on Windows.
+		disk := d.DiskUsed
+		used := float64(d.DiskUsedPerc) / 100
+		switch d.OS {
+		case "Linux":
+			disk *= 1024
+		case "WindowsNT":
+			used = 1 - used
+		}
+		writeGauge(b, "finder_disk_available_bytes", "Available space on the root file system.", disk)
+		writeFloatGauge(b, "finder_disk_used_ratio", "Used space on the root file system, as a ratio of its size.", used)
+	}
+	if !failed["memory"] {
+		// The memory is reported in kB
+		writeGauge(b, "finder_memory_total_bytes", "Total memory.", d.TotalMem*1024)
+		writeGauge(b, "finder_memory_available_bytes", "Available memory.", d.AvailMem*1024)
+	}
+	if !failed["uptime"] {
+		writeGauge(b, "finder_uptime_seconds", "Time since the device booted.", int64(d.Uptime))
+	}
+}
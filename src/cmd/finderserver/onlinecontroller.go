@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"net/http"
 
 	"github.com/brumawen/gopi-finder/src"
@@ -18,7 +17,7 @@ type OnlineController struct {
 func (c *OnlineController) AddController(router *mux.Router, s *Server) {
 	c.Srv = s
 	router.Methods("POST", "GET").Path("/online").Name("Online").
-		Handler(Logger(c, http.HandlerFunc(c.handleOnline)))
+		HandlerFunc(c.handleOnline)
 }
 
 // handleOnline handles the /online web method call
@@ -40,7 +39,6 @@ func (c *OnlineController) handleOnline(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		http.Error(w, "Error getting DeviceInfo. "+err.Error(), 500)
 	} else {
-		myInfo.PortNo = c.Srv.PortNo
 		if mustAdd {
 			c.Srv.AddDevice(myInfo)
 		}
@@ -49,9 +47,3 @@ func (c *OnlineController) handleOnline(w http.ResponseWriter, r *http.Request)
 		}
 	}
 }
-
-// LogInfo is used to log information messages for this controller.
-func (c *OnlineController) LogInfo(v ...interface{}) {
-	a := fmt.Sprint(v)
-	logger.Info("OnlineController: ", a[1:len(a)-1])
-}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+// ErrForbidden is returned when a caller may not change a service registration.
+var ErrForbidden = errors.New("Not authorized to change the service registration")
+
+// Caller identifies the sender of a request that changes the registry.
+type Caller struct {
+	Owner     string // The owner credential of the caller, empty if the caller did not identify itself
+	PublicKey string // The verified public key of the node that signed the request, if any
+	MachineID string // The MachineID the verified public key is pinned for, if any
+	Admin     bool   // Indicates the caller holds an admin credential
+}
+
+// NewCaller identifies the sender of the request from its owner token or key signature.
+// A token takes precedence over the key of the node that sent the request.
+func (s *Server) NewCaller(r *http.Request) (Caller, error) {
+	key, err := s.keyVerifier.Verify(r)
+	if err != nil {
+		return Caller{}, err
+	}
+	c := Caller{PublicKey: key, MachineID: s.pinnedMachineID(key)}
+	token := r.Header.Get(gopifinder.HeaderToken)
+	if token != "" {
+		c.Owner = gopifinder.TokenOwner(token)
+	} else if key != "" {
+		c.Owner = gopifinder.KeyOwner(key)
+	}
+	s.cfgMu.RLock()
+	adminToken, policy := s.AdminToken, s.policy
+	s.cfgMu.RUnlock()
+	if adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1 {
+		c.Admin = true
+	}
+	if policy.IsAdmin(key) {
+		c.Admin = true
+	}
+	return c, nil
+}
+
+// CanChange returns whether or not the caller may update or remove the registration.
+// Registrations without an owner may be changed by anyone.
+func (c *Caller) CanChange(v gopifinder.ServiceInfo) bool {
+	return c.Admin || v.Owner == "" || v.Owner == c.Owner
+}
+
+// errorStatus returns the HTTP status code for an error returned by the server.
+func errorStatus(err error) int {
+	switch err {
+	case ErrForbidden, ErrLogNotAllowed:
+		return http.StatusForbidden
+	case ErrNoJournal:
+		return http.StatusNotImplemented
+	case ErrRegistryFull:
+		return http.StatusTooManyRequests
+	}
+	return http.StatusBadRequest
+}
+
+// writeError responds to a request that failed with an error returned by the server.
+// A caller turned away by a full registry is told when to try again.
+func writeError(w http.ResponseWriter, err error, msg string) {
+	if err == ErrRegistryFull {
+		w.Header().Set("Retry-After", registryRetryAfter)
+	}
+	http.Error(w, msg, errorStatus(err))
+}
+
+// getPolicy returns the registration policy, nil allows all registrations.
+func (s *Server) getPolicy() *Policy {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.policy
+}
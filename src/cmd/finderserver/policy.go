@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path"
+)
+
+// Policy holds the rules that limit which services the nodes in the cluster may register.
+type Policy struct {
+	AdminKeys    []string     `json:"adminKeys"`    // Public keys of the nodes that may change any registration
+	Rules        []PolicyRule `json:"rules"`        // Rules limiting the service names that may be registered
+	DenyUnlisted bool         `json:"denyUnlisted"` // Indicates services that no rule applies to may not be registered
+}
+
+// PolicyRule limits the service names that may be registered by a node, identified by
+// its MachineID or its public key.  A MachineID only identifies a node that signs its
+// requests with the key pinned for that MachineID.
+type PolicyRule struct {
+	MachineID string   `json:"machineID,omitempty"` // MachineID of the registering node the rule applies to
+	PublicKey string   `json:"publicKey,omitempty"` // Public key of the registering node the rule applies to
+	Services  []string `json:"services"`            // Service names that may be registered, shell patterns are allowed
+}
+
+// loadPolicy reads the policy from the specified JSON file.
+func loadPolicy(file string) (*Policy, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.New("Error reading policy file. " + err.Error())
+	}
+	p := Policy{}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, errors.New("Error parsing policy file. " + err.Error())
+	}
+	for _, r := range p.Rules {
+		for _, n := range r.Services {
+			if _, err := path.Match(n, ""); err != nil {
+				return nil, errors.New("Invalid service name pattern " + n + " in policy file")
+			}
+		}
+	}
+	return &p, nil
+}
+
+// IsAdmin returns whether or not the node with the specified public key is an admin.
+func (p *Policy) IsAdmin(publicKey string) bool {
+	if p == nil || publicKey == "" {
+		return false
+	}
+	for _, k := range p.AdminKeys {
+		if k == publicKey {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows returns whether or not the service may be registered by the node with the
+// specified verified MachineID and public key.  The service name must match one of the
+// rules that apply.  If no rule applies, the service is allowed unless DenyUnlisted is set.
+func (p *Policy) Allows(machineID string, publicKey string, serviceName string) bool {
+	if p == nil {
+		return true
+	}
+	found := false
+	for _, r := range p.Rules {
+		if (r.MachineID == "" || r.MachineID != machineID) && (r.PublicKey == "" || r.PublicKey != publicKey) {
+			continue
+		}
+		found = true
+		for _, n := range r.Services {
+			if ok, _ := path.Match(n, serviceName); ok {
+				return true
+			}
+		}
+	}
+	return !found && !p.DenyUnlisted
+}
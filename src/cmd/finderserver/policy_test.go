@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+func TestMachineIDRulesApplyToTheNodeHoldingThePinnedKey(t *testing.T) {
+	s := newTestServer()
+	s.pinnedKeys = map[string]string{"pi": "pikey"}
+	s.policy = &Policy{Rules: []PolicyRule{{MachineID: "pi", Services: []string{"web*"}}}, DenyUnlisted: true}
+	node := Caller{PublicKey: "pikey", MachineID: s.pinnedMachineID("pikey")}
+
+	tests := []struct {
+		caller  Caller
+		service string
+		allowed bool
+	}{
+		{node, "web", true},
+		{node, "camera", false},
+		{Caller{}, "web", false},                   // Claiming the MachineID in the body is not enough
+		{Caller{PublicKey: "other"}, "web", false}, // Nor is signing with a key that is not pinned for it
+	}
+	for _, tc := range tests {
+		err := s.AddService(gopifinder.ServiceInfo{MachineID: "pi", ServiceName: tc.service}, tc.caller)
+		if allowed := err != ErrForbidden; allowed != tc.allowed {
+			t.Errorf("Caller %v registering %s: expected allowed %v, got %v", tc.caller, tc.service, tc.allowed, err)
+		}
+	}
+}
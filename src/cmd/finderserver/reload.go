@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/brumawen/gopi-finder/src"
+
+	"github.com/kardianos/service"
+)
+
+// ReloadResult lists the settings changed by a configuration reload.
+type ReloadResult struct {
+	Applied []string `json:"applied"` // Settings that were changed and are now in effect
+	Pending []string `json:"pending"` // Settings that differ from the running server and only take effect on a restart
+}
+
+// Reload reloads the configuration from the file, environment and command line arguments
+// the server was started with.  The settings that can be changed at runtime are applied,
+// while the settings that need a restart are reported as pending.
+// The running configuration is kept if the new configuration is invalid.
+func (s *Server) Reload() (ReloadResult, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	r := ReloadResult{Applied: []string{}, Pending: []string{}}
+	if s.config == nil {
+		return r, errors.New("The server was not started from a configuration")
+	}
+	c, _, err := loadConfig(s.config.args, s.config.dir)
+	if err != nil {
+		return r, errors.New("Error reloading configuration. " + err.Error())
+	}
+
+	for _, i := range configSettings(s.config, c) {
+		if !i.restart && !reflect.DeepEqual(i.old, i.new) {
+			r.Applied = append(r.Applied, i.name)
+		}
+	}
+	// Pending settings are compared with the configuration the server started with,
+	// so they are still reported by later reloads
+	for _, i := range configSettings(s.started, c) {
+		if i.restart && !reflect.DeepEqual(i.old, i.new) {
+			r.Pending = append(r.Pending, i.name)
+		}
+	}
+
+	s.applyConfig(c)
+	s.config = c
+	s.logInfo("Configuration reloaded", gopifinder.Field("applied", r.Applied), gopifinder.Field("pending", r.Pending))
+	return r, nil
+}
+
+// configSetting holds the values of a setting in two configurations.
+type configSetting struct {
+	name    string      // The name of the setting in the configuration file
+	restart bool        // Indicates a change only takes effect on a restart
+	old     interface{} // The old value
+	new     interface{} // The new value
+}
+
+// configSettings returns the values of each setting in the two configurations.
+func configSettings(a *Config, b *Config) []configSetting {
+	return []configSetting{
+		{"port", true, a.Port, b.Port},
+		{"bindAddress", true, a.BindAddress, b.BindAddress},
+		{"timeout", false, a.Timeout, b.Timeout},
+		{"syncInterval", false, a.SyncInterval, b.SyncInterval},
+		{"scanInterval", false, a.ScanInterval, b.ScanInterval},
+		{"tombstoneTTL", false, a.TombstoneTTL, b.TombstoneTTL},
+		{"interfaces", true, a.Interfaces, b.Interfaces},
+		{"seeds", true, a.Seeds, b.Seeds},
+		{"clusters", true, a.Clusters, b.Clusters},
+		{"dataDir", true, a.DataDir, b.DataDir},
+		{"security.secret", false, a.Security.Secret, b.Security.Secret},
+		{"security.protectReads", false, a.Security.ProtectReads, b.Security.ProtectReads},
+		{"security.keyPolicy", false, a.Security.KeyPolicy, b.Security.KeyPolicy},
+		{"security.adminToken", false, a.Security.AdminToken, b.Security.AdminToken},
+		{"security.policy", false, a.Security.PolicyFile, b.Security.PolicyFile},
+		{"tls", true, a.TLS, b.TLS},
+		{"limits", false, a.Limits, b.Limits},
+		{"logging.verbose", false, a.Logging.Verbose, b.Logging.Verbose},
+		{"logging.level", false, a.Logging.Level, b.Logging.Level},
+		{"logging.components", false, a.Logging.Components, b.Logging.Components},
+		{"logging.format", true, a.Logging.Format, b.Logging.Format},
+		{"logging.journalUnit", false, a.Logging.JournalUnit, b.Logging.JournalUnit},
+		{"logging.units", false, a.Logging.Units, b.Logging.Units},
+		{"logging.files", false, a.Logging.Files, b.Logging.Files},
+		{"status.interval", false, a.Status.Interval, b.Status.Interval},
+		{"status.samples", true, a.Status.Samples, b.Status.Samples},
+		{"status.persist", false, a.Status.Persist, b.Status.Persist},
+		{"features", true, a.Features, b.Features},
+	}
+}
+
+// applyConfig applies the settings that can be changed while the server is running.
+func (s *Server) applyConfig(c *Config) {
+	// Load the policy first, so the lock is not held while reading the file
+	var policy *Policy
+	if c.Security.PolicyFile != "" {
+		var err error
+		if policy, err = loadPolicy(c.Security.PolicyFile); err != nil {
+			s.logError("Error loading policy", gopifinder.ErrField(err))
+			policy = &Policy{DenyUnlisted: true}
+		}
+	}
+
+	s.cfgMu.Lock()
+	if c.Limits.RateLimit != s.RateLimit || c.Limits.RateBurst != s.RateBurst {
+		// A new limiter forgets the clients' buckets, so it is only replaced when the limits change
+		s.RateLimit = c.Limits.RateLimit
+		s.RateBurst = c.Limits.RateBurst
+		s.limiter = s.newRateLimiter()
+	}
+	s.Timeout = int(c.Timeout / time.Second)
+	s.SyncInterval = c.SyncInterval
+	s.ScanInterval = c.ScanInterval
+	s.TombstoneTTL = c.TombstoneTTL
+	s.Secret = c.Security.Secret
+	s.ProtectReads = c.Security.ProtectReads
+	s.RejectKeyMismatch = c.Security.KeyPolicy != "flag"
+	s.AdminToken = c.Security.AdminToken
+	s.PolicyFile = c.Security.PolicyFile
+	s.policy = policy
+	s.MaxBodySize = c.Limits.MaxBodySize
+	s.MaxDevices = c.Limits.MaxDevices
+	s.MaxServices = c.Limits.MaxServices
+	s.JournalUnit = c.Logging.JournalUnit
+	s.LogUnits = c.Logging.Units
+	s.LogFiles = c.Logging.Files
+	s.StatusInterval = c.Status.Interval
+	s.PersistStatus = c.Status.Persist
+	s.verifier = s.newVerifier()
+	if s.Finder != nil {
+		// The Finder is in use by the scan, gossip and sync goroutines
+		s.Finder.SetTimeout(s.Timeout)
+		s.Finder.SetSecret(s.Secret)
+	}
+	s.cfgMu.Unlock()
+
+	// The levels are changed in place, so the loggers already handed out see the new levels
+	if levels, err := c.logLevels(service.Interactive()); err == nil && s.LogLevels != nil {
+		s.LogLevels.Replace(levels)
+	}
+}
+
+// watchReload reloads the configuration each time the process receives a SIGHUP,
+// until the server exits.
+func (s *Server) watchReload() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-s.exit:
+			return
+		case <-hup:
+			if _, err := s.Reload(); err != nil {
+				s.logError("Error reloading configuration", gopifinder.ErrField(err))
+			}
+		}
+	}
+}
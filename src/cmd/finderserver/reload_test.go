@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+func TestReloadAppliesRuntimeSettingsAndListsPendingOnes(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "port: 20510\ntimeout: 3s\n")
+	c, _, err := loadConfig([]string{"-config", "finder.yml"}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(c)
+	s.Finder = &gopifinder.Finder{Timeout: s.Timeout}
+	s.Log = newTestServer().Log
+
+	writeConfig(t, dir, "port: 20520\ntimeout: 7s\nseeds: [10.0.0.1]\n")
+	r, err := s.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.Applied, []string{"timeout"}) {
+		t.Errorf("Expected the timeout to be applied, got %v", r.Applied)
+	}
+	if !reflect.DeepEqual(r.Pending, []string{"port", "seeds"}) {
+		t.Errorf("Expected the port and seeds to be pending, got %v", r.Pending)
+	}
+	if s.Timeout != 7 || s.Finder.Timeout != 7 {
+		t.Errorf("Expected the new timeout to be in effect, got %d and %d", s.Timeout, s.Finder.Timeout)
+	}
+	if s.PortNo != 20510 || len(s.Seeds) != 0 {
+		t.Errorf("Expected the port and seeds to wait for a restart, got %d and %v", s.PortNo, s.Seeds)
+	}
+
+	// Pending settings are still reported until the server restarts
+	r, err = s.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Applied) != 0 || !reflect.DeepEqual(r.Pending, []string{"port", "seeds"}) {
+		t.Errorf("Expected only the pending settings on a second reload, got %v", r)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/brumawen/gopi-finder/src"
+
+	"github.com/gorilla/mux"
+)
+
+// ReplicaController handles the Web Methods used to replicate service registrations
+// between finder servers.
+type ReplicaController struct {
+	Srv *Server
+}
+
+// AddController adds the routes associated with the controller to the router.
+func (c *ReplicaController) AddController(router *mux.Router, s *Server) {
+	c.Srv = s
+	router.Methods("POST").Path("/replica/push").Name("PushReplica").
+		HandlerFunc(c.handlePush)
+	router.Methods("GET").Path("/replica/get").Name("GetReplica").
+		HandlerFunc(c.handleGet)
+	router.Methods("POST").Path("/replica/sync").Name("SyncReplica").
+		HandlerFunc(c.handleSync)
+}
+
+// handlePush handles the /replica/push web method call
+func (c *ReplicaController) handlePush(w http.ResponseWriter, r *http.Request) {
+	if r.ContentLength != 0 {
+		l := gopifinder.ServiceInfoList{}
+		if err := l.ReadFrom(r.Body); err != nil {
+			http.Error(w, err.Error(), 400)
+		} else {
+			c.Srv.ApplyReplica(l.Services)
+		}
+	}
+}
+
+// handleGet handles the /replica/get web method call
+func (c *ReplicaController) handleGet(w http.ResponseWriter, r *http.Request) {
+	l := gopifinder.ServiceInfoList{
+		Services: gopifinder.FilterServices(c.Srv.GetRegistry(), gopifinder.GetRequestClusters(r)),
+	}
+	if err := l.WriteTo(w); err != nil {
+		http.Error(w, "Error serializing Service list. "+err.Error(), 500)
+	}
+}
+
+// handleSync handles the /replica/sync web method call
+func (c *ReplicaController) handleSync(w http.ResponseWriter, r *http.Request) {
+	rs := gopifinder.RegistrySync{}
+	if err := json.NewDecoder(r.Body).Decode(&rs); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	res := c.Srv.HandleSync(rs, gopifinder.GetRequestClusters(r))
+	b, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, "Error serializing registry sync. "+err.Error(), 500)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+// defaultTombstoneTTL is how long removed devices and service registrations are remembered if no TTL is configured.
+const defaultTombstoneTTL = 24 * time.Hour
+
+// ApplyReplica applies the list of replicated service registrations to the registry.
+// A registration is only applied if it is newer than the one already held, which
+// stops replicated updates from looping between servers.
+// Registrations from other clusters are ignored.
+// Returns the number of registrations that were applied.
+func (s *Server) ApplyReplica(l []gopifinder.ServiceInfo) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, i := range l {
+		if i.MachineID == "" || i.ServiceName == "" || i.Origin == "" || !i.InCluster(s.Clusters) {
+			continue
+		}
+		if s.isRegistryFull(i) {
+			s.rejectFull("service", i.ServiceName)
+			continue
+		}
+		s.keepOwner(&i)
+		if s.applyService(i) {
+			s.metrics.ObserveReplication(i.Updated)
+			count++
+		}
+	}
+	return count
+}
+
+// GetRegistry returns the full list of service registrations, including
+// registrations that have been removed.
+func (s *Server) GetRegistry() []gopifinder.ServiceInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	l := append([]gopifinder.ServiceInfo{}, s.Services...)
+	return append(l, s.removed...)
+}
+
+// PullRegistry gets the full registry from the first peer that responds and
+// merges it with the local registry.
+func (s *Server) PullRegistry() {
+	for _, d := range s.getPeers() {
+		l, err := s.Finder.PullServices(d)
+		if err != nil {
+			s.logDebug("Error pulling registry", append(deviceFields(d), gopifinder.ErrField(err))...)
+			continue
+		}
+		n := s.ApplyReplica(l)
+		s.logDebug("Pulled service registrations", append(deviceFields(d), gopifinder.Field("count", n))...)
+		return
+	}
+}
+
+// ApplyDevices merges the list of devices received from a peer with the Devices list.
+// A device is only updated if the received information is newer than the information held.
+// Returns the number of devices that were added or updated.
+// Devices that the gossip membership has declared dead, and devices in other clusters, are ignored.
+func (s *Server) ApplyDevices(l []gopifinder.DeviceInfo) int {
+	trusted := []gopifinder.DeviceInfo{}
+	for _, d := range l {
+		if d.InCluster(s.Clusters) && s.checkDeviceKey(&d) {
+			trusted = append(trusted, d)
+		}
+	}
+	live := []gopifinder.DeviceInfo{}
+	s.mu.RLock()
+	for _, d := range trusted {
+		if !s.isRemovedDevice(d) && (s.Members == nil || !s.Members.IsDead(d.MachineID)) {
+			live = append(live, d)
+		}
+	}
+	s.mu.RUnlock()
+	for _, d := range live {
+		if s.Members != nil {
+			s.Members.Observe(d, false)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.myMachineID()
+	count := 0
+	for _, d := range live {
+		if d.MachineID == "" || d.MachineID == id {
+			continue
+		}
+		found := false
+		for n, i := range s.Devices {
+			if i.MachineID == d.MachineID {
+				found = true
+				if d.Created.After(i.Created) {
+					s.Devices[n] = d
+					count++
+				}
+				break
+			}
+		}
+		if !found {
+			if len(s.Devices) >= s.getMaxDevices() {
+				s.rejectFull("device", d.HostName)
+				continue
+			}
+			s.Devices = append(s.Devices, d)
+			count++
+		}
+	}
+	return count
+}
+
+// ApplyDeviceTombstones applies the list of device tombstones.  Each device that
+// has not been removed already, and has not restarted since the removal, is removed
+// from the device lists and declared dead.
+// Returns the number of tombstones that were applied.
+func (s *Server) ApplyDeviceTombstones(l []gopifinder.DeviceTombstone) int {
+	applied := []gopifinder.DeviceTombstone{}
+	s.mu.Lock()
+	s.pruneDeviceTombstones()
+	for _, t := range l {
+		if t.MachineID == "" || t.IsExpired() {
+			continue
+		}
+		found := false
+		for n, i := range s.removedDevices {
+			if i.MachineID == t.MachineID {
+				found = true
+				if t.Supersedes(i) {
+					s.removedDevices[n] = t
+					applied = append(applied, t)
+				}
+				break
+			}
+		}
+		if !found {
+			s.removedDevices = append(s.removedDevices, t)
+			applied = append(applied, t)
+		}
+	}
+	// A held device that has restarted since the removal is kept
+	removed := []string{}
+	for _, t := range applied {
+		held := false
+		for n, i := range s.Devices {
+			if i.MachineID == t.MachineID {
+				held = true
+				if t.Suppresses(i) {
+					s.Devices = append(s.Devices[:n], s.Devices[n+1:]...)
+					removed = append(removed, t.MachineID)
+				}
+				break
+			}
+		}
+		if !held {
+			removed = append(removed, t.MachineID)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, id := range removed {
+		s.Finder.RemoveDevice(id)
+		if s.Members != nil {
+			s.Members.Remove(id)
+		}
+	}
+	return len(applied)
+}
+
+// GetDeviceTombstones returns a copy of the list of device tombstones that have not expired.
+func (s *Server) GetDeviceTombstones() []gopifinder.DeviceTombstone {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneDeviceTombstones()
+	return append([]gopifinder.DeviceTombstone{}, s.removedDevices...)
+}
+
+// HandleSync applies the entries received in a registry sync from a peer and, if the
+// peer sent its digest, returns the entries the peer is missing along with this server's digest.
+// Only the entries in the peer's clusters are compared and returned.
+func (s *Server) HandleSync(rs gopifinder.RegistrySync, clusters []string) gopifinder.RegistrySync {
+	s.ApplyDeviceTombstones(rs.Removed)
+	s.ApplyDevices(rs.Devices)
+	s.ApplyReplica(rs.Services)
+
+	res := gopifinder.RegistrySync{}
+	if rs.Digest != nil {
+		dl, sl, tl := s.filterSync(clusters)
+		res = rs.Digest.Diff(dl, sl, tl)
+		digest := gopifinder.NewRegistryDigest(dl, sl, tl)
+		res.Digest = &digest
+	}
+	return res
+}
+
+// SyncWithPeer exchanges registry digests with the specified peer and transfers
+// the entries that differ in both directions.  Only the entries in the peer's
+// clusters are exchanged, so that a server in several clusters does not leak
+// registrations from one cluster into another.
+func (s *Server) SyncWithPeer(d gopifinder.DeviceInfo) error {
+	digest := gopifinder.NewRegistryDigest(s.filterSync(d.Clusters))
+	res, err := s.Finder.SyncRegistry(d, gopifinder.RegistrySync{Digest: &digest})
+	if err != nil {
+		return err
+	}
+	s.ApplyDeviceTombstones(res.Removed)
+	dn := s.ApplyDevices(res.Devices)
+	sn := s.ApplyReplica(res.Services)
+	if dn != 0 || sn != 0 {
+		s.logDebug("Synced registry", append(deviceFields(d), gopifinder.Field("devices", dn), gopifinder.Field("services", sn))...)
+	}
+	if res.Digest == nil {
+		return nil
+	}
+
+	// Send the peer the entries it is missing
+	rs := res.Digest.Diff(s.filterSync(d.Clusters))
+	if rs.IsEmpty() {
+		return nil
+	}
+	_, err = s.Finder.SyncRegistry(d, rs)
+	return err
+}
+
+// runRegistrySync periodically syncs the registry with a random peer until
+// the server exits.
+func (s *Server) runRegistrySync() {
+	t := time.NewTimer(s.getSyncInterval())
+	defer t.Stop()
+	for {
+		select {
+		case <-s.exit:
+			return
+		case <-t.C:
+			// The interval is read each time, as it can be changed by a reload
+			t.Reset(s.getSyncInterval())
+			l := s.getPeers()
+			if len(l) != 0 {
+				d := l[rand.Intn(len(l))]
+				err := s.SyncWithPeer(d)
+				if err != nil {
+					s.logDebug("Error syncing registry", append(deviceFields(d), gopifinder.ErrField(err))...)
+				}
+				s.metrics.ObserveSync(err)
+			}
+		}
+	}
+}
+
+// addMemberDevice adds a device reported alive by the gossip membership to the
+// server and finder device lists.
+func (s *Server) addMemberDevice(d gopifinder.DeviceInfo) {
+	if s.addDevice(d) {
+		s.Finder.AddDevice(d)
+	}
+}
+
+// dropMemberDevice removes a device declared dead by the gossip membership from
+// the server and finder device lists.
+func (s *Server) dropMemberDevice(id string) {
+	s.mu.Lock()
+	for n, i := range s.Devices {
+		if i.MachineID == id {
+			s.Devices = append(s.Devices[:n], s.Devices[n+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
+	s.Finder.RemoveDevice(id)
+}
+
+// replicate sends the list of service registrations to each of the known peers,
+// if replication is on.  Each peer is only sent the registrations in its clusters.
+func (s *Server) replicate(l []gopifinder.ServiceInfo) {
+	if !s.Features.Replication {
+		return
+	}
+	for _, d := range s.getPeers() {
+		pl := gopifinder.FilterServices(l, d.Clusters)
+		if len(pl) == 0 {
+			continue
+		}
+		go func(d gopifinder.DeviceInfo) {
+			if err := s.Finder.ReplicateServices(d, pl); err != nil {
+				s.logError("Error replicating services", append(deviceFields(d), gopifinder.ErrField(err))...)
+			}
+		}(d)
+	}
+}
+
+// getPeers returns the list of known devices, excluding this server.
+func (s *Server) getPeers() []gopifinder.DeviceInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id := s.myMachineID()
+	l := []gopifinder.DeviceInfo{}
+	for _, d := range s.Devices {
+		if d.MachineID != id {
+			l = append(l, d)
+		}
+	}
+	return l
+}
+
+// myMachineID returns the MachineID of this server.
+func (s *Server) myMachineID() string {
+	if s.Finder == nil || s.Finder.MyInfo == nil {
+		return ""
+	}
+	return s.Finder.MyInfo.MachineID
+}
+
+// nextVersion returns the version to assign to a registration changed on this server.
+// The version is a hybrid logical clock; it is never less than the current time, so
+// that changes made after a restart still supersede older registrations, and is
+// always greater than any version seen before.
+// The caller must hold the lock.
+func (s *Server) nextVersion() int64 {
+	v := time.Now().UnixNano()
+	if v <= s.clock {
+		v = s.clock + 1
+	}
+	s.clock = v
+	return v
+}
+
+// newTombstone returns a removed copy of the specified service registration.
+// The caller must hold the lock.
+func (s *Server) newTombstone(v gopifinder.ServiceInfo) gopifinder.ServiceInfo {
+	v.Origin = s.myMachineID()
+	v.Version = s.nextVersion()
+	v.Deleted = true
+	v.Updated = time.Now()
+	return v
+}
+
+// applyService adds, updates or removes the service registration if it is newer
+// than the registration currently held.  Returns whether or not it was applied.
+// The caller must hold the lock.
+func (s *Server) applyService(v gopifinder.ServiceInfo) bool {
+	if v.Version > s.clock {
+		s.clock = v.Version
+	}
+	for n, i := range s.Services {
+		if i.IsSameService(v) {
+			if !v.IsNewerThan(i) {
+				return false
+			}
+			s.Services = append(s.Services[:n], s.Services[n+1:]...)
+			break
+		}
+	}
+	for n, i := range s.removed {
+		if i.IsSameService(v) {
+			if !v.IsNewerThan(i) {
+				return false
+			}
+			s.removed = append(s.removed[:n], s.removed[n+1:]...)
+			break
+		}
+	}
+	if v.Deleted {
+		s.logDebug("Removed service", gopifinder.Field("service", v.ServiceName), gopifinder.Field("machineID", v.MachineID))
+		s.removed = append(s.removed, v)
+	} else {
+		s.logDebug("Added service", gopifinder.Field("service", v.ServiceName), gopifinder.Field("machineID", v.MachineID))
+		s.Services = append(s.Services, v)
+	}
+	s.pruneTombstones()
+	return true
+}
+
+// keepOwner replaces the owner of a replicated registration with the owner of the
+// registration held, so that a peer cannot take over a service by replicating it.
+// The caller must hold the lock.
+func (s *Server) keepOwner(v *gopifinder.ServiceInfo) {
+	for _, i := range s.Services {
+		if i.IsSameService(*v) {
+			if i.Owner != "" {
+				v.Owner = i.Owner
+			}
+			return
+		}
+	}
+}
+
+// isRegistryFull returns whether or not the registration would be a new entry in a
+// Services list that has already reached its maximum size.
+// The caller must hold the lock.
+func (s *Server) isRegistryFull(v gopifinder.ServiceInfo) bool {
+	if v.Deleted || len(s.Services) < s.getMaxServices() {
+		return false
+	}
+	for _, i := range s.Services {
+		if i.IsSameService(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// isRemovedDevice returns whether or not the device information must be ignored
+// because the device has been removed.
+// The caller must hold the lock.
+func (s *Server) isRemovedDevice(d gopifinder.DeviceInfo) bool {
+	for _, t := range s.removedDevices {
+		if t.Suppresses(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneDeviceTombstones forgets device tombstones that have expired.
+// The caller must hold the lock.
+func (s *Server) pruneDeviceTombstones() {
+	l := s.removedDevices[:0]
+	for _, t := range s.removedDevices {
+		if !t.IsExpired() {
+			l = append(l, t)
+		}
+	}
+	s.removedDevices = l
+}
+
+// getSyncInterval returns the interval between registry syncs with a random peer.
+func (s *Server) getSyncInterval() time.Duration {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	if s.SyncInterval <= 0 {
+		return 30 * time.Second
+	}
+	return s.SyncInterval
+}
+
+// getTombstoneTTL returns how long removed devices and service registrations are remembered.
+func (s *Server) getTombstoneTTL() time.Duration {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	if s.TombstoneTTL <= 0 {
+		return defaultTombstoneTTL
+	}
+	return s.TombstoneTTL
+}
+
+// pruneTombstones forgets removed service registrations older than the TombstoneTTL.
+// The caller must hold the lock.
+func (s *Server) pruneTombstones() {
+	ttl := s.getTombstoneTTL()
+	l := s.removed[:0]
+	for _, i := range s.removed {
+		if time.Since(i.Updated) < ttl {
+			l = append(l, i)
+		}
+	}
+	s.removed = l
+}
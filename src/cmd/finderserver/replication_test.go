@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+func TestReplicasRequireAnAuthenticatedPeer(t *testing.T) {
+	s := newTestServer()
+	h := s.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	body := []byte(`{"services":[]}`)
+
+	r := httptest.NewRequest("POST", "/replica/push", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an unauthenticated replica to be rejected, got %d", w.Code)
+	}
+
+	r = httptest.NewRequest("GET", "/replica/get", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the registry to be readable, got %d", w.Code)
+	}
+
+	s.Secret = "secret"
+	s.verifier = s.newVerifier()
+	r = httptest.NewRequest("POST", "/replica/push", bytes.NewReader(body))
+	if err := gopifinder.SignRequest(r, s.Secret, body); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected a signed replica to be accepted, got %d", w.Code)
+	}
+}
+
+func TestReplicaKeepsTheHeldOwner(t *testing.T) {
+	s := newTestServer()
+	s.Services = []gopifinder.ServiceInfo{
+		{MachineID: "pi", ServiceName: "web", Owner: "token:owner", Origin: "pi", Version: 1},
+	}
+	n := s.ApplyReplica([]gopifinder.ServiceInfo{
+		{MachineID: "pi", ServiceName: "web", Owner: "token:thief", Origin: "peer", Version: 2, PortNo: 8080},
+	})
+	if n != 1 {
+		t.Fatalf("Expected the newer replica to be applied, applied %d", n)
+	}
+	l := s.GetServices()
+	if len(l) != 1 || l[0].Owner != "token:owner" || l[0].PortNo != 8080 {
+		t.Errorf("Expected the update to keep the held owner, got %v", l)
+	}
+}
+
+func TestStaleTombstoneKeepsARestartedDevice(t *testing.T) {
+	s := newTestServer()
+	now := time.Now()
+	s.Devices = []gopifinder.DeviceInfo{{MachineID: "pi", Incarnation: 7}}
+	if n := s.ApplyDeviceTombstones([]gopifinder.DeviceTombstone{{MachineID: "pi", Incarnation: 5, Removed: now, Expires: now.Add(time.Hour)}}); n != 1 {
+		t.Fatal("Expected the tombstone to be recorded, applied", n)
+	}
+	if len(s.Devices) != 1 {
+		t.Error("Expected the restarted device to be kept, got", s.Devices)
+	}
+}
+
+func TestRemovingADeviceThatIsNotHeldRemovesItFromPeers(t *testing.T) {
+	s := newTestServer()
+	if err := s.RemoveDevice("pi", Caller{Admin: true}); err != nil {
+		t.Fatal(err)
+	}
+	l := s.GetDeviceTombstones()
+	if len(l) != 1 || l[0].Incarnation != 0 {
+		t.Fatal("Expected a tombstone without an incarnation, got", l)
+	}
+
+	// The peer holds the device, started before the removal
+	peer := newTestServer()
+	peer.Devices = []gopifinder.DeviceInfo{{MachineID: "pi", Incarnation: l[0].Removed.Add(-time.Hour).UnixNano()}}
+	peer.ApplyDeviceTombstones(l)
+	if len(peer.Devices) != 0 {
+		t.Error("Expected the peer to remove the device, got", peer.Devices)
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
-	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/brumawen/gopi-finder/src"
@@ -16,16 +20,71 @@ import (
 
 // Server defines the Web Server.
 type Server struct {
-	PortNo         int                      // Port Number the server will listen on
-	VerboseLogging bool                     // Verbose logging on/ off
-	Timeout        int                      // Timeout in seconds to wait for a LAN probe response
-	Devices        []gopifinder.DeviceInfo  //List of registers services
-	Services       []gopifinder.ServiceInfo // List of registered devices
-	Finder         *gopifinder.Finder       // Finder client
-	exit           chan struct{}            // Exit flag
-	shutdown       chan struct{}            // Shutdown complete flag
-	http           *http.Server             // HTTP server
-	router         *mux.Router              // HTTP router
+	PortNo            int                          // Port Number the server will listen on
+	BindAddress       string                       // IP address the server will listen on, empty listens on all addresses
+	Timeout           int                          // Timeout in seconds to wait for a LAN probe response
+	Devices           []gopifinder.DeviceInfo      //List of registers services
+	Services          []gopifinder.ServiceInfo     // List of registered devices
+	Finder            *gopifinder.Finder           // Finder client
+	TombstoneTTL      time.Duration                // How long removed devices and service registrations are remembered
+	SyncInterval      time.Duration                // Interval between registry syncs with a random peer
+	ScanInterval      time.Duration                // Interval between network scans after the first, 0 only scans on start up
+	Seeds             []string                     // IP addresses of peers to join instead of searching the LAN
+	Interfaces        []string                     // Names of the network interfaces whose LANs are searched, empty searches all of them
+	Members           *Membership                  // Gossip membership list
+	Secret            string                       // Shared cluster secret used to sign requests, if set
+	ProtectReads      bool                         // Indicates read requests must also be signed
+	TLS               bool                         // Indicates the server serves HTTPS
+	CertFile          string                       // The server certificate file
+	KeyFile           string                       // The server private key file
+	CAFile            string                       // The cluster CA certificate file used to verify peers
+	MutualTLS         bool                         // Indicates peers must present a certificate issued by the cluster CA
+	TLSInsecure       bool                         // Indicates HTTPS peers are connected to without verifying their certificates
+	IdentityFile      string                       // The file holding the device identity key
+	PinnedKeysFile    string                       // The file holding the public keys pinned for each peer
+	RejectKeyMismatch bool                         // Indicates a device whose key does not match its pinned key is rejected rather than flagged
+	Clusters          []string                     // Names of the clusters the server belongs to, empty for the default cluster
+	AdminToken        string                       // Token that allows the holder to change any service registration
+	PolicyFile        string                       // The file holding the registration policy
+	MaxBodySize       int64                        // The maximum size in bytes of a request body
+	RateLimit         float64                      // The requests per second allowed from each client IP address, negative switches rate limiting off
+	RateBurst         float64                      // The number of requests a client IP address may send at once
+	MaxDevices        int                          // The maximum number of devices in the Devices list
+	MaxServices       int                          // The maximum number of registrations in the Services list
+	Log               *gopifinder.Logger           // The structured logger
+	LogLevels         *gopifinder.LogLevels        // The levels logged by each component
+	DataDir           string                       // The directory holding the identity, pinned keys and generated certificate
+	JournalUnit       string                       // The systemd unit whose journal is returned by /log/get
+	LogUnits          []string                     // Other systemd units whose journals may be read from /log/get
+	LogFiles          map[string]string            // Log files that may be read from /log/get, by name
+	StatusInterval    time.Duration                // Interval between the device status samples kept in the history
+	StatusSamples     int                          // Number of device status samples kept in the history
+	PersistStatus     bool                         // Indicates the status history is saved while running and when the server stops
+	Features          Features                     // The optional features that are switched on
+	exit              chan struct{}                // Exit flag
+	shutdown          chan struct{}                // Shutdown complete flag
+	http              *http.Server                 // HTTP server
+	router            *mux.Router                  // HTTP router
+	mu                sync.RWMutex                 // Guards the Devices, Services and removed lists
+	removed           []gopifinder.ServiceInfo     // List of removed service registrations
+	removedDevices    []gopifinder.DeviceTombstone // List of removed devices
+	clock             int64                        // The last version assigned to a registration
+	verifier          *gopifinder.RequestVerifier  // Verifies signed requests
+	keyVerifier       gopifinder.KeyVerifier       // Verifies requests signed with a node's identity key
+	pinMu             sync.Mutex                   // Guards the pinned keys
+	pinnedKeys        map[string]string            // Public keys pinned for each MachineID
+	policy            *Policy                      // The registration policy, nil allows all registrations
+	limiter           *rateLimiter                 // The per client rate limiter
+	limits            limitCounters                // Counts the requests and registrations rejected by the limits
+	metrics           Metrics                      // Collects the metrics reported on the /metrics endpoint
+	statusMu          sync.Mutex                   // Guards the cached device status
+	status            gopifinder.DeviceStatus      // The device status last reported on the /metrics endpoint
+	statusErr         error                        // The error returned reading the cached device status
+	history           *gopifinder.StatusHistory    // The device status samples, nil if the status history is switched off
+	cfgMu             sync.RWMutex                 // Guards the settings that can be changed by a configuration reload
+	reloadMu          sync.Mutex                   // Serializes configuration reloads
+	config            *Config                      // The configuration last loaded
+	started           *Config                      // The configuration the server was started with
 }
 
 // Start is called when the service is starting
@@ -35,17 +94,17 @@ func (s *Server) Start(v service.Service) error {
 	// Make sure the working directory is the same as the application exe
 	ap, err := os.Executable()
 	if err != nil {
-		s.logError("Error getting the executable path.", err.Error())
+		s.logError("Error getting the executable path", gopifinder.ErrField(err))
 	} else {
 		wd, err := os.Getwd()
 		if err != nil {
-			s.logError("Error getting current working directory.", err.Error())
+			s.logError("Error getting current working directory", gopifinder.ErrField(err))
 		} else {
 			ad := filepath.Dir(ap)
-			s.logInfo("Current application path is", ad)
+			s.logInfo("Current application path", gopifinder.Field("path", ad))
 			if ad != wd {
 				if err := os.Chdir(ad); err != nil {
-					s.logError("Error chaning working directory.", err.Error())
+					s.logError("Error changing working directory", gopifinder.ErrField(err))
 				}
 			}
 		}
@@ -70,14 +129,26 @@ func (s *Server) Stop(v service.Service) error {
 
 // run will start up and run the service and wait for a Stop signal
 func (s *Server) run() {
-	if s.PortNo < 0 {
-		s.PortNo = 20502
+	if s.PortNo <= 0 {
+		s.PortNo = gopifinder.DefaultPort
 	}
 
-	s.logInfo("Server listening on port", s.PortNo)
+	s.logInfo("Server listening", gopifinder.Field("address", s.BindAddress), gopifinder.Field("port", s.PortNo))
 
 	// Create a router
 	s.router = mux.NewRouter().StrictSlash(true)
+	s.limiter = s.newRateLimiter()
+	s.router.Use(s.Instrument)
+	s.router.Use(s.LogRequests)
+	s.router.Use(s.LimitRequests)
+	s.verifier = s.newVerifier()
+	s.router.Use(s.Authenticate)
+	s.router.Use(s.CheckCluster)
+
+	if s.Features.StatusHistory {
+		s.history = gopifinder.NewStatusHistory(s.getStatusSamples())
+		s.loadStatusHistory()
+	}
 
 	// Add the controllers
 	s.AddController(new(OnlineController))
@@ -85,44 +156,125 @@ func (s *Server) run() {
 	s.AddController(new(ServiceController))
 	s.AddController(new(StatusController))
 	s.AddController(new(LogController))
+	s.AddController(new(ReplicaController))
+	if s.Features.Gossip {
+		s.AddController(new(GossipController))
+	}
+	s.AddController(new(ConfigController))
+	if s.Features.Metrics {
+		s.AddController(new(MetricsController))
+	}
+
+	// Set up TLS
+	var srvTLS, cliTLS *tls.Config
+	if s.TLS {
+		var err error
+		if srvTLS, cliTLS, err = s.setupTLS(); err != nil {
+			s.logError("Error setting up TLS", gopifinder.ErrField(err))
+			s.TLS = false
+		}
+	}
+	if cliTLS == nil {
+		// A plain HTTP server still connects to the peers that serve HTTPS
+		var err error
+		if cliTLS, err = s.newClientTLSConfig("", ""); err != nil {
+			s.logError("Error setting up TLS", gopifinder.ErrField(err))
+		}
+	}
+
+	// Load the device identity and pinned peer keys
+	identity, err := gopifinder.LoadIdentity(s.getIdentityFile())
+	if err != nil {
+		s.logError("Error loading device identity", gopifinder.ErrField(err))
+	}
+	s.loadPinnedKeys()
+
+	// Load the registration policy.  If the policy cannot be read, only admins
+	// may register services.
+	if s.PolicyFile != "" {
+		if s.policy, err = loadPolicy(s.PolicyFile); err != nil {
+			s.logError("Error loading policy", gopifinder.ErrField(err))
+			s.policy = &Policy{DenyUnlisted: true}
+		}
+	}
 
 	// Get our device info
 	s.Finder = &gopifinder.Finder{
-		VerboseLogging: s.VerboseLogging,
-		Timeout:        s.Timeout,
-		Logger:         logger,
-		IsServer:       true,
+		PortNo:     s.PortNo,
+		Identity:   identity,
+		Timeout:    s.Timeout,
+		Log:        s.getLog("finder"),
+		IsServer:   true,
+		Seeds:      s.Seeds,
+		Secret:     s.Secret,
+		Clusters:   s.Clusters,
+		Interfaces: s.Interfaces,
+		UseTLS:     s.TLS,
+		TLSConfig:  cliTLS,
+	}
+	if s.Features.Gossip {
+		s.Members = NewMembership(s)
 	}
 	if info, _, err := s.Finder.GetMyInfo(); err != nil {
-		s.logError("Error getting Device Information.", err.Error())
+		s.logError("Error getting Device Information", gopifinder.ErrField(err))
 	} else {
-		info.PortNo = s.PortNo
 		s.AddDevice(info)
 	}
 
 	// Tell other devices we are here
-	go func() {
-		s.ScanForDevices()
-	}()
+	if s.Features.Scan {
+		go func() {
+			s.ScanForDevices()
+			s.runScans()
+		}()
+	}
 
 	// Create a HTTP server
 	s.http = &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.PortNo),
-		Handler: s.router,
+		Addr:      net.JoinHostPort(s.BindAddress, strconv.Itoa(s.PortNo)),
+		Handler:   s.router,
+		TLSConfig: srvTLS,
 	}
 
 	// Start the web server
 	go func() {
-		if err := s.http.ListenAndServe(); err != nil {
-			s.logError("Error starting Web Server.", err.Error())
+		var err error
+		if s.TLS {
+			err = s.http.ListenAndServeTLS("", "")
+		} else {
+			err = s.http.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			s.logError("Error starting Web Server", gopifinder.ErrField(err))
 		}
 	}()
 
+	// Reload the configuration when asked to
+	go s.watchReload()
+
+	// Periodically sync the registry with our peers
+	if s.Features.RegistrySync {
+		go s.runRegistrySync()
+	}
+
+	// Start the gossip failure detector
+	if s.Features.Gossip {
+		s.Members.Start(s.exit)
+	}
+
+	// Sample the device status
+	if s.history != nil {
+		go s.runStatusSampler()
+	}
+
 	// Wait for an exit signal
 	_ = <-s.exit
 
 	// Shutdown
-	s.http.Shutdown(nil)
+	s.http.Shutdown(context.Background())
+	if s.history != nil {
+		s.saveStatusHistory()
+	}
 
 	s.logDebug("Shutdown complete")
 	close(s.shutdown)
@@ -136,18 +288,17 @@ func (s *Server) AddController(c Controller) {
 // ScanForDevices scans the network for other devices.
 func (s *Server) ScanForDevices() {
 	// Get the current server device info
-	s.logDebug("Scanning network for other devices.")
+	s.logDebug("Scanning network for other devices")
 	isUp := false
 	for !isUp {
 		if info, _, err := s.Finder.GetMyInfo(); err != nil {
-			s.logError("Error getting Device Information.", err.Error())
+			s.logError("Error getting Device Information", gopifinder.ErrField(err))
 		} else {
-			info.PortNo = s.PortNo
 			s.AddDevice(info)
 
 			if len(info.IPAddress) != 0 {
 				if strings.HasPrefix(info.IPAddress[0], "169.254") {
-					s.logInfo("Network is not DHCP capable yet.")
+					s.logInfo("Network is not DHCP capable yet")
 					time.Sleep(time.Minute)
 				} else {
 					// Network is up
@@ -161,117 +312,277 @@ func (s *Server) ScanForDevices() {
 	}
 
 	// Tell other devices we are here
-	s.logDebug("Performing network device scan.")
+	s.scanNetwork()
+
+	// Get the current service registrations from our peers
+	s.PullRegistry()
+}
+
+// scanNetwork searches the network for devices and adds them to the Devices list.
+func (s *Server) scanNetwork() {
+	s.logDebug("Performing network device scan")
 	start := time.Now()
-	if d, err := s.Finder.FindDevices(); err != nil {
-		s.logError("Error finding devices.", err.Error())
+	d, err := s.Finder.FindDevices()
+	if err != nil {
+		s.logError("Error finding devices", gopifinder.ErrField(err))
 	} else {
 		for _, i := range d {
 			s.AddDevice(i)
 		}
 	}
-	s.logDebug("Network scan complete in", time.Since(start))
+	s.metrics.ObserveScan(time.Since(start), err)
+	s.logDebug("Network scan complete", gopifinder.Field("duration", time.Since(start)))
+}
+
+// runScans searches the network every ScanInterval until the server exits.
+// The interval is checked every minute while periodic scans are switched off,
+// so that a reload can switch them on.
+func (s *Server) runScans() {
+	t := time.NewTimer(s.nextScan())
+	defer t.Stop()
+	for {
+		select {
+		case <-s.exit:
+			return
+		case <-t.C:
+			if s.getScanInterval() > 0 {
+				s.scanNetwork()
+			}
+			t.Reset(s.nextScan())
+		}
+	}
+}
+
+// nextScan returns the time to wait before the next periodic scan is due.
+func (s *Server) nextScan() time.Duration {
+	if d := s.getScanInterval(); d > 0 {
+		return d
+	}
+	return time.Minute
+}
+
+// getScanInterval returns the interval between network scans, 0 if periodic scans are switched off.
+func (s *Server) getScanInterval() time.Duration {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.ScanInterval
+}
+
+// GetDevices returns a copy of the Devices list.
+func (s *Server) GetDevices() []gopifinder.DeviceInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]gopifinder.DeviceInfo{}, s.Devices...)
+}
+
+// GetServices returns a copy of the Services list.
+func (s *Server) GetServices() []gopifinder.ServiceInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]gopifinder.ServiceInfo{}, s.Services...)
 }
 
 // AddDevice will add the specified DeviceInfo object to the Devices list
+// and to the gossip membership list.
+// Devices in other clusters are ignored.
 func (s *Server) AddDevice(d gopifinder.DeviceInfo) {
-	s.logDebug("Registering device", d.HostName, d.MachineID, d.IPAddress)
+	if s.addDevice(d) && s.Members != nil {
+		s.Members.Observe(d, true)
+	}
+}
+
+// getDevice returns the device with the specified MachineID from the Devices list.
+func (s *Server) getDevice(id string) (gopifinder.DeviceInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	for _, i := range s.Devices {
+		if i.MachineID == id {
+			return i, true
+		}
+	}
+	return gopifinder.DeviceInfo{}, false
+}
+
+// addDevice adds or updates the device in the Devices list.
+// Returns false if the device was ignored.
+func (s *Server) addDevice(d gopifinder.DeviceInfo) bool {
+	if !d.InCluster(s.Clusters) {
+		s.logDebug("Ignoring device in another cluster", deviceFields(d)...)
+		return false
+	}
+	if !s.checkDeviceKey(&d) {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isRemovedDevice(d) {
+		s.logDebug("Ignoring removed device", deviceFields(d)...)
+		return false
+	}
+	s.logDebug("Registering device", append(deviceFields(d), gopifinder.Field("ip", d.IPAddress))...)
+	for n, i := range s.Devices {
 		if i.MachineID == d.MachineID {
-			// Update the Device
-			i.HostName = d.HostName
-			i.IPAddress = d.IPAddress
-			i.Created = d.Created
-			return
+			// Update the Device.  The whole entry is replaced so that
+			// the device's signature still matches.
+			s.Devices[n] = d
+			return true
 		}
 	}
+	if len(s.Devices) >= s.getMaxDevices() {
+		s.rejectFull("device", d.HostName)
+		return false
+	}
 	// Add the device
 	s.Devices = append(s.Devices, d)
+	return true
 }
 
-// RemoveDevice removes the device with the specified ID from the Devices list.
-func (s *Server) RemoveDevice(id string) {
+// RemoveDevice removes the device with the specified ID from the Devices list,
+// along with all of its services.  The caller must be allowed to change all of
+// the device's services.
+// If replication is on, a tombstone for the device is sent to the other finder servers
+// so that they remove the device as well and do not add it back until it expires.
+// If this server does not hold the device, the tombstone removes the device from
+// the servers that do, unless it has restarted since.
+func (s *Server) RemoveDevice(id string, c Caller) error {
 	if id == "" {
-		return
+		return errors.New("Missing MachineID")
 	}
-	s.logDebug("Removing device for MachineID", id)
-	for n, i := range s.Devices {
+	if err := s.RemoveAllServices(id, c); err != nil {
+		return err
+	}
+	s.logDebug("Removing device", gopifinder.Field("machineID", id))
+	now := time.Now()
+	t := gopifinder.DeviceTombstone{
+		MachineID: id,
+		Removed:   now,
+		Expires:   now.Add(s.getTombstoneTTL()),
+	}
+	s.mu.RLock()
+	for _, i := range s.Devices {
 		if i.MachineID == id {
-			s.Devices = append(s.Devices[:n], s.Devices[n+1:]...)
-			return
+			t.Incarnation = i.Incarnation
+			break
 		}
 	}
-	s.RemoveAllServices(id)
+	s.mu.RUnlock()
+	s.ApplyDeviceTombstones([]gopifinder.DeviceTombstone{t})
+
+	if s.Features.Replication {
+		go func() {
+			rs := gopifinder.RegistrySync{Removed: []gopifinder.DeviceTombstone{t}}
+			for _, d := range s.getPeers() {
+				if _, err := s.Finder.SyncRegistry(d, rs); err != nil {
+					s.logError("Error removing device from peer", append(deviceFields(d), gopifinder.ErrField(err))...)
+				}
+			}
+		}()
+	}
+	return nil
 }
 
 // AddService adds the specified ServiceInfo object to the Service list
-func (s *Server) AddService(v gopifinder.ServiceInfo) error {
+// and replicates the registration to the other finder servers.
+// A service that does not name any clusters is registered in this server's clusters.
+// A new registration is owned by the caller.  An existing registration keeps its
+// owner and may only be updated by the owner or an admin.
+func (s *Server) AddService(v gopifinder.ServiceInfo, c Caller) error {
 	if v.MachineID == "" || v.ServiceName == "" {
 		return errors.New("Missing Service ID or Name")
 	}
+	if !c.Admin && !s.getPolicy().Allows(c.MachineID, c.PublicKey, v.ServiceName) {
+		s.logDebug("Policy does not allow service", gopifinder.Field("service", v.ServiceName), gopifinder.Field("machineID", v.MachineID))
+		return ErrForbidden
+	}
+	if len(v.Clusters) == 0 {
+		v.Clusters = s.Clusters
+	} else if !v.InCluster(s.Clusters) {
+		return errors.New("Service " + v.ServiceName + " is not registered in any of this server's clusters")
+	}
+	s.mu.Lock()
+	v.Owner = c.Owner
 	for _, i := range s.Services {
-		if i.MachineID == v.MachineID && i.ServiceName == v.ServiceName {
-			// Update the Service
-			s.logDebug("Updated ServiceName", i.ServiceName, "for MachineID", i.MachineID)
-			i.PortNo = v.PortNo
-			i.HostName = v.HostName
-			i.IPAddress = v.IPAddress
-			i.APIStub = v.APIStub
-			return nil
+		if i.IsSameService(v) {
+			if !c.CanChange(i) {
+				s.mu.Unlock()
+				return ErrForbidden
+			}
+			if i.Owner != "" {
+				v.Owner = i.Owner
+			}
+			break
 		}
 	}
-	// Add the service
-	s.logDebug("Added ServiceName", v.ServiceName, "for MachineID", v.MachineID)
-	s.Services = append(s.Services, v)
+	if s.isRegistryFull(v) {
+		s.mu.Unlock()
+		s.rejectFull("service", v.ServiceName)
+		return ErrRegistryFull
+	}
+	v.Origin = s.myMachineID()
+	v.Version = s.nextVersion()
+	v.Deleted = false
+	v.Updated = time.Now()
+	s.applyService(v)
+	s.mu.Unlock()
+
+	go s.replicate([]gopifinder.ServiceInfo{v})
 	return nil
 }
 
-// RemoveService removes the service for the specified MachineID from the Services list.
-func (s *Server) RemoveService(machineID string, serviceName string) error {
+// RemoveService removes the service for the specified MachineID from the Services list
+// and replicates the removal to the other finder servers.
+// The service may only be removed by its owner or an admin.
+func (s *Server) RemoveService(machineID string, serviceName string, c Caller) error {
 	if machineID == "" || serviceName == "" {
 		return errors.New("Missing MachineID or ServiceName")
 	}
-	for n, i := range s.Services {
+	s.mu.Lock()
+	for _, i := range s.Services {
 		if i.MachineID == machineID && i.ServiceName == serviceName {
-			s.logDebug("Removed ServiceName", serviceName, "for MachineID", machineID)
-			s.Services = append(s.Services[:n], s.Services[n+1:]...)
+			if !c.CanChange(i) {
+				s.mu.Unlock()
+				return ErrForbidden
+			}
+			r := s.newTombstone(i)
+			s.applyService(r)
+			s.mu.Unlock()
+
+			go s.replicate([]gopifinder.ServiceInfo{r})
 			return nil
 		}
 	}
+	s.mu.Unlock()
 	return nil
 }
 
 // RemoveAllServices removes all services associated with the specified MachineID
-// from the Services list
-func (s *Server) RemoveAllServices(machineID string) {
+// from the Services list and replicates the removals to the other finder servers.
+// No services are removed unless the caller may change all of them.
+func (s *Server) RemoveAllServices(machineID string, c Caller) error {
 	if machineID == "" {
-		return
+		return errors.New("Missing MachineID")
 	}
 
-	s.logDebug("Removing all services for MachineID", machineID)
+	s.logDebug("Removing all services", gopifinder.Field("machineID", machineID))
 
-	n := []gopifinder.ServiceInfo{}
+	s.mu.Lock()
+	l := []gopifinder.ServiceInfo{}
 	for _, i := range s.Services {
-		if i.MachineID != machineID {
-			n = append(n, i)
+		if i.MachineID == machineID {
+			if !c.CanChange(i) {
+				s.mu.Unlock()
+				return ErrForbidden
+			}
+			l = append(l, s.newTombstone(i))
 		}
 	}
-	s.Services = n
-}
-
-func (s *Server) logDebug(v ...interface{}) {
-	if s.VerboseLogging {
-		a := fmt.Sprint(v)
-		logger.Info("Server: ", a[1:len(a)-1])
+	for _, i := range l {
+		s.applyService(i)
 	}
-}
-
-func (s *Server) logInfo(v ...interface{}) {
-	a := fmt.Sprint(v)
-	logger.Info("Server: ", a[1:len(a)-1])
-}
+	s.mu.Unlock()
 
-func (s *Server) logError(v ...interface{}) {
-	a := fmt.Sprint(v)
-	logger.Error("Server: ", a[1:len(a)-1])
+	if len(l) != 0 {
+		go s.replicate(l)
+	}
+	return nil
 }
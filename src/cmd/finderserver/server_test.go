@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+// newTestServer returns a server with the MachineID "self" that logs nothing.
+func newTestServer() *Server {
+	return &Server{
+		Finder: &gopifinder.Finder{MyInfo: &gopifinder.DeviceInfo{MachineID: "self", HostName: "self"}},
+		Log:    gopifinder.NewLogger(gopifinder.NewWriterSink(ioutil.Discard, gopifinder.LogFormatText), gopifinder.NewLogLevels(gopifinder.LevelError)),
+	}
+}
+
+// newTestDevice returns a device that answers on the test server url.
+func newTestDevice(t *testing.T, id string, ts string) gopifinder.DeviceInfo {
+	u, err := url.Parse(ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+	return gopifinder.DeviceInfo{MachineID: id, HostName: id, IPAddress: []string{host}, PortNo: p}
+}
+
+func TestServersWithoutALoggerCanLog(t *testing.T) {
+	if s := NewServer(DefaultConfig()); s.Log == nil || s.LogLevels == nil {
+		t.Error("Expected NewServer to set up a logger")
+	}
+	s := &Server{}
+	if s.getLog("server") == nil {
+		t.Error("Expected a fallback logger")
+	}
+	s.logDebug("Logged without a logger")
+}
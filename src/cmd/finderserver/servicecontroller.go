@@ -1,8 +1,9 @@
 package main
 
 import (
-	"fmt"
+	"encoding/json"
 	"net/http"
+	"strings"
 
 	gopifinder "github.com/brumawen/gopi-finder/src"
 	"github.com/gorilla/mux"
@@ -17,33 +18,69 @@ type ServiceController struct {
 func (c *ServiceController) AddController(router *mux.Router, s *Server) {
 	c.Srv = s
 	router.Methods("POST").Path("/service/add").Name("AddService").
-		Handler(Logger(c, http.HandlerFunc(c.handleAddService)))
+		HandlerFunc(c.handleAddService)
 	router.Methods("DELETE").Path("/service/remove/{id}/{name}").Name("RemoveService").
-		Handler(Logger(c, http.HandlerFunc(c.handleRemoveService)))
+		HandlerFunc(c.handleRemoveService)
 	router.Methods("DELETE").Path("/service/remove/{id}").Name("RemoveAll").
-		Handler(Logger(c, http.HandlerFunc(c.handleRemoveAll)))
+		HandlerFunc(c.handleRemoveAll)
 	router.Methods("GET").Path("/service/get").Name("GetLocalServices").
-		Handler(Logger(c, http.HandlerFunc(c.handleGetLocal)))
+		HandlerFunc(c.handleGetLocal)
 	router.Methods("GET").Path("/service/search").Name("Search").
-		Handler(Logger(c, http.HandlerFunc(c.handleSearch)))
+		HandlerFunc(c.handleSearch)
+	if s.Features.ServiceDiscovery {
+		router.Methods("GET").Path("/service/sd").Name("ServiceDiscovery").
+			HandlerFunc(c.handleServiceDiscovery)
+	}
 
 }
 
 func (c *ServiceController) handleAddService(w http.ResponseWriter, r *http.Request) {
 	if r.ContentLength != 0 {
+		caller, ok := c.getCaller(w, r)
+		if !ok {
+			return
+		}
+
 		// Get the ServiceInfo List from the content
 		l := gopifinder.ServiceInfoList{}
 		if err := l.ReadFrom(r.Body); err != nil {
 			http.Error(w, err.Error(), 400)
-		} else {
-			for _, i := range l.Services {
-				// Register this service with the server
-				err = c.Srv.AddService(i)
-				if err != nil {
-					http.Error(w, err.Error(), 400)
+			return
+		}
+
+		token := ""
+		if caller.Owner == "" {
+			// Give the caller a token that owns the services it registers
+			t, err := gopifinder.NewToken()
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+			token = t
+			caller.Owner = gopifinder.TokenOwner(token)
+		}
+
+		added := 0
+		msgs := []string{}
+		var firstErr error
+		for _, i := range l.Services {
+			// Register this service with the server
+			if err := c.Srv.AddService(i, caller); err != nil {
+				if firstErr == nil {
+					firstErr = err
 				}
+				msgs = append(msgs, err.Error())
+			} else {
+				added++
 			}
 		}
+		if token != "" && added != 0 {
+			// The token is only needed if the caller owns a registration
+			w.Header().Set(gopifinder.HeaderToken, token)
+		}
+		if len(msgs) != 0 {
+			writeError(w, firstErr, strings.Join(msgs, ". "))
+		}
 	}
 }
 
@@ -53,9 +90,11 @@ func (c *ServiceController) handleRemoveService(w http.ResponseWriter, r *http.R
 	name := vars["name"]
 	if id == "" || name == "" {
 		http.Error(w, "Invalid ID or Name", 400)
-	} else {
+	} else if caller, ok := c.getCaller(w, r); ok {
 		// Remove the service from the server list
-		c.Srv.RemoveService(id, name)
+		if err := c.Srv.RemoveService(id, name, caller); err != nil {
+			writeError(w, err, err.Error())
+		}
 	}
 }
 
@@ -64,32 +103,76 @@ func (c *ServiceController) handleRemoveAll(w http.ResponseWriter, r *http.Reque
 	id := vars["id"]
 	if id == "" {
 		http.Error(w, "Invalid ID.", 400)
-	} else {
+	} else if caller, ok := c.getCaller(w, r); ok {
 		// Remove all services for this ID
-		c.Srv.RemoveAllServices(id)
+		if err := c.Srv.RemoveAllServices(id, caller); err != nil {
+			writeError(w, err, err.Error())
+		}
 	}
 }
 
 func (c *ServiceController) handleGetLocal(w http.ResponseWriter, r *http.Request) {
-	l := gopifinder.ServiceInfoList{Services: c.Srv.Services}
+	l := gopifinder.ServiceInfoList{Services: c.Srv.requestServices(r)}
 	if err := l.WriteTo(w); err != nil {
 		http.Error(w, "Error serializing Service list. "+err.Error(), 500)
 	}
 }
 
+// handleSearch handles the /service/search web method call.
+// The services are returned as a ServiceInfoList, or as a ServiceSearchResult listing
+// the devices that reported each service if the detail query parameter is true.
 func (c *ServiceController) handleSearch(w http.ResponseWriter, r *http.Request) {
-	if s, err := c.Srv.Finder.SearchForServices(); err != nil {
+	s, err := c.Srv.Finder.SearchForServices()
+	if err != nil {
 		http.Error(w, err.Error(), 400)
+		return
+	}
+	if r.URL.Query().Get("detail") == "true" {
+		err = s.WriteTo(w)
 	} else {
-		l := gopifinder.ServiceInfoList{Services: s}
-		if err := l.WriteTo(w); err != nil {
-			http.Error(w, "Error serializing Service list. "+err.Error(), 500)
+		l := gopifinder.ServiceInfoList{Services: s.ServiceInfos()}
+		err = l.WriteTo(w)
+	}
+	if err != nil {
+		http.Error(w, "Error serializing Service list. "+err.Error(), 500)
+	}
+}
+
+// handleServiceDiscovery returns the registered services as Prometheus http_sd_config
+// target groups.  The services can be filtered with name and tag query parameters,
+// which can be repeated or hold comma separated lists.
+func (c *ServiceController) handleServiceDiscovery(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	l := gopifinder.NewTargetGroups(c.Srv.requestServices(r), splitQuery(q["name"]), splitQuery(q["tag"]))
+	b, err := json.Marshal(l)
+	if err != nil {
+		http.Error(w, "Error serializing target groups. "+err.Error(), 500)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+}
+
+// splitQuery splits the comma separated query parameter values.
+func splitQuery(l []string) []string {
+	res := []string{}
+	for _, v := range l {
+		for _, i := range strings.Split(v, ",") {
+			if i = strings.TrimSpace(i); i != "" {
+				res = append(res, i)
+			}
 		}
 	}
+	return res
 }
 
-// LogInfo is used to log information messages for this controller.
-func (c *ServiceController) LogInfo(v ...interface{}) {
-	a := fmt.Sprint(v)
-	logger.Info("ServiceController: ", a[1:len(a)-1])
+// getCaller identifies the sender of the request.  Returns false if the
+// request's key signature is invalid, in which case the response has been written.
+func (c *ServiceController) getCaller(w http.ResponseWriter, r *http.Request) (Caller, bool) {
+	caller, err := c.Srv.NewCaller(r)
+	if err != nil {
+		http.Error(w, "Unauthorized. "+err.Error(), http.StatusUnauthorized)
+		return caller, false
+	}
+	return caller, true
 }
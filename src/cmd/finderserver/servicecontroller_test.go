@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+func TestAddServiceOnlyIssuesATokenForAddedServices(t *testing.T) {
+	s := newTestServer()
+	c := ServiceController{Srv: s}
+
+	r := httptest.NewRequest("POST", "/service/add", strings.NewReader(`{"services":[{"serviceName":"a"},{"serviceName":"b"}]}`))
+	w := httptest.NewRecorder()
+	c.handleAddService(w, r)
+	if w.Code != 400 {
+		t.Errorf("Expected the invalid services to be rejected, got %d", w.Code)
+	}
+	if w.Header().Get(gopifinder.HeaderToken) != "" {
+		t.Error("Expected no token to be issued when nothing was registered")
+	}
+	if n := strings.Count(strings.TrimSpace(w.Body.String()), "\n"); n != 0 {
+		t.Errorf("Expected a single error response, got %q", w.Body.String())
+	}
+
+	r = httptest.NewRequest("POST", "/service/add", strings.NewReader(`{"services":[{"serviceName":"a","machineID":"pi"}]}`))
+	w = httptest.NewRecorder()
+	c.handleAddService(w, r)
+	token := w.Header().Get(gopifinder.HeaderToken)
+	if w.Code != 200 || token == "" {
+		t.Fatalf("Expected the service to be registered with a token, got %d", w.Code)
+	}
+
+	// The token lets the caller update its registration
+	r = httptest.NewRequest("POST", "/service/add", strings.NewReader(`{"services":[{"serviceName":"a","machineID":"pi","portNo":80}]}`))
+	r.Header.Set(gopifinder.HeaderToken, token)
+	w = httptest.NewRecorder()
+	c.handleAddService(w, r)
+	if w.Code != 200 || w.Header().Get(gopifinder.HeaderToken) != "" {
+		t.Errorf("Expected the owner to update the service without a new token, got %d", w.Code)
+	}
+}
+
+func TestFullRegistryAsksTheCallerToRetry(t *testing.T) {
+	s := newTestServer()
+	s.MaxServices = 1
+	s.Services = []gopifinder.ServiceInfo{{ServiceName: "a", MachineID: "pi"}}
+	c := ServiceController{Srv: s}
+
+	r := httptest.NewRequest("POST", "/service/add", strings.NewReader(`{"services":[{"serviceName":"b","machineID":"pi"}]}`))
+	w := httptest.NewRecorder()
+	c.handleAddService(w, r)
+	if w.Code != 429 || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
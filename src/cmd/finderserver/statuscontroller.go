@@ -1,8 +1,10 @@
 package main
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
 	gopifinder "github.com/brumawen/gopi-finder/src"
 	"github.com/gorilla/mux"
@@ -13,11 +15,22 @@ type StatusController struct {
 	Srv *Server
 }
 
+// statusHistory holds the device status samples returned by /status/history.
+type statusHistory struct {
+	Interval string                    `json:"interval"` // The interval between the samples taken
+	Step     string                    `json:"step"`     // The period each returned sample covers, empty if not downsampled
+	Samples  []gopifinder.DeviceStatus `json:"samples"`  // The samples, oldest first
+}
+
 // AddController adds the routes associated with the controller to the router.
 func (c *StatusController) AddController(router *mux.Router, s *Server) {
 	c.Srv = s
 	router.Methods("GET").Path("/status/get").Name("GetStatus").
-		Handler(Logger(c, http.HandlerFunc(c.handleGetStatus)))
+		HandlerFunc(c.handleGetStatus)
+	if s.Features.StatusHistory {
+		router.Methods("GET").Path("/status/history").Name("GetStatusHistory").
+			HandlerFunc(c.handleGetStatusHistory)
+	}
 }
 
 func (c *StatusController) handleGetStatus(w http.ResponseWriter, r *http.Request) {
@@ -31,8 +44,49 @@ func (c *StatusController) handleGetStatus(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-// LogInfo is used to log information messages for this controller.
-func (c *StatusController) LogInfo(v ...interface{}) {
-	a := fmt.Sprint(v)
-	logger.Info("StatusController: ", a[1:len(a)-1])
+// handleGetStatusHistory handles the /status/history web method call.
+// The samples are limited to the since and until query parameters, which take the same
+// values as /log/get, and are downsampled to one sample per step if step is set.
+func (c *StatusController) handleGetStatusHistory(w http.ResponseWriter, r *http.Request) {
+	since, until, step, err := parseHistoryQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	h := statusHistory{
+		Interval: c.Srv.getStatusInterval().String(),
+		Samples:  c.Srv.history.Samples(since, until, step),
+	}
+	if step > 0 {
+		h.Step = step.String()
+	}
+	b, err := json.Marshal(h)
+	if err != nil {
+		http.Error(w, "Error serializing Status history. "+err.Error(), 500)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+}
+
+// parseHistoryQuery reads the since, until and step query parameters.
+func parseHistoryQuery(r *http.Request) (since time.Time, until time.Time, step time.Duration, err error) {
+	q := r.URL.Query()
+	now := time.Now()
+	if v := q.Get("since"); v != "" {
+		if since, err = gopifinder.ParseLogTime(v, now); err != nil {
+			return since, until, step, errors.New("Invalid since. " + err.Error())
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if until, err = gopifinder.ParseLogTime(v, now); err != nil {
+			return since, until, step, errors.New("Invalid until. " + err.Error())
+		}
+	}
+	if v := q.Get("step"); v != "" {
+		if step, err = time.ParseDuration(v); err != nil || step <= 0 {
+			return since, until, step, errors.New("Invalid step. Step must be a duration greater than 0, for example 5m")
+		}
+	}
+	return since, until, step, nil
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+const (
+	defaultStatusInterval = time.Minute          // Default interval between device status samples
+	defaultStatusSamples  = 1440                 // Default number of samples kept, a day at the default interval
+	statusHistoryFile     = "statushistory.json" // File the status history is saved to in the DataDir
+	statusSaveInterval    = 10 * time.Minute     // Interval between saves of the status history while running
+)
+
+// runStatusSampler adds a device status sample to the status history at each
+// status interval until the server exits.  The history is also saved every
+// statusSaveInterval, so that a power loss only loses the latest samples.
+func (s *Server) runStatusSampler() {
+	s.sampleStatus()
+	saved := time.Now()
+	t := time.NewTimer(s.getStatusInterval())
+	defer t.Stop()
+	for {
+		select {
+		case <-s.exit:
+			return
+		case <-t.C:
+			// The interval is read each time, as it can be changed by a reload
+			t.Reset(s.getStatusInterval())
+			s.sampleStatus()
+			if time.Since(saved) >= statusSaveInterval {
+				s.saveStatusHistory()
+				saved = time.Now()
+			}
+		}
+	}
+}
+
+// sampleStatus reads the device status and adds it to the history.  Values that
+// could not be read are left empty in the sample.  The sample also refreshes the
+// status reported on the /metrics endpoint.
+func (s *Server) sampleStatus() {
+	d, err := gopifinder.NewDeviceStatus()
+	if err != nil {
+		s.logDebug("Error getting device status", gopifinder.ErrField(err))
+	}
+	s.history.Add(d)
+
+	s.statusMu.Lock()
+	s.status, s.statusErr = d, err
+	s.statusMu.Unlock()
+}
+
+// loadStatusHistory reads the status history saved when the server last ran.
+func (s *Server) loadStatusHistory() {
+	if !s.getPersistStatus() {
+		return
+	}
+	if err := s.history.ReadFile(s.dataFile(statusHistoryFile)); err != nil && !os.IsNotExist(err) {
+		s.logError("Error reading status history", gopifinder.ErrField(err))
+	}
+}
+
+// saveStatusHistory saves the status history so that it survives a restart.
+func (s *Server) saveStatusHistory() {
+	if !s.getPersistStatus() {
+		return
+	}
+	if err := s.history.WriteFile(s.dataFile(statusHistoryFile)); err != nil {
+		s.logError("Error saving status history", gopifinder.ErrField(err))
+	}
+}
+
+// getStatusInterval returns the interval between device status samples.
+func (s *Server) getStatusInterval() time.Duration {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	if s.StatusInterval <= 0 {
+		return defaultStatusInterval
+	}
+	return s.StatusInterval
+}
+
+// getStatusSamples returns the number of device status samples kept in the history.
+func (s *Server) getStatusSamples() int {
+	if s.StatusSamples <= 0 {
+		return defaultStatusSamples
+	}
+	return s.StatusSamples
+}
+
+func (s *Server) getPersistStatus() bool {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.PersistStatus
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/brumawen/gopi-finder/src"
+)
+
+const (
+	defaultCertFile = "finderserver.crt" // Certificate file generated if none is configured
+	defaultKeyFile  = "finderserver.key" // Key file generated if none is configured
+)
+
+// setupTLS creates the server and client TLS configurations.
+// If no certificate has been configured, a self-signed certificate is generated
+// for this device and kept in the application folder.
+func (s *Server) setupTLS() (*tls.Config, *tls.Config, error) {
+	if s.MutualTLS && s.CAFile == "" {
+		return nil, nil, errors.New("A cluster CA file is required for mutual TLS")
+	}
+	if s.CertFile == "" || s.KeyFile == "" {
+		s.CertFile = s.dataFile(defaultCertFile)
+		s.KeyFile = s.dataFile(defaultKeyFile)
+		if err := s.generateCert(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+	if err != nil {
+		return nil, nil, errors.New("Error loading server certificate. " + err.Error())
+	}
+	srvConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if s.MutualTLS {
+		pool, err := gopifinder.LoadCertPool(s.CAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		srvConfig.ClientCAs = pool
+		srvConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	cliConfig, err := s.newClientTLSConfig(s.CertFile, s.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return srvConfig, cliConfig, nil
+}
+
+// newClientTLSConfig creates the TLS configuration used to connect to HTTPS peers,
+// presenting the certificate if one is specified.
+func (s *Server) newClientTLSConfig(certFile string, keyFile string) (*tls.Config, error) {
+	if s.TLSInsecure {
+		s.logWarn("tls insecure is set. Peer certificates will not be verified")
+	} else if s.CAFile == "" && s.TLS {
+		s.logWarn("No cluster CA has been configured. Peers with self-signed certificates cannot be reached unless tls insecure is set")
+	}
+	return gopifinder.NewClientTLSConfig(s.CAFile, certFile, keyFile, s.TLSInsecure)
+}
+
+// generateCert generates a self-signed certificate for this device if the
+// certificate files do not exist.
+func (s *Server) generateCert() error {
+	if _, err := os.Stat(s.CertFile); err == nil {
+		if _, err := os.Stat(s.KeyFile); err == nil {
+			return nil
+		}
+	}
+	info, err := gopifinder.NewDeviceInfo()
+	if err != nil {
+		return errors.New("Error getting device information for the certificate. " + err.Error())
+	}
+	hosts := append([]string{info.HostName, "localhost", "127.0.0.1"}, info.IPAddress...)
+	certPEM, keyPEM, err := gopifinder.GenerateCert(hosts, 10*365*24*time.Hour, nil, nil)
+	if err != nil {
+		return err
+	}
+	s.logInfo("Generated self-signed certificate", gopifinder.Field("file", s.CertFile))
+	return gopifinder.SaveCertAndKey(s.CertFile, s.KeyFile, certPEM, keyPEM)
+}
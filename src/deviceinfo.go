@@ -8,7 +8,6 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
-	"os/exec"
 	"strings"
 	"time"
 )
@@ -21,27 +20,36 @@ type DeviceInfo struct {
 	OS        string    `json:"os"`
 	PortNo    int       `json:"portNo"`
 	Created   time.Time `json:"created"`
+	TLS       bool      `json:"tls,omitempty"`       // Indicates the device serves HTTPS
+	PublicKey string    `json:"publicKey,omitempty"` // The device's base64 encoded ed25519 public key
+	Signature string    `json:"signature,omitempty"` // Signature of the device information by the device's private key
+	Signed    time.Time `json:"signed,omitempty"`    // The date and time the device information was signed
+	Untrusted bool      `json:"untrusted,omitempty"` // Indicates the device's key does not match the key pinned for its MachineID
+	Clusters  []string  `json:"clusters,omitempty"`  // Names of the clusters the device belongs to, empty for the default cluster
+	// Incarnation is set by the device when its finder starts and increases with each
+	// restart.  Unlike Created, it is not changed when the information is refreshed.
+	Incarnation int64 `json:"incarnation,omitempty"`
 }
 
 // NewDeviceInfo creates a new DeviceInfo struct and populates it with the values
 // for the current device
 func NewDeviceInfo() (DeviceInfo, error) {
+	return NewDeviceInfoFrom(LocalSystem)
+}
+
+// NewDeviceInfoFrom creates a DeviceInfo populated with the values read from the System.
+func NewDeviceInfoFrom(sys *System) (DeviceInfo, error) {
 	d := DeviceInfo{Created: time.Now()}
 
 	// Get the operating system
-	out, err := exec.Command("uname").Output()
+	platform, err := getOS(sys)
 	if err != nil {
-		if strings.Contains(err.Error(), "executable file not found") {
-			d.OS = "WindowsNT"
-		} else {
-			return d, errors.New("Error getting device Operating System. " + err.Error())
-		}
-	} else {
-		d.OS = strings.TrimSpace(string(out))
+		return d, err
 	}
+	d.OS = platform
 
 	// Get the Host Name
-	out, err = exec.Command("hostname").Output()
+	out, err := sys.Output("hostname")
 	if err != nil {
 		return d, errors.New("Error getting device HostName. " + err.Error())
 	}
@@ -49,7 +57,7 @@ func NewDeviceInfo() (DeviceInfo, error) {
 
 	// Get the Machine ID
 	if strings.ToLower(d.OS) == "linux" {
-		txt, err := ReadAllText("/etc/machine-id")
+		txt, err := sys.ReadFile("/etc/machine-id")
 		if err != nil {
 			return d, errors.New("Error getting device Machine-ID. " + err.Error())
 		}
@@ -68,7 +76,7 @@ func NewDeviceInfo() (DeviceInfo, error) {
 	}
 
 	// Get the IP addresses
-	ip, err := GetLocalIPAddresses()
+	ip, err := sys.IPAddresses()
 	if err != nil {
 		return d, errors.New("Error getting device IP addresses. " + err.Error())
 	}
@@ -93,12 +101,16 @@ func (d *DeviceInfo) CreateService(name string) ServiceInfo {
 // GetURL returns the URL for the specified web method.
 func (d *DeviceInfo) GetURL(idx int, method string) string {
 	if d.PortNo <= 0 {
-		d.PortNo = 20502
+		d.PortNo = DefaultPort
+	}
+	scheme := "http"
+	if d.TLS {
+		scheme = "https"
 	}
 	if len(d.IPAddress) < idx+1 {
-		return fmt.Sprintf("http://%s:%d%s", d.HostName, d.PortNo, method)
+		return fmt.Sprintf("%s://%s:%d%s", scheme, d.HostName, d.PortNo, method)
 	}
-	return fmt.Sprintf("http://%s:%d%s", d.IPAddress[idx], d.PortNo, method)
+	return fmt.Sprintf("%s://%s:%d%s", scheme, d.IPAddress[idx], d.PortNo, method)
 
 }
 
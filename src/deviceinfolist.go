@@ -5,6 +5,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
 )
 
 // DeviceInfoList holds a list of Device Information
@@ -54,3 +55,30 @@ func (d *DeviceInfoList) Deserialize(v string) error {
 	}
 	return nil
 }
+
+// SelectDevices returns the devices whose host name, machine ID or one of whose
+// IP addresses is in the list of names.  If the list is empty, every device is returned.
+func SelectDevices(dl []DeviceInfo, names []string) []DeviceInfo {
+	if len(names) == 0 {
+		return dl
+	}
+	l := []DeviceInfo{}
+	for _, d := range dl {
+		for _, n := range names {
+			if strings.EqualFold(n, d.HostName) || n == d.MachineID || inStrings(n, d.IPAddress) {
+				l = append(l, d)
+				break
+			}
+		}
+	}
+	return l
+}
+
+func inStrings(s string, l []string) bool {
+	for _, i := range l {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
@@ -6,260 +6,72 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
-	"os/exec"
-	"regexp"
-	"strconv"
-	"strings"
 	"time"
 )
 
 // DeviceStatus holds current status information about the Device
 type DeviceStatus struct {
-	HostName     string    `json:"hostName"`     // Current Host Name
-	OS           string    `json:"os"`           // OS Type
-	OSName       string    `json:"osName"`       // Operating System Name
-	OSVersion    string    `json:"osVersion"`    // Operating System version
-	HWType       string    `json:"hwType"`       // Hardware type
-	HWSerialNo   string    `json:"hwSerialNo"`   // Hardware SerialNo
-	CPUTemp      float64   `json:"cpuTemp"`      // CPU temperature in Celcius
-	GPUTemp      float64   `json:"gpuTemp"`      // GPU temperature in Celcius
-	IsThrottled  bool      `json:"isThrottled"`  // If CPU is currently throttled
-	DiskUsed     int64     `json:"freeDisk"`     // Disk Used Space in bytes
-	DiskUsedPerc int       `json:"freeDiskPerc"` // Disk Used Space in percentage
-	TotalMem     int64     `json:"totalMem"`     // Total Memory in bytes
-	AvailMem     int64     `json:"availMem"`     // Available Memory in bytes
-	Uptime       int       `json:"uptime"`       // CPU uptime in seconds
-	Created      time.Time `json:"created"`      // The date and time the status was created
+	HostName       string        `json:"hostName"`         // Current Host Name
+	OS             string        `json:"os"`               // OS Type
+	OSName         string        `json:"osName"`           // Operating System Name
+	OSVersion      string        `json:"osVersion"`        // Operating System version
+	HWType         string        `json:"hwType"`           // Hardware type, as named by earlier versions
+	HWSerialNo     string        `json:"hwSerialNo"`       // Hardware SerialNo
+	HWModel        string        `json:"hwModel"`          // Model decoded from the revision code
+	HWProcessor    string        `json:"hwProcessor"`      // Processor decoded from the revision code
+	HWMemory       int           `json:"hwMemory"`         // Memory size in MB decoded from the revision code
+	HWManufacturer string        `json:"hwManufacturer"`   // Manufacturer decoded from the revision code
+	HWRevision     string        `json:"hwRevision"`       // PCB revision decoded from the revision code
+	HWRevisionCode string        `json:"hwRevisionCode"`   // Revision code reported in /proc/cpuinfo
+	HWDeviceModel  string        `json:"hwDeviceModel"`    // Model reported in /proc/device-tree/model
+	CPUTemp        float64       `json:"cpuTemp"`          // CPU temperature in Celcius
+	GPUTemp        float64       `json:"gpuTemp"`          // GPU temperature in Celcius
+	IsThrottled    bool          `json:"isThrottled"`      // If CPU is currently throttled, bit 2 of Throttled
+	Throttled      uint64        `json:"throttled"`        // Throttled state bits reported by get_throttled
+	ThrottleState  ThrottleState `json:"throttleState"`    // Throttled state flags decoded from Throttled
+	DiskUsed       int64         `json:"freeDisk"`         // Available disk space, in 1K blocks on Linux and bytes on Windows
+	DiskUsedPerc   int           `json:"freeDiskPerc"`     // Used disk space percentage on Linux, available disk space percentage on Windows
+	TotalMem       int64         `json:"totalMem"`         // Total Memory in bytes
+	AvailMem       int64         `json:"availMem"`         // Available Memory in bytes
+	Uptime         int           `json:"uptime"`           // CPU uptime in seconds
+	Created        time.Time     `json:"created"`          // The date and time the status was created
+	Errors         []StatusError `json:"errors,omitempty"` // The errors returned by the status collectors that failed
 }
 
 // NewDeviceStatus creates a new DeviceStatus struct and populates it with the values
-// for the current device
+// for the current device.
+// After the host name, the values are read by the status collectors registered for
+// the device's operating system.  Values that cannot be read are left empty and the
+// collector's error is added to Errors.  An error is only returned if the operating
+// system cannot be found or none of the values could be read.
 func NewDeviceStatus() (DeviceStatus, error) {
-	d := DeviceStatus{Created: time.Now()}
-
-	//get hostname
-	out, err := exec.Command("hostname").Output()
-	if err != nil {
-		return d, errors.New("Error getting HostName. " + err.Error())
-	}
-	d.HostName = strings.TrimSpace(string(out))
-
-	// Get the operating system
-	out, err = exec.Command("uname").Output()
-	if err != nil {
-		if strings.Contains(err.Error(), "executable file not found") {
-			d.OS = "WindowsNT"
-		} else {
-			return d, errors.New("Error getting device Operating System. " + err.Error())
-		}
-	} else {
-		d.OS = strings.TrimSpace(string(out))
-	}
-
-	if d.OS == "Linux" {
-		err = d.loadValuesForLinux()
-	} else if d.OS == "WindowsNT" {
-		err = d.loadValuesForWindows()
-	}
-	return d, err
+	return NewDeviceStatusFrom(LocalSystem)
 }
 
-func (d *DeviceStatus) loadValuesForLinux() error {
-	//get operating system info
-	re := regexp.MustCompile("PRETTY_NAME=\"([\\w\\d\\s/()]+)\"")
-	txt, err := ReadAllText("/etc/os-release")
-	if err != nil {
-		return errors.New("Error getting OS Information. " + err.Error())
-	}
-	m := re.FindStringSubmatch(txt)
-	if len(m) >= 2 {
-		d.OSName = m[1]
-	}
-
-	txt, err = ReadAllText("/etc/debian_version")
-	if err != nil {
-		return errors.New("Error getting OS Version. " + err.Error())
-	}
-	d.OSVersion = strings.TrimSpace(txt)
-
-	//get hardware type
-	re = regexp.MustCompile("Revision\\s:\\s([a-e\\d]+)")
-	re1 := regexp.MustCompile("Serial\\s\\s:\\s([a-f\\d]*)")
-	txt, err = ReadAllText("/proc/cpuinfo")
-	if err != nil {
-		return errors.New("Error getting Hardware type. " + err.Error())
-	}
-	m = re.FindStringSubmatch(txt)
-	if len(m) >= 2 {
-		d.HWType = getHardwareType(m[1])
-	}
-	m = re1.FindStringSubmatch(txt)
-	if len(m) >= 2 {
-		d.HWSerialNo = m[1]
-	}
-
-	//get cpu temperature
-	txt, err = ReadAllText("/sys/class/thermal/thermal_zone0/temp")
-	if err != nil {
-		return errors.New("Error getting CPU temperature. " + err.Error())
-	}
-	v, err := strconv.ParseFloat(strings.TrimSpace(txt), 64)
-	if err != nil {
-		return errors.New("Could not parse CPU Temperature. " + txt)
-	}
-	d.CPUTemp = v / 1000
-
-	// Find vcgencmd path (used for both GPU temperature and throttled status)
-	vcgencmd, err := findVcgencmd()
-	if err != nil {
-		return errors.New("Error finding vcgencmd. " + err.Error())
-	}
-
-	//get gpu temperature
-	out, err := exec.Command(vcgencmd, "measure_temp").Output()
-	if err != nil {
-		return errors.New("Error getting GPU temperature. " + err.Error())
-	}
-	txt = string(out)
-	txt = txt[5 : len(txt)-3]
-	v, err = strconv.ParseFloat(txt, 64)
-	if err != nil {
-		return errors.New("Error parsing GPU temperature. " + err.Error())
-	}
-	d.GPUTemp = v
-
-	//get throttled status
-	out, err = exec.Command(vcgencmd, "get_throttled").Output()
-	if err != nil {
-		return errors.New("Error getting Throttled state. " + err.Error())
-	}
-	txt = string(out)
-	txt = txt[12 : len(txt)-1]
-	u, err := strconv.ParseUint(txt, 16, 64)
-	if err != nil {
-		return errors.New("Error parsing Throttled State. " + err.Error())
-	}
-	d.IsThrottled = (u&2 == 2)
-
-	//get disk space
-	re = regexp.MustCompile("/dev/[\\w]+\\s*(\\d*)\\s*(\\d*)\\s*(\\d*)\\s*(\\d*)%\\s+/\\n")
-	out, err = exec.Command("df").Output()
+// NewDeviceStatusFrom creates a DeviceStatus populated with the values read from the System.
+func NewDeviceStatusFrom(sys *System) (DeviceStatus, error) {
+	d := DeviceStatus{Created: time.Now()}
+	platform, err := getOS(sys)
 	if err != nil {
-		return errors.New("Error getting Disk space. " + err.Error())
-	}
-	m = re.FindStringSubmatch(string(out))
-	if len(m) >= 5 {
-		v, err := strconv.ParseInt(m[3], 10, 64)
-		if err != nil {
-			return errors.New("Error parsing Disk space. " + err.Error())
-		}
-		d.DiskUsed = v
-
-		n, err := strconv.Atoi(m[4])
-		if err != nil {
-			return errors.New("Error parsing Disk percentage. " + err.Error())
-		}
-		d.DiskUsedPerc = n
+		return d, err
 	}
+	d.OS = platform
 
-	//get available memory
-	re = regexp.MustCompile("MemAvailable:\\s*(\\d*)")
-	re1 = regexp.MustCompile("MemTotal:\\s*(\\d*)")
-	txt, err = ReadAllText("/proc/meminfo")
-	if err != nil {
-		return errors.New("Error getting available memory. " + err.Error())
-	}
-	m = re.FindStringSubmatch(txt)
-	if len(m) >= 2 {
-		v, err := strconv.ParseInt(m[1], 10, 64)
-		if err != nil {
-			return errors.New("Error parsing available memory. " + err.Error())
-		}
-		d.AvailMem = v
+	l := append([]StatusCollector{NewStatusCollector("host", collectHostName)}, StatusCollectors(d.OS)...)
+	if d.collectStatus(sys, l) == len(l) {
+		return d, errors.New("Error getting device status. " + d.Errors[0].Message)
 	}
-	m = re1.FindStringSubmatch(txt)
-	if len(m) >= 2 {
-		v, err := strconv.ParseInt(m[1], 10, 64)
-		if err != nil {
-			return errors.New("Error parsing totoal memory. " + err.Error())
-		}
-		d.TotalMem = v
-	}
-
-	//get uptime
-	txt, err = ReadAllText("/proc/uptime")
-	if err != nil {
-		return errors.New("Error getting system uptime. " + err.Error())
-	}
-	i := strings.IndexRune(txt, '.')
-	if i >= 0 {
-		v, err := strconv.Atoi(txt[:i])
-		if err != nil {
-			return errors.New("Error parsing system uptime. " + err.Error())
-		}
-		d.Uptime = v
-	}
-	return nil
+	return d, nil
 }
 
-func (d *DeviceStatus) loadValuesForWindows() error {
-	// Get the operating system information
-	out, err := exec.Command("wmic", "os", "get", "/value").Output()
-	if err != nil {
-		return errors.New("Error getting Operating System information. " + err.Error())
-	}
-	arr := strings.Split(strings.TrimSpace(string(out)), "\n")
-	for _, i := range arr {
-		if strings.HasPrefix(i, "Caption=") {
-			d.OSName = strings.TrimSpace(i[8:])
-		}
-		if strings.HasPrefix(i, "FreePhysicalMemory=") {
-			d.AvailMem = ConvToInt64(i[19:], 0)
-		}
-		if strings.HasPrefix(i, "LastBootUpTime=") {
-			t := ConvToDate(i[15:])
-			d.Uptime = int(time.Since(t).Seconds())
-		}
-		if strings.HasPrefix(i, "Version=") {
-			d.OSVersion = strings.TrimSpace(i[8:])
-		}
-	}
-
-	// Get the baseboard information
-	out, err = exec.Command("wmic", "baseboard", "get", "/value").Output()
-	if err != nil {
-		return errors.New("Error getting Baseboard information. " + err.Error())
-	}
-	arr = strings.Split(strings.TrimSpace(string(out)), "\n")
-	for _, i := range arr {
-		if strings.HasPrefix(i, "SerialNumber=") {
-			d.HWSerialNo = strings.TrimSpace(i[13:])
-			break
-		}
-		if strings.HasPrefix(i, "Manufacturer=") {
-			d.HWType = strings.TrimSpace(i[13:])
+// CollectorFailed returns whether or not the named status collector failed to read its values.
+func (d *DeviceStatus) CollectorFailed(name string) bool {
+	for _, i := range d.Errors {
+		if i.Collector == name {
+			return true
 		}
 	}
-
-	// Get the logical disk information
-	out, err = exec.Command("wmic", "logicaldisk", "get", "/value").Output()
-	if err != nil {
-		return errors.New("Error getting Baseboard information. " + err.Error())
-	}
-	arr = strings.Split(strings.TrimSpace(string(out)), "\n")
-	for _, i := range arr {
-		if strings.HasPrefix(i, "FreeSpace=") {
-			d.DiskUsed = ConvToInt64(i[10:], 0)
-		}
-		if strings.HasPrefix(i, "Size=") {
-			n := ConvToInt64(i[5:], 0)
-			d.DiskUsedPerc = int(float64(d.DiskUsed) / float64(n) * float64(100))
-			break
-		}
-	}
-
-	return nil
+	return false
 }
 
 // ReadFrom reads the string from the reader and deserializes it into the entity values
@@ -306,20 +118,20 @@ func (d *DeviceStatus) Deserialize(v string) error {
 }
 
 // findVcgencmd finds the vcgencmd executable in common locations
-func findVcgencmd() (string, error) {
+func findVcgencmd(sys *System) (string, error) {
 	// First try to find it in PATH
-	if path, err := exec.LookPath("vcgencmd"); err == nil {
+	if path, err := sys.LookPath("vcgencmd"); err == nil {
 		return path, nil
 	}
 
 	// Try common installation paths
 	commonPaths := []string{
-		"/usr/bin/vcgencmd",      // New Raspberry Pi OS (Bullseye+)
-		"/opt/vc/bin/vcgencmd",   // Old Raspberry Pi OS
+		"/usr/bin/vcgencmd",    // New Raspberry Pi OS (Bullseye+)
+		"/opt/vc/bin/vcgencmd", // Old Raspberry Pi OS
 	}
 
 	for _, path := range commonPaths {
-		if _, err := os.Stat(path); err == nil {
+		if sys.Exists(path) {
 			return path, nil
 		}
 	}
@@ -327,6 +139,8 @@ func findVcgencmd() (string, error) {
 	return "", errors.New("vcgencmd not found in PATH or common locations")
 }
 
+// getHardwareType returns the hardware type reported by earlier versions for the revision code.
+// The name is kept as it was, as clients match on it, and new boards are Unknown Model.
 func getHardwareType(code string) string {
 	switch code {
 	case "0002", "0003":
@@ -1,6 +1,7 @@
 package gopifinder
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 )
@@ -10,5 +11,38 @@ func TestCanGetStatus(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+	if s.HostName == "" || s.OS == "" {
+		t.Error("Expected the host name and OS to be read, got", s.HostName, s.OS)
+	}
 	fmt.Println(s)
 }
+
+func TestFailingCollectorOnlyLeavesItsOwnValuesEmpty(t *testing.T) {
+	d := DeviceStatus{}
+	failed := d.collectStatus(LocalSystem, []StatusCollector{
+		NewStatusCollector("cpu", func(sys *System, d *DeviceStatus) error {
+			d.CPUTemp = 45.5
+			return nil
+		}),
+		NewStatusCollector("gpu", func(sys *System, d *DeviceStatus) error {
+			d.GPUTemp = 50
+			return errors.New("vcgencmd not found")
+		}),
+		NewStatusCollector("memory", func(sys *System, d *DeviceStatus) error {
+			d.TotalMem = 1024
+			return nil
+		}),
+	})
+	if failed != 1 {
+		t.Error("Expected 1 failed collector, got", failed)
+	}
+	if d.CPUTemp != 45.5 || d.TotalMem != 1024 {
+		t.Error("Expected the values of the other collectors to be kept, got", d)
+	}
+	if d.GPUTemp != 0 {
+		t.Error("Expected the failing collector's value to be left empty, got", d.GPUTemp)
+	}
+	if len(d.Errors) != 1 || d.Errors[0].Collector != "gpu" || d.Errors[0].Message != "vcgencmd not found" {
+		t.Error("Expected the gpu error to be listed, got", d.Errors)
+	}
+}
@@ -0,0 +1,47 @@
+package gopifinder
+
+import "time"
+
+// DeviceTombstone records the removal of a device from the finder servers.
+// While the tombstone has not expired, information about the device from the same
+// or an earlier incarnation is ignored, which stops peers from adding the device back.
+// The device only comes back before the tombstone expires if its finder restarts.
+type DeviceTombstone struct {
+	MachineID   string    `json:"machineID"`   // The MachineID of the removed device
+	Incarnation int64     `json:"incarnation"` // The incarnation of the device when it was removed, 0 if it was not known
+	Removed     time.Time `json:"removed"`     // The date and time the device was removed
+	Expires     time.Time `json:"expires"`     // The date and time the tombstone expires
+}
+
+// IsExpired returns whether or not the tombstone has expired.
+func (t *DeviceTombstone) IsExpired() bool {
+	return time.Now().After(t.Expires)
+}
+
+// Suppresses returns whether or not the specified device information must be
+// ignored because of this tombstone.  Only the device's own incarnation is
+// compared, so the clocks of the device and the server that removed it do not matter.
+// If the server that removed the device did not know its incarnation, every
+// incarnation started before the removal is suppressed, which does rely on the clocks.
+func (t *DeviceTombstone) Suppresses(d DeviceInfo) bool {
+	return d.MachineID == t.MachineID && !t.IsExpired() && d.Incarnation <= t.lastIncarnation()
+}
+
+// Supersedes returns whether or not the tombstone replaces the other tombstone
+// for the same device.
+func (t *DeviceTombstone) Supersedes(o DeviceTombstone) bool {
+	if a, b := t.lastIncarnation(), o.lastIncarnation(); a != b {
+		return a > b
+	}
+	return t.Expires.After(o.Expires)
+}
+
+// lastIncarnation returns the last incarnation of the device that is suppressed.
+// Incarnations are set from the device's clock when its finder starts, so an unknown
+// incarnation is taken to be the last one started before the device was removed.
+func (t *DeviceTombstone) lastIncarnation() int64 {
+	if t.Incarnation == 0 {
+		return t.Removed.UnixNano()
+	}
+	return t.Incarnation
+}
@@ -2,58 +2,108 @@ package gopifinder
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"math/rand"
+	"net"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/kardianos/service"
 )
 
+// DefaultPort is the port number finder servers listen on if none is configured.
+const DefaultPort = 20502
+
 // Finder will search for and hold a list of devices available on the local network.
 type Finder struct {
 	PortNo         int            // Port number to attempt to connect to
-	Devices        []DeviceInfo   // List of discovered devices
+	Devices        []DeviceInfo   // List of discovered devices, set before the Finder is used and read with DeviceList
 	VerboseLogging bool           // Switch on verbose logging
 	Timeout        int            // The timeout in seconds to wait for a response from the LAN IP probe
 	LastSearch     time.Time      // The date and time the last search was made
 	ForceSearch    bool           // Indicates if a search must occur
 	IsServer       bool           // Indicates this instance is a finder server
 	MyInfo         *DeviceInfo    // The machine's device information
-	Logger         service.Logger // The logger
+	Logger         service.Logger // The service logger, used if Log is not set
+	Log            *Logger        // The structured logger
+	RegisterAcks   int            // The number of acknowledgements RegisterServices waits for, 0 waits for all devices
+	RetryCount     int            // The number of times a failed registration is retried
+	RetryDelay     time.Duration  // The initial delay between registration retries, doubled on each retry
+	Seeds          []string       // IP addresses to probe instead of searching the whole LAN
+	Secret         string         // Shared cluster secret used to sign requests, if set
+	UseTLS         bool           // Indicates the LAN probe and this device's information use HTTPS
+	TLSConfig      *tls.Config    // The TLS configuration used to connect to HTTPS peers
+	Identity       *Identity      // The identity used to sign this device's information, if set
+	Clusters       []string       // Names of the clusters this device belongs to, peers in other clusters are ignored
+	Token          string         // Token identifying this caller as the owner of the services it registers
+	TokenFile      string         // File the Token is kept in, so that the services are still owned after a restart
+	Interfaces     []string       // Names of the network interfaces whose LANs are searched, empty searches all of them
+	mu             sync.RWMutex   // Guards Devices
+	cfgMu          sync.RWMutex   // Guards Timeout, Seeds, Interfaces and Secret once the Finder is in use
+	tokenMu        sync.Mutex     // Guards Token
+	fallbackLog    *Logger        // The logger used if Log is not set
+	logOnce        sync.Once      // Builds the fallbackLog
+	incarnation    int64          // The incarnation of this device, set on the first call to GetMyInfo
+	transport      *http.Transport
+	transportOnce  sync.Once
 }
 
 // FindDevices searches the local LANs for devices.
 // This will initiate a LAN wide search for each local IP address associated with
-// the current device.
+// the current device, unless a list of Seeds has been set, in which case
+// only the seed addresses are probed.
 func (f *Finder) FindDevices() ([]DeviceInfo, error) {
 	// Clear array
+	f.mu.Lock()
 	f.Devices = []DeviceInfo{}
+	f.mu.Unlock()
 	if f.PortNo <= 0 {
-		f.PortNo = 20502
-	}
-	if f.Timeout <= 0 {
-		f.Timeout = 2
+		f.PortNo = DefaultPort
 	}
 	f.ForceSearch = false
 
 	f.logDebug("Starting search...")
 
-	ipLst, err := GetLocalIPAddresses()
+	c := make(chan DeviceInfo)
+
+	timeout := time.After(f.getTimeout() * 5)
+
+	if seeds := f.getSeeds(); len(seeds) != 0 {
+		// Only probe the seed addresses
+		for _, ip := range seeds {
+			f.logDebug("Probing seed address", Field("ip", ip))
+			myIP := ip
+			go func() { c <- f.checkIfOnline(myIP) }()
+		}
+		for i := 0; i < len(seeds); i++ {
+			select {
+			case result := <-c:
+				f.AddDevice(result)
+			case <-timeout:
+				break
+			}
+		}
+		f.logDebug("Completed search.")
+		f.LastSearch = time.Now()
+		return f.DeviceList(), nil
+	}
+
+	ipLst, err := GetInterfaceIPAddresses(f.getInterfaces())
 	if err != nil {
 		return nil, errors.New("Error getting Local IP Addresses. " + err.Error())
 	}
 
-	c := make(chan DeviceInfo)
-
-	timeout := time.After(time.Duration(f.Timeout*5) * time.Second)
-
 	// Start the goroutines looking for device on the networks
 	count := 0
 	for _, ip := range ipLst {
-		f.logDebug("FindDevices: Searching LAN for IP Address", ip)
+		f.logDebug("Searching LAN", Field("ip", ip))
 		scanList, err := GetPotentialAddresses(ip)
 		if err != nil {
 			return nil, errors.New("Error getting potential IP scan list. " + err.Error())
@@ -78,13 +128,27 @@ func (f *Finder) FindDevices() ([]DeviceInfo, error) {
 	f.logDebug("Completed search.")
 
 	f.LastSearch = time.Now()
-	return f.Devices, nil
+	return f.DeviceList(), nil
 }
 
 // GetMyInfo returns the latest device information for the current device.
+// If the Finder has an Identity, the device information is signed.
 func (f *Finder) GetMyInfo() (DeviceInfo, bool, error) {
 	if f.MyInfo == nil || len(f.MyInfo.IPAddress) == 0 || time.Since(f.MyInfo.Created).Minutes() > 5 {
 		info, err := NewDeviceInfo()
+		info.TLS = f.UseTLS
+		info.Clusters = f.Clusters
+		if f.incarnation == 0 {
+			// The device's own clock orders its restarts
+			f.incarnation = time.Now().UnixNano()
+		}
+		info.Incarnation = f.incarnation
+		if f.PortNo > 0 {
+			info.PortNo = f.PortNo
+		}
+		if err == nil && f.Identity != nil {
+			err = f.Identity.SignDevice(&info)
+		}
 		f.MyInfo = &info
 		return info, true, err
 	}
@@ -93,22 +157,67 @@ func (f *Finder) GetMyInfo() (DeviceInfo, bool, error) {
 
 // RegisterServices registers the list of services with the
 // registered devices on the network.
-func (f *Finder) RegisterServices(sl []ServiceInfo) error {
+// The call blocks until RegisterAcks devices have acknowledged the registration,
+// or until every device has answered if RegisterAcks is 0.  Failed registrations
+// are retried RetryCount times with an exponential backoff.
+// A result is returned for each device.  Devices that had not answered by the time
+// enough acknowledgements were received are returned with ErrRegistrationPending.
+// Services that do not name any clusters are registered in the Finder's clusters.
+// The services are owned by the Finder's Identity, if set, or by its Token.  If the
+// Finder has neither, the Token is read from the TokenFile, or created and written to
+// the TokenFile if there is none, as it is needed to update or remove the services later.
+func (f *Finder) RegisterServices(sl []ServiceInfo) ([]RegisterResult, error) {
+	sl, err := f.prepareServices(sl)
+	if err != nil {
+		return nil, err
+	}
+
 	// First contact a device to get the list of devices
 	devList, err := f.getCurrentDeviceList()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if len(devList) == 0 {
+		return []RegisterResult{}, errors.New("No devices found to register the services with")
 	}
 
-	for _, i := range devList {
+	acks := f.RegisterAcks
+	if acks <= 0 || acks > len(devList) {
+		acks = len(devList)
+	}
+
+	// Buffer the channel so that registrations still in progress
+	// when we return do not block
+	type indexedResult struct {
+		idx int
+		res RegisterResult
+	}
+	c := make(chan indexedResult, len(devList))
+	resList := make([]RegisterResult, len(devList))
+	for n, i := range devList {
+		resList[n] = RegisterResult{Device: i, Err: ErrRegistrationPending}
 		d := i
-		for n := 0; n < len(i.IPAddress); n++ {
-			ln := n
-			go f.registerServices(d, ln, sl)
+		idx := n
+		go func() { c <- indexedResult{idx: idx, res: f.registerWithDevice(d, sl)} }()
+	}
+
+	// Now listen for the results
+	ackCount := 0
+	for i := 0; i < len(devList) && ackCount < acks; i++ {
+		result := <-c
+		r := result.res
+		resList[result.idx] = r
+		if r.Acknowledged() {
+			ackCount++
+		} else {
+			f.logError("Error registering services", Field("host", r.Device.HostName), Field("machineID", r.Device.MachineID), ErrField(r.Err))
 		}
 	}
 
-	return nil
+	if ackCount < acks {
+		return resList, fmt.Errorf("Registration was only acknowledged by %d of %d devices", ackCount, acks)
+	}
+	return resList, nil
 }
 
 // SearchForDevices will search the registered devices for services that match the
@@ -123,49 +232,279 @@ func (f *Finder) SearchForDevices() ([]DeviceInfo, error) {
 	return devList, nil
 }
 
-// SearchForServices will search the registered devices for services that match the
-// list of service names specified.
-func (f *Finder) SearchForServices() ([]ServiceInfo, error) {
+// SearchForServices will search the registered devices for the services registered with them.
+// Each device is asked once, and each service is returned once along with the devices
+// that reported it.  The result indicates whether the search timed out before every
+// device had answered.
+func (f *Finder) SearchForServices() (ServiceSearchResult, error) {
+	res := ServiceSearchResult{Services: []FoundService{}}
 	// First contact a device to get the list of devices
-	srvList := []ServiceInfo{}
 	devList, err := f.getCurrentDeviceList()
 	if err != nil {
-		return srvList, err
+		return res, err
 	}
 
-	c := make(chan []ServiceInfo)
-	timeout := time.After(time.Duration(f.Timeout) * time.Second)
+	type deviceServices struct {
+		machineID string
+		services  []ServiceInfo
+		seen      time.Time
+	}
+	// Buffer the channel so that devices answering after a timeout do not block
+	c := make(chan deviceServices, len(devList))
+	timeout := time.After(f.getTimeout())
 
 	for _, i := range devList {
 		d := i
-		for n := 0; n < len(i.IPAddress); n++ {
-			ln := n
-			go func() { c <- f.scanForServices(d, ln) }()
-		}
+		go func() {
+			l := FilterServices(f.scanForServices(d), f.Clusters)
+			c <- deviceServices{machineID: d.MachineID, services: l, seen: time.Now()}
+		}()
 	}
 
 	// Now listen for the results
-	for i := 0; i < len(devList); i++ {
+	for i := 0; i < len(devList) && !res.TimedOut; i++ {
 		select {
 		case result := <-c:
-			for _, r := range result {
-				srvList = append(srvList, r)
-			}
+			res.Add(result.machineID, result.services, result.seen)
 		case <-timeout:
-			break
+			f.logDebug("Service search timed out", Field("answered", i), Field("devices", len(devList)))
+			res.TimedOut = true
 		}
 	}
 
-	return srvList, nil
+	return res, nil
 }
 
-func (f *Finder) getURL(ip string, method string) string {
-	return fmt.Sprintf("http://%s:%d%s", ip, f.PortNo, method)
+// CollectLogs reads the log entries matching the query from every known device, and
+// merges them into a single timeline tagged with the host name of each device.
+// See CollectLogsFrom.
+func (f *Finder) CollectLogs(ctx context.Context, q LogQuery) (LogCollectionResult, error) {
+	devList, err := f.getCurrentDeviceList()
+	if err != nil {
+		return LogCollectionResult{}, err
+	}
+	return f.CollectLogsFrom(ctx, devList, q), nil
+}
+
+// CollectLogsFrom reads the log entries matching the query from each of the devices
+// in parallel.  The query's Lines limit the entries read from each device, and Follow
+// is ignored.  Devices that fail to answer before the context is done are listed in
+// the result along with their error.
+func (f *Finder) CollectLogsFrom(ctx context.Context, devList []DeviceInfo, q LogQuery) LogCollectionResult {
+	res := LogCollectionResult{Entries: []HostLogEntry{}, Failed: []DeviceError{}}
+	q.Follow = false
+
+	type deviceLogs struct {
+		device  DeviceInfo
+		entries []LogEntry
+		err     error
+	}
+	c := make(chan deviceLogs, len(devList))
+	for _, i := range devList {
+		d := i
+		go func() {
+			l, err := f.readLogs(ctx, d, q)
+			c <- deviceLogs{device: d, entries: l, err: err}
+		}()
+	}
+
+	for i := 0; i < len(devList); i++ {
+		result := <-c
+		if result.err != nil {
+			f.logDebug("Error reading logs", Field("host", result.device.HostName), Field("machineID", result.device.MachineID), ErrField(result.err))
+			res.Failed = append(res.Failed, NewDeviceError(result.device, result.err))
+			continue
+		}
+		res.Add(result.device, result.entries)
+	}
+	res.Sort()
+	return res
+}
+
+// readLogs reads the log entries matching the query from the device.
+func (f *Finder) readLogs(ctx context.Context, d DeviceInfo, q LogQuery) ([]LogEntry, error) {
+	v := q.Values()
+	v.Set("format", "json")
+	l := []LogEntry{}
+	if err := f.getJSON(ctx, d, "/log/get?"+v.Encode(), &l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// CollectStatus reads the status of every device in parallel.
+// The devices are found as they are by SearchForDevices.
+func (f *Finder) CollectStatus(ctx context.Context) (StatusCollectionResult, error) {
+	devList, err := f.getCurrentDeviceList()
+	if err != nil {
+		return StatusCollectionResult{}, err
+	}
+	return f.CollectStatusFrom(ctx, devList), nil
+}
+
+// CollectStatusFrom reads the status of each of the devices in parallel.  Devices that
+// fail to answer before the context is done are listed in the result along with their error.
+func (f *Finder) CollectStatusFrom(ctx context.Context, devList []DeviceInfo) StatusCollectionResult {
+	res := StatusCollectionResult{Devices: []HostStatus{}, Failed: []DeviceError{}}
+
+	type deviceStatus struct {
+		status HostStatus
+		err    error
+	}
+	c := make(chan deviceStatus, len(devList))
+	for _, i := range devList {
+		d := i
+		go func() {
+			s := DeviceStatus{}
+			err := f.getJSON(ctx, d, "/status/get", &s)
+			c <- deviceStatus{status: HostStatus{Device: d, Status: s}, err: err}
+		}()
+	}
+
+	for i := 0; i < len(devList); i++ {
+		result := <-c
+		if result.err != nil {
+			d := result.status.Device
+			f.logDebug("Error reading status", Field("host", d.HostName), Field("machineID", d.MachineID), ErrField(result.err))
+			res.Failed = append(res.Failed, NewDeviceError(d, result.err))
+			continue
+		}
+		res.Devices = append(res.Devices, result.status)
+	}
+	res.Sort()
+	return res
+}
+
+// getJSON sends a GET request for the path to the device and decodes the JSON response
+// into v, trying each of the device's IP addresses in turn until one answers.
+func (f *Finder) getJSON(ctx context.Context, d DeviceInfo, path string, v interface{}) error {
+	// Reading a journal or the device status can take a while, so allow longer than a probe
+	client := f.newClient(f.getTimeout() * 5)
+	var err error
+	for n := 0; n < len(d.IPAddress) || n == 0; n++ {
+		var req *http.Request
+		req, err = f.newRequest("GET", d.GetURL(n, path), nil)
+		if err != nil {
+			return err
+		}
+		var response *http.Response
+		response, err = client.Do(req.WithContext(ctx))
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+		if err = checkResponse(response); err == nil {
+			if err = json.NewDecoder(response.Body).Decode(v); err != nil {
+				err = errors.New("Error reading response. " + err.Error())
+			}
+		}
+		response.Body.Close()
+		return err
+	}
+	return err
+}
+
+// SetTimeout sets the Timeout while the Finder is in use.
+func (f *Finder) SetTimeout(seconds int) {
+	f.cfgMu.Lock()
+	defer f.cfgMu.Unlock()
+	f.Timeout = seconds
+}
+
+// SetSeeds sets the Seeds probed by the next search while the Finder is in use.
+func (f *Finder) SetSeeds(seeds []string) {
+	f.cfgMu.Lock()
+	defer f.cfgMu.Unlock()
+	f.Seeds = seeds
+}
+
+// SetInterfaces sets the Interfaces searched by the next search while the Finder is in use.
+func (f *Finder) SetInterfaces(names []string) {
+	f.cfgMu.Lock()
+	defer f.cfgMu.Unlock()
+	f.Interfaces = names
+}
+
+// SetSecret sets the Secret used to sign requests while the Finder is in use.
+func (f *Finder) SetSecret(secret string) {
+	f.cfgMu.Lock()
+	defer f.cfgMu.Unlock()
+	f.Secret = secret
+}
+
+// getTimeout returns the time to wait for a response from a device, 2 seconds if no Timeout is set.
+func (f *Finder) getTimeout() time.Duration {
+	f.cfgMu.RLock()
+	defer f.cfgMu.RUnlock()
+	if f.Timeout <= 0 {
+		return 2 * time.Second
+	}
+	return time.Duration(f.Timeout) * time.Second
+}
+
+// getSeeds returns the Seeds.
+func (f *Finder) getSeeds() []string {
+	f.cfgMu.RLock()
+	defer f.cfgMu.RUnlock()
+	return f.Seeds
+}
+
+// getInterfaces returns the Interfaces.
+func (f *Finder) getInterfaces() []string {
+	f.cfgMu.RLock()
+	defer f.cfgMu.RUnlock()
+	return f.Interfaces
+}
+
+// getSecret returns the Secret.
+func (f *Finder) getSecret() string {
+	f.cfgMu.RLock()
+	defer f.cfgMu.RUnlock()
+	return f.Secret
+}
+
+// probeSchemes returns the schemes used to probe an address, the Finder's own scheme first.
+func (f *Finder) probeSchemes() []string {
+	if f.UseTLS {
+		return []string{"https", "http"}
+	}
+	return []string{"http", "https"}
+}
+
+func (f *Finder) getURL(scheme string, ip string, method string) string {
+	return fmt.Sprintf("%s://%s:%d%s", scheme, ip, f.PortNo, method)
+}
+
+// isUnreachable returns whether or not the error shows that nothing answered at
+// the address, rather than a server that speaks a different scheme.
+func isUnreachable(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// newClient returns a http client with the specified timeout that uses the
+// Finder's TLS configuration to connect to HTTPS peers.
+func (f *Finder) newClient(timeout time.Duration) *http.Client {
+	f.transportOnce.Do(func() {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		if f.TLSConfig != nil {
+			t.TLSClientConfig = f.TLSConfig.Clone()
+		}
+		f.transport = t
+	})
+	return &http.Client{Timeout: timeout, Transport: f.transport}
 }
 
 func (f *Finder) getCurrentDeviceList() ([]DeviceInfo, error) {
 	f.logDebug("Getting current device list.")
-	if len(f.Devices) == 0 {
+	devList := f.DeviceList()
+	if len(devList) == 0 {
 		f.logDebug("Local list is empty.  Searching for devices.")
 		return f.FindDevices()
 	}
@@ -175,8 +514,8 @@ func (f *Finder) getCurrentDeviceList() ([]DeviceInfo, error) {
 		// Send a message to each of our current devices and
 		// accept the device list from the first response back
 		c := make(chan []DeviceInfo)
-		timeout := time.After(time.Duration(f.Timeout) * time.Second)
-		for _, i := range f.Devices {
+		timeout := time.After(f.getTimeout())
+		for _, i := range devList {
 			d := i
 			for n := 0; n < len(i.IPAddress); n++ {
 				ln := n
@@ -186,21 +525,29 @@ func (f *Finder) getCurrentDeviceList() ([]DeviceInfo, error) {
 		// Listen for the first response
 		select {
 		case result := <-c:
-			f.Devices = []DeviceInfo{}
-			for _, r := range result {
-				f.Devices = append(f.Devices, r)
-			}
+			f.mu.Lock()
+			f.Devices = append([]DeviceInfo{}, result...)
+			f.mu.Unlock()
 		case <-timeout:
 			f.logDebug("Search timed out.")
 			break
 		}
 	}
 	f.ForceSearch = false
-	return f.Devices, nil
+	return f.DeviceList(), nil
+}
+
+// DeviceList returns a copy of the list of discovered devices.
+func (f *Finder) DeviceList() []DeviceInfo {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return append([]DeviceInfo{}, f.Devices...)
 }
 
 // AddDevice adds the specified device to the devices list
 func (f *Finder) AddDevice(d DeviceInfo) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	isNew := true
 	if d.MachineID == "" {
 		isNew = false
@@ -217,44 +564,80 @@ func (f *Finder) AddDevice(d DeviceInfo) {
 	}
 }
 
+// RemoveDevice removes the device with the specified ID from the devices list
+func (f *Finder) RemoveDevice(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for n, i := range f.Devices {
+		if i.MachineID == id {
+			f.Devices = append(f.Devices[:n], f.Devices[n+1:]...)
+			return
+		}
+	}
+}
+
 func (f *Finder) checkIfOnline(ip string) DeviceInfo {
 	d := DeviceInfo{}
 
-	// Try to call the online web service of the device
-	timeout := time.Duration(time.Duration(f.Timeout) * time.Second)
-	client := http.Client{Timeout: timeout}
+	// Try to call the online web service of the device.  The address is probed with
+	// the Finder's own scheme first, and with the other scheme if a server answered
+	// but could not be spoken to, so that HTTP and HTTPS servers can find each other.
+	timeout := f.getTimeout()
+	client := f.newClient(timeout)
+	var body []byte
+	method := "GET"
 	if f.IsServer {
 		// Send the current server's DeviceInfo in the call as well
 		b := new(bytes.Buffer)
 		json.NewEncoder(b).Encode(f.MyInfo)
-		if response, err := client.Post(f.getURL(ip, "/online"), "application/json;charset=utf-8", b); err == nil {
-			if response.ContentLength != 0 {
-				if err := d.ReadFrom(response.Body); err != nil {
-					f.logError("Error reading Online Response from", ip, err.Error())
-				}
+		body = b.Bytes()
+		method = "POST"
+	}
+	for _, scheme := range f.probeSchemes() {
+		response, err := f.send(client, method, f.getURL(scheme, ip, "/online"), body)
+		if err != nil {
+			if isUnreachable(err) {
+				break
 			}
+			continue
 		}
-	} else {
-		if response, err := client.Get(f.getURL(ip, "/online")); err == nil {
-			if response.ContentLength != 0 {
-				if err := d.ReadFrom(response.Body); err != nil {
-					f.logError("Error reading Online Response from", ip, err.Error())
-				}
+		if response.StatusCode == http.StatusBadRequest && scheme == "http" {
+			// An HTTPS server rejects plain HTTP requests
+			response.Body.Close()
+			continue
+		}
+		if response.ContentLength != 0 {
+			if err := d.ReadFrom(response.Body); err != nil {
+				f.logError("Error reading Online Response", Field("ip", ip), ErrField(err))
 			}
 		}
+		response.Body.Close()
+		break
+	}
+	if d.IsSigned() {
+		if err := d.VerifySignature(); err != nil {
+			f.logError("Ignoring device", Field("ip", ip), ErrField(err))
+			return DeviceInfo{}
+		}
+	}
+	if d.MachineID != "" && !d.InCluster(f.Clusters) {
+		f.logDebug("Ignoring device in another cluster", Field("host", d.HostName), Field("machineID", d.MachineID), Field("ip", ip))
+		return DeviceInfo{}
 	}
 	return d
 }
 
-func (f *Finder) scanForServices(d DeviceInfo, ipNo int) []ServiceInfo {
-	client := http.Client{}
-	if response, err := client.Get(d.GetURL(ipNo, "/service/get")); err != nil {
-		time.Sleep(time.Duration(f.Timeout+1) * time.Second)
-	} else {
-		if response.ContentLength != 0 {
+// scanForServices gets the services registered with the device, trying each of the
+// device's IP addresses in turn until one answers.
+func (f *Finder) scanForServices(d DeviceInfo) []ServiceInfo {
+	client := f.newClient(f.getTimeout())
+	for n := 0; n < len(d.IPAddress) || n == 0; n++ {
+		if response, err := f.get(client, d.GetURL(n, "/service/get")); err == nil {
 			siList := ServiceInfoList{}
-			if err := siList.ReadFrom(response.Body); err != nil {
-				f.logError("Error reading Service List response from", d.HostName, err.Error())
+			err := siList.ReadFrom(response.Body)
+			response.Body.Close()
+			if err != nil {
+				f.logError("Error reading Service List response", Field("host", d.HostName), Field("machineID", d.MachineID), ErrField(err))
 			} else {
 				return siList.Services
 			}
@@ -264,51 +647,260 @@ func (f *Finder) scanForServices(d DeviceInfo, ipNo int) []ServiceInfo {
 }
 
 func (f *Finder) scanForDevices(d DeviceInfo, ipNo int) []DeviceInfo {
-	client := http.Client{}
-	if response, err := client.Get(d.GetURL(ipNo, "/device/get")); err != nil {
-		time.Sleep(time.Duration(f.Timeout+1) * time.Second)
+	client := f.newClient(0)
+	if response, err := f.get(client, d.GetURL(ipNo, "/device/get")); err != nil {
+		time.Sleep(f.getTimeout() + time.Second)
 	} else {
 		if response.ContentLength != 0 {
 			diList := DeviceInfoList{}
 			if err := diList.ReadFrom(response.Body); err != nil {
-				f.logError("Error reading Device List response from", d.HostName, err.Error())
+				f.logError("Error reading Device List response", Field("host", d.HostName), Field("machineID", d.MachineID), ErrField(err))
 			} else {
-				return diList.Devices
+				return FilterDevices(diList.Devices, f.Clusters)
 			}
 		}
 	}
 	return []DeviceInfo{}
 }
 
-func (f *Finder) registerServices(d DeviceInfo, ipNo int, sl []ServiceInfo) error {
+// RegisterServicesWith registers the list of services with the specified IP address
+// of a single device, without retrying.  The request is signed and owned in the same
+// way as the requests sent by RegisterServices.
+func (f *Finder) RegisterServicesWith(d DeviceInfo, ipNo int, sl []ServiceInfo) error {
+	sl, err := f.prepareServices(sl)
+	if err != nil {
+		return err
+	}
+	_, err = f.registerServices(d, ipNo, sl)
+	return err
+}
+
+// prepareServices loads the Finder's Token if it has no owner credential and
+// returns the services with the Finder's clusters set on those that name none.
+func (f *Finder) prepareServices(sl []ServiceInfo) ([]ServiceInfo, error) {
+	if err := f.loadToken(); err != nil {
+		return nil, err
+	}
+	if len(f.Clusters) == 0 {
+		return sl, nil
+	}
+	l := make([]ServiceInfo, len(sl))
+	for n, i := range sl {
+		if len(i.Clusters) == 0 {
+			i.Clusters = f.Clusters
+		}
+		l[n] = i
+	}
+	return l, nil
+}
+
+// loadToken sets the Token if the Finder has no owner credential, reading it from the
+// TokenFile or creating a new one.
+func (f *Finder) loadToken() error {
+	f.tokenMu.Lock()
+	defer f.tokenMu.Unlock()
+	if f.Token != "" || f.Identity != nil {
+		return nil
+	}
+	if f.TokenFile != "" {
+		t, err := ReadToken(f.TokenFile)
+		if err != nil {
+			return err
+		}
+		if t != "" {
+			f.Token = t
+			return nil
+		}
+	}
+	t, err := NewToken()
+	if err != nil {
+		return err
+	}
+	return f.setToken(t)
+}
+
+// keepToken keeps the token a finder server issued for a registration, unless the
+// Finder already has an owner credential.
+func (f *Finder) keepToken(t string) {
+	f.tokenMu.Lock()
+	defer f.tokenMu.Unlock()
+	if f.Token == "" && f.Identity == nil {
+		if err := f.setToken(t); err != nil {
+			f.logError("Error keeping the registration token", ErrField(err))
+		}
+	}
+}
+
+// setToken sets the Token and writes it to the TokenFile, if there is one.
+// The caller must hold the token lock.
+func (f *Finder) setToken(t string) error {
+	f.Token = t
+	if f.TokenFile != "" {
+		return WriteToken(f.TokenFile, t)
+	}
+	return nil
+}
+
+// getToken returns the Token.
+func (f *Finder) getToken() string {
+	f.tokenMu.Lock()
+	defer f.tokenMu.Unlock()
+	return f.Token
+}
+
+// registerWithDevice registers the list of services with the device, trying each of the
+// device's IP addresses in turn and retrying with an exponential backoff on failure.
+func (f *Finder) registerWithDevice(d DeviceInfo, sl []ServiceInfo) RegisterResult {
+	r := RegisterResult{Device: d}
+	ipCount := len(d.IPAddress)
+	if ipCount == 0 {
+		// GetURL falls back to the host name
+		ipCount = 1
+	}
+	for attempt := 0; attempt <= f.RetryCount; attempt++ {
+		if attempt > 0 {
+			time.Sleep(f.getRetryDelay(attempt))
+		}
+		r.Attempts = attempt + 1
+		for n := 0; n < ipCount; n++ {
+			if n < len(d.IPAddress) {
+				r.IPAddress = d.IPAddress[n]
+			}
+			r.StatusCode, r.Err = f.registerServices(d, n, sl)
+			if r.Err == nil {
+				return r
+			}
+			f.logDebug("Registration attempt failed", Field("attempt", r.Attempts), Field("host", d.HostName), Field("machineID", d.MachineID), ErrField(r.Err))
+		}
+		if !isRetryableStatus(r.StatusCode) {
+			break
+		}
+	}
+	return r
+}
+
+// getRetryDelay returns the delay before the specified retry attempt.
+// The delay doubles with each attempt and has up to 50% random jitter added to it.
+func (f *Finder) getRetryDelay(attempt int) time.Duration {
+	delay := f.RetryDelay
+	if delay <= 0 {
+		delay = 500 * time.Millisecond
+	}
+	for i := 1; i < attempt && delay < time.Minute; i++ {
+		delay = delay * 2
+	}
+	if delay > time.Minute {
+		delay = time.Minute
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// isRetryableStatus returns whether or not a registration that failed with the
+// specified HTTP status code should be retried.
+// A status code of 0 indicates that no response was received.
+func isRetryableStatus(code int) bool {
+	return code == 0 || code == http.StatusTooManyRequests || code >= 500
+}
+
+func (f *Finder) registerServices(d DeviceInfo, ipNo int, sl []ServiceInfo) (int, error) {
 	// Create a ServiceInfoList object that will be used to hold the ServiceInfo slice
 	siList := ServiceInfoList{Services: sl}
 	// Post the list to the device
-	client := http.Client{}
+	client := f.newClient(f.getTimeout())
 	b := new(bytes.Buffer)
 	json.NewEncoder(b).Encode(siList)
-	if _, err := client.Post(d.GetURL(ipNo, "/service/add"), "application/json;charset=utf-8", b); err != nil {
-		return err
+	req, err := f.newRequest("POST", d.GetURL(ipNo, "/service/add"), b.Bytes())
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	if t := f.getToken(); t != "" {
+		// Only registrations carry the token, so that it is not sent to every device probed
+		req.Header.Set(HeaderToken, t)
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if t := response.Header.Get(HeaderToken); t != "" {
+		f.keepToken(t)
+	}
+	return response.StatusCode, checkResponse(response)
 }
 
-func (f *Finder) logDebug(v ...interface{}) {
-	if f.VerboseLogging {
-		a := fmt.Sprint(v...)
-		if f.Logger == nil {
-			log.Println(a)
-		} else {
-			f.Logger.Info("Finder: ", a)
+// get sends a GET request to the url, signing it if a Secret has been set.
+func (f *Finder) get(client *http.Client, url string) (*http.Response, error) {
+	return f.send(client, "GET", url, nil)
+}
+
+// post sends a POST request with the JSON body to the url, signing it if a Secret has been set.
+func (f *Finder) post(client *http.Client, url string, body []byte) (*http.Response, error) {
+	return f.send(client, "POST", url, body)
+}
+
+func (f *Finder) send(client *http.Client, method string, url string, body []byte) (*http.Response, error) {
+	req, err := f.newRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// newRequest creates a request with the Finder's cluster header.  The request is
+// signed with the Secret and the Identity if they have been set.
+func (f *Finder) newRequest(method string, url string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("content-type", "application/json;charset=utf-8")
+	}
+	if len(f.Clusters) != 0 {
+		req.Header.Set(HeaderCluster, strings.Join(f.Clusters, ","))
+	}
+	if secret := f.getSecret(); secret != "" {
+		if err := SignRequest(req, secret, body); err != nil {
+			return nil, err
 		}
 	}
+	if f.Identity != nil {
+		if err := f.Identity.SignRequest(req, body); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
 }
 
-func (f *Finder) logError(v ...interface{}) {
-	a := fmt.Sprint(v...)
-	if f.Logger == nil {
-		log.Println(a)
-	} else {
-		f.Logger.Error("Finder: ", a)
+// stderrSink is shared by the fallback loggers of every Finder, so that their
+// records to standard error are not interleaved.
+var stderrSink = NewWriterSink(os.Stderr, LogFormatText)
+
+// getLog returns the logger used by the finder.  If no Log has been set, records are
+// written to the service Logger or to standard error, and debug records are only
+// written if VerboseLogging is on.  The fallback logger is built on first use.
+func (f *Finder) getLog() *Logger {
+	if f.Log != nil {
+		return f.Log
 	}
+	f.logOnce.Do(func() {
+		level := LevelInfo
+		if f.VerboseLogging {
+			level = LevelDebug
+		}
+		var sink LogSink = stderrSink
+		if f.Logger != nil {
+			sink = NewServiceSink(f.Logger, LogFormatText)
+		}
+		f.fallbackLog = NewLogger(sink, NewLogLevels(level)).Named("finder")
+	})
+	return f.fallbackLog
+}
+
+func (f *Finder) logDebug(msg string, fields ...LogField) {
+	f.getLog().Debug(msg, fields...)
+}
+
+func (f *Finder) logError(msg string, fields ...LogField) {
+	f.getLog().Error(msg, fields...)
 }
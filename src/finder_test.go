@@ -1,7 +1,18 @@
 package gopifinder
 
-import "testing"
-import "fmt"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
 
 func TestCanFindDevices(t *testing.T) {
 	f := Finder{}
@@ -14,3 +25,251 @@ func TestCanFindDevices(t *testing.T) {
 	}
 
 }
+
+// newTestDevice creates a DeviceInfo that points at the specified test server.
+func newTestDevice(t *testing.T, id string, ts *httptest.Server) DeviceInfo {
+	host, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+	return DeviceInfo{MachineID: id, HostName: id, IPAddress: []string{host}, PortNo: p}
+}
+
+func TestRegisterServicesReturnsResultPerDevice(t *testing.T) {
+	var okCount, failCount int32
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&okCount, 1)
+	}))
+	defer ok.Close()
+	fail := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failCount, 1)
+		http.Error(w, "Unavailable", 503)
+	}))
+	defer fail.Close()
+
+	f := Finder{
+		Timeout:    1,
+		RetryCount: 2,
+		RetryDelay: time.Millisecond,
+		Devices:    []DeviceInfo{newTestDevice(t, "ok", ok), newTestDevice(t, "fail", fail)},
+	}
+	l, err := f.RegisterServices([]ServiceInfo{{ServiceName: "Test", MachineID: "ok"}})
+	if err == nil {
+		t.Error("Expected an error when a device rejects the registration.")
+	}
+	if len(l) != 2 {
+		t.Fatal("Expected 2 results, got", len(l))
+	}
+	if !l[0].Acknowledged() || l[0].StatusCode != 200 || atomic.LoadInt32(&okCount) != 1 {
+		t.Error("Expected the first device to acknowledge the registration.", l[0])
+	}
+	if l[1].Acknowledged() || l[1].StatusCode != 503 {
+		t.Error("Expected the second device to reject the registration.", l[1])
+	}
+	if n := atomic.LoadInt32(&failCount); l[1].Attempts != 3 || n != 3 {
+		t.Error("Expected 3 attempts on the failing device, got", l[1].Attempts, n)
+	}
+}
+
+func TestRegisterServicesWaitsForRequiredAcks(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ok.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	f := Finder{
+		Timeout:      2,
+		RegisterAcks: 1,
+		Devices:      []DeviceInfo{newTestDevice(t, "slow", slow), newTestDevice(t, "ok", ok)},
+	}
+	l, err := f.RegisterServices([]ServiceInfo{{ServiceName: "Test", MachineID: "ok"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l[0].Err != ErrRegistrationPending {
+		t.Error("Expected the slow device to still be pending.", l[0])
+	}
+	if !l[1].Acknowledged() {
+		t.Error("Expected the second device to acknowledge the registration.", l[1])
+	}
+}
+
+func TestRegistrationTokenIsKeptAndPersisted(t *testing.T) {
+	tokens := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(HeaderToken)
+		if token == "" {
+			token = "issued"
+			w.Header().Set(HeaderToken, token)
+		}
+		tokens <- token
+	}))
+	defer ts.Close()
+	d := newTestDevice(t, "server", ts)
+	sl := []ServiceInfo{{ServiceName: "Test", MachineID: "m1"}}
+
+	file := filepath.Join(t.TempDir(), "token")
+	for n := 0; n < 2; n++ {
+		// A new Finder stands in for a restarted service
+		f := Finder{TokenFile: file}
+		if err := f.RegisterServicesWith(d, 0, sl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a, b := <-tokens, <-tokens; a == "issued" || a != b {
+		t.Errorf("Expected the token to be read back from the file, got %q then %q", a, b)
+	}
+
+	for n := 0; n < 2; n++ {
+		if err := (&ServiceInfoList{Services: sl}).RegisterWith(nil, d, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a, b := <-tokens, <-tokens; a != b {
+		t.Errorf("Expected registrations without a Finder to share a token, got %q then %q", a, b)
+	}
+
+	// A Finder that has no token keeps the one the server issues
+	f := Finder{}
+	if _, err := f.registerServices(d, 0, sl); err != nil {
+		t.Fatal(err)
+	}
+	<-tokens
+	if f.Token != "issued" {
+		t.Errorf("Expected the issued token to be kept, got %q", f.Token)
+	}
+}
+
+func TestSearchForServicesDeduplicatesResults(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := ServiceInfoList{Services: []ServiceInfo{{ServiceName: "Test", MachineID: "m1"}}}
+		l.WriteTo(w)
+	})
+	a := httptest.NewServer(handler)
+	defer a.Close()
+	b := httptest.NewServer(handler)
+	defer b.Close()
+
+	f := Finder{
+		Timeout: 1,
+		Devices: []DeviceInfo{newTestDevice(t, "a", a), newTestDevice(t, "b", b)},
+	}
+	res, err := f.SearchForServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TimedOut {
+		t.Error("Did not expect the search to time out.")
+	}
+	if len(res.Services) != 1 {
+		t.Fatal("Expected 1 service, got", len(res.Services))
+	}
+	if len(res.Services[0].ReportedBy) != 2 {
+		t.Error("Expected the service to be reported by 2 devices, got", res.Services[0].ReportedBy)
+	}
+}
+
+func TestSearchForServicesReportsTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(1500 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	f := Finder{
+		Timeout: 1,
+		Devices: []DeviceInfo{newTestDevice(t, "slow", slow)},
+	}
+	res, err := f.SearchForServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.TimedOut {
+		t.Error("Expected the search to time out.")
+	}
+}
+
+func TestCollectLogsMergesDevicesIntoOneTimeline(t *testing.T) {
+	logs := func(l ...LogEntry) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/log/get" || r.URL.Query().Get("format") != "json" || r.URL.Query().Get("unit") != "app" {
+				http.Error(w, "Unexpected request "+r.URL.String(), 400)
+				return
+			}
+			json.NewEncoder(w).Encode(l)
+		})
+	}
+	t0 := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	a := httptest.NewServer(logs(LogEntry{Time: t0, Message: "a1"}, LogEntry{Time: t0.Add(2 * time.Minute), Message: "a2"}))
+	defer a.Close()
+	b := httptest.NewServer(logs(LogEntry{Time: t0.Add(time.Minute), Message: "b1"}))
+	defer b.Close()
+	fail := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "The log may not be read", 403)
+	}))
+	defer fail.Close()
+
+	f := Finder{
+		Timeout: 1,
+		Devices: []DeviceInfo{newTestDevice(t, "a", a), newTestDevice(t, "b", b), newTestDevice(t, "fail", fail)},
+	}
+	q := NewLogQuery()
+	q.Unit = "app"
+	res, err := f.CollectLogs(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ""
+	for _, e := range res.Entries {
+		got += e.HostName + ":" + e.Message + " "
+	}
+	if got != "a:a1 b:b1 a:a2 " {
+		t.Error("Unexpected timeline", got)
+	}
+	if len(res.Failed) != 1 || res.Failed[0].Device.MachineID != "fail" {
+		t.Error("Expected the failing device to be reported, got", res.Failed)
+	}
+
+	if l := SelectDevices(f.Devices, []string{"B", "127.0.0.9"}); len(l) != 1 || l[0].MachineID != "b" {
+		t.Error("Expected to select device b, got", l)
+	}
+}
+
+func TestCollectStatusListsUnderVoltageDevices(t *testing.T) {
+	status := func(d DeviceStatus) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/status/get" {
+				http.Error(w, "Unexpected request "+r.URL.String(), 400)
+				return
+			}
+			json.NewEncoder(w).Encode(d)
+		})
+	}
+	ok := httptest.NewServer(status(DeviceStatus{}))
+	defer ok.Close()
+	now := httptest.NewServer(status(DeviceStatus{Throttled: 0x1, ThrottleState: DecodeThrottled(0x1)}))
+	defer now.Close()
+	before := httptest.NewServer(status(DeviceStatus{Throttled: 0x50000, ThrottleState: DecodeThrottled(0x50000)}))
+	defer before.Close()
+
+	f := Finder{
+		Timeout: 1,
+		Devices: []DeviceInfo{newTestDevice(t, "ok", ok), newTestDevice(t, "now", now), newTestDevice(t, "before", before)},
+	}
+	res, err := f.CollectStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Devices) != 3 || len(res.Failed) != 0 {
+		t.Fatal("Expected the status of every device, got", res.Devices, res.Failed)
+	}
+	got := ""
+	for _, i := range res.UnderVoltage() {
+		got += i.Device.HostName + " "
+	}
+	if got != "before now " {
+		t.Error("Unexpected under-voltage devices", got)
+	}
+}
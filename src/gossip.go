@@ -0,0 +1,37 @@
+package gopifinder
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SendPing sends a gossip probe directly to the specified finder server and returns
+// the server's acknowledgement.
+func (f *Finder) SendPing(d DeviceInfo, msg GossipMessage, timeout time.Duration) (GossipMessage, error) {
+	return f.sendGossip(d, "/gossip/ping", msg, timeout)
+}
+
+// SendPingReq asks the specified finder server to probe the message Target on the
+// sender's behalf.  The acknowledgement of the Target is returned if it responded.
+func (f *Finder) SendPingReq(d DeviceInfo, msg GossipMessage, timeout time.Duration) (GossipMessage, error) {
+	return f.sendGossip(d, "/gossip/pingreq", msg, timeout)
+}
+
+func (f *Finder) sendGossip(d DeviceInfo, method string, msg GossipMessage, timeout time.Duration) (GossipMessage, error) {
+	ack := GossipMessage{}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return ack, err
+	}
+	client := f.newClient(timeout)
+	response, err := f.post(client, d.GetURL(0, method), b)
+	if err != nil {
+		return ack, err
+	}
+	defer response.Body.Close()
+	if err := checkResponse(response); err != nil {
+		return ack, err
+	}
+	err = json.NewDecoder(response.Body).Decode(&ack)
+	return ack, err
+}
@@ -0,0 +1,230 @@
+package gopifinder
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeviceSignatureMaxAge is how long signed device information is accepted for after
+// it was signed.  Devices sign their information again each time it is refreshed.
+const DeviceSignatureMaxAge = 24 * time.Hour
+
+// Identity holds the ed25519 keypair that identifies a device.
+// The public key is included in the device's DeviceInfo, which is signed with the
+// private key so that peers can detect another device claiming the same MachineID.
+type Identity struct {
+	PublicKey  ed25519.PublicKey
+	privateKey ed25519.PrivateKey
+}
+
+// LoadIdentity reads the device's private key from the specified file.
+// If the file does not exist, a new keypair is generated and saved to the file.
+func LoadIdentity(path string) (*Identity, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return newIdentity(path)
+	}
+	if err != nil {
+		return nil, errors.New("Error reading identity key. " + err.Error())
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("Identity key file " + path + " is not PEM encoded")
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("Error parsing identity key. " + err.Error())
+	}
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("Identity key is not an ed25519 key")
+	}
+	return &Identity{PublicKey: key.Public().(ed25519.PublicKey), privateKey: key}, nil
+}
+
+func newIdentity(path string) (*Identity, error) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.New("Error generating identity key. " + err.Error())
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, errors.New("Error encoding identity key. " + err.Error())
+	}
+	b := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		return nil, errors.New("Error writing identity key. " + err.Error())
+	}
+	return &Identity{PublicKey: pub, privateKey: key}, nil
+}
+
+// EncodedPublicKey returns the base64 encoded public key.
+func (i *Identity) EncodedPublicKey() string {
+	return base64.StdEncoding.EncodeToString(i.PublicKey)
+}
+
+// SignDevice sets the device's PublicKey and signs the device information.
+// The device information must not be changed after it has been signed.
+func (i *Identity) SignDevice(d *DeviceInfo) error {
+	d.PublicKey = i.EncodedPublicKey()
+	d.Signed = time.Now().UTC()
+	d.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(i.privateKey, d.signedBytes()))
+	return nil
+}
+
+// IsSigned returns whether or not the device information has been signed.
+func (d *DeviceInfo) IsSigned() bool {
+	return d.PublicKey != "" && d.Signature != ""
+}
+
+// VerifySignature verifies that the device information was signed by the private key
+// belonging to the device's PublicKey, and that the signature is not older than
+// DeviceSignatureMaxAge, so that old device information cannot be replayed.
+func (d *DeviceInfo) VerifySignature() error {
+	if !d.IsSigned() {
+		return errors.New("Device information is not signed")
+	}
+	pub, err := base64.StdEncoding.DecodeString(d.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errors.New("Invalid device public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(d.Signature)
+	if err != nil {
+		return errors.New("Invalid device signature")
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pub), d.signedBytes(), sig) {
+		return errors.New("Device signature does not match the device information")
+	}
+	age := time.Since(d.Signed)
+	if age > DeviceSignatureMaxAge {
+		return errors.New("Device signature has expired")
+	}
+	if age < -5*time.Minute {
+		return errors.New("Device signature is dated in the future")
+	}
+	return nil
+}
+
+// signedBytes returns the bytes of the device information that are signed.
+// Only this fixed set of fields is signed, so that fields added to DeviceInfo
+// later do not break the signatures made by other versions.
+func (d *DeviceInfo) signedBytes() []byte {
+	return []byte(strings.Join([]string{
+		"gopifinder-device-v1",
+		d.MachineID,
+		d.HostName,
+		strings.Join(d.IPAddress, ","),
+		d.OS,
+		strconv.Itoa(d.PortNo),
+		d.Created.UTC().Format(time.RFC3339Nano),
+		strconv.FormatBool(d.TLS),
+		d.PublicKey,
+		strings.Join(d.Clusters, ","),
+		strconv.FormatInt(d.Incarnation, 10),
+		d.Signed.UTC().Format(time.RFC3339Nano),
+	}, "\n"))
+}
+
+// SignRequest signs the request with the identity's private key, which proves that
+// the request was sent by the owner of the key.  The request's timestamp and nonce
+// headers are reused if the request has already been signed with the cluster secret.
+// The body must hold the same bytes as the request body.
+func (i *Identity) SignRequest(r *http.Request, body []byte) error {
+	ts := r.Header.Get(HeaderTimestamp)
+	nonce := r.Header.Get(HeaderNonce)
+	if ts == "" || nonce == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return errors.New("Error creating request nonce. " + err.Error())
+		}
+		ts = strconv.FormatInt(time.Now().Unix(), 10)
+		nonce = hex.EncodeToString(b)
+		r.Header.Set(HeaderTimestamp, ts)
+		r.Header.Set(HeaderNonce, nonce)
+	}
+	sig := ed25519.Sign(i.privateKey, keySignedBytes(r.Method, r.URL.RequestURI(), ts, nonce, body))
+	r.Header.Set(HeaderKey, i.EncodedPublicKey())
+	r.Header.Set(HeaderKeySignature, base64.StdEncoding.EncodeToString(sig))
+	return nil
+}
+
+// KeyVerifier verifies requests signed with an identity key.
+// Requests signed outside of the allowed clock skew, and requests that reuse a
+// nonce, are rejected.
+type KeyVerifier struct {
+	MaxSkew time.Duration // The maximum age of a signed request
+	nonces  nonceCache
+}
+
+// Verify verifies the request's key signature and returns the base64 encoded
+// public key that signed it.  An empty key is returned if the request is not signed.
+// The request body is read and replaced so that it can be read again by the handler.
+func (v *KeyVerifier) Verify(r *http.Request) (string, error) {
+	key := r.Header.Get(HeaderKey)
+	if key == "" {
+		return "", nil
+	}
+	pub, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return "", errors.New("Invalid request public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(r.Header.Get(HeaderKeySignature))
+	if err != nil {
+		return "", errors.New("Invalid request key signature")
+	}
+	ts := r.Header.Get(HeaderTimestamp)
+	nonce := r.Header.Get(HeaderNonce)
+	if nonce == "" {
+		return "", errors.New("Request key signature has no nonce")
+	}
+	t, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", errors.New("Invalid request timestamp")
+	}
+	maxSkew := v.MaxSkew
+	if maxSkew <= 0 {
+		maxSkew = 5 * time.Minute
+	}
+	age := time.Since(time.Unix(t, 0))
+	if age > maxSkew || age < -maxSkew {
+		return "", errors.New("Request timestamp is outside the allowed clock skew")
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, err = ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	b := keySignedBytes(r.Method, r.URL.RequestURI(), ts, nonce, body)
+	if !ed25519.Verify(ed25519.PublicKey(pub), b, sig) {
+		return "", errors.New("Request key signature does not match the request")
+	}
+	if err := v.nonces.use(nonce, 2*maxSkew); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// keySignedBytes returns the bytes of a request that are signed with an identity key.
+func keySignedBytes(method string, uri string, ts string, nonce string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(fmt.Sprintf("%s\n%s\n%s\n%s\n%x", method, uri, ts, nonce, sum))
+}
@@ -0,0 +1,153 @@
+package gopifinder
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCanSignAndVerifyDeviceInfo(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "identity.key")
+	id, err := LoadIdentity(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := DeviceInfo{MachineID: "m1", HostName: "host1", IPAddress: []string{"192.168.1.10"}}
+	if err := id.SignDevice(&d); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.VerifySignature(); err != nil {
+		t.Error(err)
+	}
+
+	// Serialization must not break the signature
+	s, _ := d.Serialize()
+	d2 := DeviceInfo{}
+	d2.Deserialize(s)
+	if err := d2.VerifySignature(); err != nil {
+		t.Error(err)
+	}
+
+	d2.MachineID = "m2"
+	if err := d2.VerifySignature(); err == nil {
+		t.Error("Expected changed device information to fail verification.")
+	}
+
+	// The same key must be loaded again
+	id2, err := LoadIdentity(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id2.EncodedPublicKey() != id.EncodedPublicKey() {
+		t.Error("Expected the saved identity to be loaded.")
+	}
+	if fi, err := os.Stat(fn); err != nil || fi.Mode().Perm() != 0600 {
+		t.Error("Expected the identity key to only be readable by the owner.")
+	}
+}
+
+func TestCanSignAndVerifyRequestKey(t *testing.T) {
+	id, err := LoadIdentity(filepath.Join(t.TempDir(), "identity.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"services":[]}`)
+	r, _ := http.NewRequest("POST", "http://localhost/service/add", bytes.NewReader(body))
+	if err := SignRequest(r, "secret", body); err != nil {
+		t.Fatal(err)
+	}
+	if err := id.SignRequest(r, body); err != nil {
+		t.Fatal(err)
+	}
+
+	kv := KeyVerifier{}
+	key, err := kv.Verify(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != id.EncodedPublicKey() {
+		t.Error("Expected the key of the signing identity, got", key)
+	}
+	// The secret signature must still be valid
+	v := RequestVerifier{Secret: "secret"}
+	if err := v.Verify(r); err != nil {
+		t.Error(err)
+	}
+
+	// A changed body must be rejected
+	r.Body = ioutil.NopCloser(bytes.NewReader([]byte(`{}`)))
+	if _, err := kv.Verify(r); err == nil {
+		t.Error("Expected a changed body to be rejected.")
+	}
+
+	// An unsigned request has no key
+	r, _ = http.NewRequest("GET", "http://localhost/service/get", nil)
+	if key, err := kv.Verify(r); key != "" || err != nil {
+		t.Error("Expected no key for an unsigned request.", key, err)
+	}
+}
+
+func TestReplayedKeySignedRequestIsRejected(t *testing.T) {
+	id, err := LoadIdentity(filepath.Join(t.TempDir(), "identity.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"services":[]}`)
+	r, _ := http.NewRequest("POST", "http://localhost/service/add", bytes.NewReader(body))
+	if err := id.SignRequest(r, body); err != nil {
+		t.Fatal(err)
+	}
+	kv := KeyVerifier{}
+	if _, err := kv.Verify(r); err != nil {
+		t.Fatal(err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if _, err := kv.Verify(r); err == nil {
+		t.Error("Expected the replayed request to be rejected.")
+	}
+}
+
+func TestDeviceSignatureCoversFixedFieldsAndExpires(t *testing.T) {
+	id, err := LoadIdentity(filepath.Join(t.TempDir(), "identity.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := DeviceInfo{MachineID: "m1", HostName: "host1", IPAddress: []string{"192.168.1.10"}, Clusters: []string{"a"}, Incarnation: 3}
+	if err := id.SignDevice(&d); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fields outside the signed set, such as those set by the receiver, do not matter
+	d2 := d
+	d2.Untrusted = true
+	if err := d2.VerifySignature(); err != nil {
+		t.Error(err)
+	}
+	for name, change := range map[string]func(*DeviceInfo){
+		"clusters":    func(d *DeviceInfo) { d.Clusters = []string{"b"} },
+		"incarnation": func(d *DeviceInfo) { d.Incarnation++ },
+		"ip":          func(d *DeviceInfo) { d.IPAddress = []string{"192.168.1.66"} },
+		"signed":      func(d *DeviceInfo) { d.Signed = d.Signed.Add(time.Second) },
+	} {
+		d2 := d
+		change(&d2)
+		if err := d2.VerifySignature(); err == nil {
+			t.Error("Expected a changed", name, "to fail verification.")
+		}
+	}
+
+	// Old device information cannot be replayed
+	old := DeviceInfo{MachineID: "m1", HostName: "host1"}
+	id.SignDevice(&old)
+	old.Signed = old.Signed.Add(-DeviceSignatureMaxAge - time.Minute)
+	old.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(id.privateKey, old.signedBytes()))
+	if err := old.VerifySignature(); err == nil {
+		t.Error("Expected an expired signature to fail verification.")
+	}
+}
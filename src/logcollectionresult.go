@@ -0,0 +1,92 @@
+package gopifinder
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// HostLogEntry holds a log entry collected from a device, tagged with the device it was read from.
+type HostLogEntry struct {
+	LogEntry
+	HostName  string `json:"hostName"`  // The host name of the device
+	MachineID string `json:"machineID"` // The machine ID of the device
+}
+
+// Text returns the entry as a single line of text, with the host name after the time.
+func (e HostLogEntry) Text() string {
+	t := "-"
+	if !e.Time.IsZero() {
+		t = e.Time.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%s %s %s %s: %s", t, e.HostName, PriorityName(e.Priority), e.Unit, e.Message)
+}
+
+// DeviceError holds the error returned by a device that failed to answer a request.
+type DeviceError struct {
+	Device  DeviceInfo `json:"device"` // The device
+	Err     error      `json:"-"`      // The error returned for the device
+	Message string     `json:"error"`  // The error message, as the error itself cannot be serialized
+}
+
+// NewDeviceError creates a DeviceError for the error returned by the device.
+func NewDeviceError(d DeviceInfo, err error) DeviceError {
+	return DeviceError{Device: d, Err: err, Message: err.Error()}
+}
+
+// LogCollectionResult holds the log entries collected from a set of devices.
+type LogCollectionResult struct {
+	Entries []HostLogEntry `json:"entries"` // The entries from every device that answered, oldest first
+	Failed  []DeviceError  `json:"failed"`  // The devices that failed to answer
+}
+
+// Add adds the entries read from the device to the result.
+func (r *LogCollectionResult) Add(d DeviceInfo, l []LogEntry) {
+	for _, e := range l {
+		r.Entries = append(r.Entries, HostLogEntry{LogEntry: e, HostName: d.HostName, MachineID: d.MachineID})
+	}
+}
+
+// Sort sorts the entries into a single timeline.  Entries logged at the same time
+// keep the order in which they were added, so each device's entries stay in order.
+// Entries without a time stay next to the entries around them from the same device.
+func (r *LogCollectionResult) Sort() {
+	times := sortTimes(r.Entries)
+	idx := make([]int, len(r.Entries))
+	for n := range idx {
+		idx[n] = n
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return times[idx[i]].Before(times[idx[j]])
+	})
+	l := make([]HostLogEntry, len(idx))
+	for n, i := range idx {
+		l[n] = r.Entries[i]
+	}
+	r.Entries = l
+}
+
+// sortTimes returns the time each entry is sorted by.  An entry without a time, such
+// as a line of a log file with no timestamp, takes the time of the entry before it
+// from the same device, or of the entry after it if there is none before it.
+func sortTimes(l []HostLogEntry) []time.Time {
+	times := make([]time.Time, len(l))
+	last := map[string]time.Time{}
+	for n, e := range l {
+		key := e.MachineID + "/" + e.HostName
+		if !e.Time.IsZero() {
+			last[key] = e.Time
+		}
+		times[n] = last[key]
+	}
+	next := map[string]time.Time{}
+	for n := len(l) - 1; n >= 0; n-- {
+		key := l[n].MachineID + "/" + l[n].HostName
+		if !l[n].Time.IsZero() {
+			next[key] = l[n].Time
+		} else if times[n].IsZero() {
+			times[n] = next[key]
+		}
+	}
+	return times
+}
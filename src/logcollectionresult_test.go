@@ -0,0 +1,47 @@
+package gopifinder
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSortKeepsUntimedEntriesWithTheirDevice(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	a := DeviceInfo{HostName: "a", MachineID: "a"}
+	b := DeviceInfo{HostName: "b", MachineID: "b"}
+	r := LogCollectionResult{}
+	r.Add(a, []LogEntry{
+		{Message: "a lead"},
+		{Time: t0.Add(2 * time.Second), Message: "a1"},
+		{Message: "a1 trace"},
+		{Time: t0.Add(4 * time.Second), Message: "a2"},
+	})
+	r.Add(b, []LogEntry{
+		{Time: t0.Add(1 * time.Second), Message: "b1"},
+		{Time: t0.Add(3 * time.Second), Message: "b2"},
+	})
+	r.Sort()
+
+	l := []string{}
+	for _, e := range r.Entries {
+		l = append(l, e.Message)
+	}
+	want := "b1,a lead,a1,a1 trace,b2,a2"
+	if got := strings.Join(l, ","); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestDeviceErrorSerializesItsMessage(t *testing.T) {
+	r := LogCollectionResult{Failed: []DeviceError{NewDeviceError(DeviceInfo{HostName: "a"}, errors.New("timed out"))}}
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"error":"timed out"`) {
+		t.Errorf("Expected the error message in the JSON, got %s", b)
+	}
+}
@@ -0,0 +1,359 @@
+package gopifinder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kardianos/service"
+)
+
+// LogLevel is the severity of a log record.
+type LogLevel int
+
+// The log levels, from the least to the most severe.
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Log output formats.
+const (
+	LogFormatText = "text" // Human readable lines with the fields as key=value pairs
+	LogFormatJSON = "json" // One JSON object per line
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the name of the log level.
+func (l LogLevel) String() string {
+	if l < LevelDebug || l > LevelError {
+		return strconv.Itoa(int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLogLevel returns the log level with the specified name.
+func ParseLogLevel(s string) (LogLevel, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "warning" {
+		return LevelWarn, nil
+	}
+	for n, i := range levelNames {
+		if i == s {
+			return LogLevel(n), nil
+		}
+	}
+	return LevelInfo, errors.New(s + " is an invalid log level. Valid levels are debug, info, warn and error")
+}
+
+// LogField is a key value pair added to a log record.
+type LogField struct {
+	Key   string      // The name of the field
+	Value interface{} // The value of the field
+}
+
+// Field creates a log field.
+func Field(key string, value interface{}) LogField {
+	return LogField{Key: key, Value: value}
+}
+
+// ErrField creates the log field for an error.
+func ErrField(err error) LogField {
+	return LogField{Key: "error", Value: err}
+}
+
+// LogRecord holds a single log message.
+type LogRecord struct {
+	Time      time.Time  // The date and time the message was logged
+	Level     LogLevel   // The severity of the message
+	Component string     // The component that logged the message
+	Message   string     // The message
+	Fields    []LogField // The fields added to the message
+}
+
+// Text returns the component, message and fields as a single line of text.
+func (r LogRecord) Text() string {
+	b := new(bytes.Buffer)
+	if r.Component != "" {
+		b.WriteString(r.Component)
+		b.WriteString(": ")
+	}
+	b.WriteString(r.Message)
+	for _, f := range r.Fields {
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		v := fieldString(f.Value)
+		if v == "" || strings.ContainsAny(v, " \"=\t\n") {
+			v = strconv.Quote(v)
+		}
+		b.WriteString(v)
+	}
+	return b.String()
+}
+
+// JSON returns the record as a JSON object.  The fields are added to the
+// object after the time, level, component and message.
+func (r LogRecord) JSON() []byte {
+	b := new(bytes.Buffer)
+	b.WriteString(`{"time":`)
+	writeJSON(b, r.Time.Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeJSON(b, r.Level.String())
+	if r.Component != "" {
+		b.WriteString(`,"component":`)
+		writeJSON(b, r.Component)
+	}
+	b.WriteString(`,"msg":`)
+	writeJSON(b, r.Message)
+	for _, f := range r.Fields {
+		b.WriteByte(',')
+		writeJSON(b, f.Key)
+		b.WriteByte(':')
+		switch v := f.Value.(type) {
+		case error, fmt.Stringer:
+			writeJSON(b, fieldString(v))
+		default:
+			if j, err := json.Marshal(v); err == nil {
+				b.Write(j)
+			} else {
+				writeJSON(b, fieldString(v))
+			}
+		}
+	}
+	b.WriteByte('}')
+	return b.Bytes()
+}
+
+// fieldString returns the text representation of a field value.
+func fieldString(v interface{}) string {
+	switch i := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return i
+	case error:
+		return i.Error()
+	case []string:
+		return strings.Join(i, ",")
+	default:
+		return fmt.Sprint(i)
+	}
+}
+
+func writeJSON(b *bytes.Buffer, s string) {
+	j, _ := json.Marshal(s)
+	b.Write(j)
+}
+
+// LogSink writes log records to an output.
+type LogSink interface {
+	WriteRecord(r LogRecord)
+}
+
+// writerSink writes log records to an io.Writer, one per line.
+type writerSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+}
+
+// NewWriterSink creates a sink that writes log records to the writer in the specified format.
+func NewWriterSink(w io.Writer, format string) LogSink {
+	return &writerSink{w: w, format: format}
+}
+
+func (s *writerSink) WriteRecord(r LogRecord) {
+	var b []byte
+	if s.format == LogFormatJSON {
+		b = append(r.JSON(), '\n')
+	} else {
+		b = []byte(fmt.Sprintf("%s %-5s %s\n", r.Time.Format("2006-01-02T15:04:05.000Z07:00"), strings.ToUpper(r.Level.String()), r.Text()))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Write(b)
+}
+
+// serviceSink writes log records to the logger of a kardianos service, which
+// writes to the console, syslog or the Windows event log.
+type serviceSink struct {
+	l      service.Logger
+	format string
+}
+
+// NewServiceSink creates a sink that writes log records to the service logger in the
+// specified format.  The service logger adds its own time stamp, so text records only
+// hold the component, message and fields.  Debug records are written as information.
+func NewServiceSink(l service.Logger, format string) LogSink {
+	return &serviceSink{l: l, format: format}
+}
+
+func (s *serviceSink) WriteRecord(r LogRecord) {
+	a := r.Text()
+	if s.format == LogFormatJSON {
+		a = string(r.JSON())
+	}
+	switch r.Level {
+	case LevelError:
+		s.l.Error(a)
+	case LevelWarn:
+		s.l.Warning(a)
+	default:
+		s.l.Info(a)
+	}
+}
+
+// LogLevels holds the minimum level logged by each component.
+// Components without their own level use the default level.
+// The levels may be changed while they are in use.
+type LogLevels struct {
+	mu         sync.RWMutex
+	def        LogLevel
+	components map[string]LogLevel
+}
+
+// NewLogLevels creates a set of log levels with the specified default level.
+func NewLogLevels(def LogLevel) *LogLevels {
+	return &LogLevels{def: def, components: map[string]LogLevel{}}
+}
+
+// ParseLogLevels parses a comma separated list of levels.  Each entry is either a
+// level, which sets the default level, or component=level.  For example
+//
+//	info,finder=debug,http=warn
+func ParseLogLevels(s string) (*LogLevels, error) {
+	l := NewLogLevels(LevelInfo)
+	for _, i := range strings.Split(s, ",") {
+		if i = strings.TrimSpace(i); i == "" {
+			continue
+		}
+		component := ""
+		if n := strings.Index(i, "="); n >= 0 {
+			component, i = strings.TrimSpace(i[:n]), i[n+1:]
+		}
+		v, err := ParseLogLevel(i)
+		if err != nil {
+			return nil, err
+		}
+		l.Set(component, v)
+	}
+	return l, nil
+}
+
+// Set sets the level of the component.  An empty component sets the default level.
+func (l *LogLevels) Set(component string, level LogLevel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if component == "" {
+		l.def = level
+	} else {
+		l.components[strings.ToLower(component)] = level
+	}
+}
+
+// Level returns the minimum level logged by the component.
+func (l *LogLevels) Level(component string) LogLevel {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if v, ok := l.components[strings.ToLower(component)]; ok {
+		return v
+	}
+	return l.def
+}
+
+// Replace replaces the levels with a copy of the specified levels.
+func (l *LogLevels) Replace(o *LogLevels) {
+	o.mu.RLock()
+	def, components := o.def, make(map[string]LogLevel, len(o.components))
+	for k, v := range o.components {
+		components[k] = v
+	}
+	o.mu.RUnlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.def, l.components = def, components
+}
+
+// Logger writes structured, levelled log records to a sink.
+// Loggers are cheap to derive, so each component and request can have its own
+// logger holding its name and fields.
+type Logger struct {
+	sink      LogSink
+	levels    *LogLevels
+	component string
+	fields    []LogField
+}
+
+// NewLogger creates a logger that writes records at or above the configured levels to the sink.
+func NewLogger(sink LogSink, levels *LogLevels) *Logger {
+	if levels == nil {
+		levels = NewLogLevels(LevelInfo)
+	}
+	return &Logger{sink: sink, levels: levels}
+}
+
+// Named returns a logger for the named component.
+func (l *Logger) Named(component string) *Logger {
+	n := *l
+	n.component = component
+	return &n
+}
+
+// With returns a logger that adds the fields to each record.
+func (l *Logger) With(fields ...LogField) *Logger {
+	n := *l
+	n.fields = append(append([]LogField{}, l.fields...), fields...)
+	return &n
+}
+
+// Enabled returns whether or not records at the level are written for the logger's component.
+func (l *Logger) Enabled(level LogLevel) bool {
+	return level >= l.levels.Level(l.component)
+}
+
+// Log writes a record at the specified level.
+func (l *Logger) Log(level LogLevel, msg string, fields ...LogField) {
+	if !l.Enabled(level) {
+		return
+	}
+	if len(l.fields) != 0 {
+		fields = append(append([]LogField{}, l.fields...), fields...)
+	}
+	l.sink.WriteRecord(LogRecord{
+		Time:      time.Now(),
+		Level:     level,
+		Component: l.component,
+		Message:   msg,
+		Fields:    fields,
+	})
+}
+
+// Debug writes a debug record.
+func (l *Logger) Debug(msg string, fields ...LogField) {
+	l.Log(LevelDebug, msg, fields...)
+}
+
+// Info writes an information record.
+func (l *Logger) Info(msg string, fields ...LogField) {
+	l.Log(LevelInfo, msg, fields...)
+}
+
+// Warn writes a warning record.
+func (l *Logger) Warn(msg string, fields ...LogField) {
+	l.Log(LevelWarn, msg, fields...)
+}
+
+// Error writes an error record.
+func (l *Logger) Error(msg string, fields ...LogField) {
+	l.Log(LevelError, msg, fields...)
+}
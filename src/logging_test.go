@@ -0,0 +1,62 @@
+package gopifinder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCanParseLogLevels(t *testing.T) {
+	l, err := ParseLogLevels("warn,finder=debug, http = error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Level("server") != LevelWarn {
+		t.Error("Expected the default level to be warn, got", l.Level("server"))
+	}
+	if l.Level("finder") != LevelDebug || l.Level("HTTP") != LevelError {
+		t.Error("Unexpected component levels", l.Level("finder"), l.Level("http"))
+	}
+	if _, err := ParseLogLevels("info,finder=loud"); err == nil {
+		t.Error("Expected an error for an invalid level")
+	}
+}
+
+func TestLoggerWritesFieldsAtTheComponentLevel(t *testing.T) {
+	b := new(bytes.Buffer)
+	levels := NewLogLevels(LevelInfo)
+	levels.Set("gossip", LevelWarn)
+	log := NewLogger(NewWriterSink(b, LogFormatJSON), levels)
+
+	log.Named("gossip").Info("Member joined")
+	log.Named("server").Debug("Registering device")
+	if b.Len() != 0 {
+		t.Fatal("Expected records below the level to be dropped, got", b.String())
+	}
+
+	log.Named("server").With(Field("machineID", "m1")).Error("Rejected device", Field("ip", []string{"10.0.0.1"}), ErrField(errors.New("bad key")))
+	r := map[string]interface{}{}
+	if err := json.Unmarshal(b.Bytes(), &r); err != nil {
+		t.Fatal("Expected a JSON record.", err, b.String())
+	}
+	if r["level"] != "error" || r["component"] != "server" || r["msg"] != "Rejected device" {
+		t.Error("Unexpected record", r)
+	}
+	if r["machineID"] != "m1" || r["error"] != "bad key" {
+		t.Error("Expected the fields in the record, got", r)
+	}
+
+	rec := LogRecord{Component: "http", Message: "Handled request", Fields: []LogField{Field("route", "Online"), Field("uri", "/online?a b")}}
+	if s := rec.Text(); !strings.HasPrefix(s, `http: Handled request route=Online uri="/online?a b"`) {
+		t.Error("Unexpected text record", s)
+	}
+}
+
+func TestFinderBuildsItsFallbackLoggerOnce(t *testing.T) {
+	f := Finder{}
+	if f.getLog() != f.getLog() {
+		t.Error("Expected the fallback logger to be reused")
+	}
+}
@@ -0,0 +1,493 @@
+package gopifinder
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Syslog priorities of log entries.
+const (
+	PriorityEmerg = iota
+	PriorityAlert
+	PriorityCrit
+	PriorityErr
+	PriorityWarning
+	PriorityNotice
+	PriorityInfo
+	PriorityDebug
+)
+
+var priorityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// maxLogLines is the maximum number of lines returned by a single log query.
+const maxLogLines = 10000
+
+// LogEntry holds a single log line read from a device.
+type LogEntry struct {
+	Time     time.Time `json:"time"`     // The date and time the line was logged, zero if not known
+	Priority int       `json:"priority"` // The syslog priority of the line
+	Unit     string    `json:"unit"`     // The unit or log the line was read from
+	Message  string    `json:"message"`  // The logged message
+}
+
+// Text returns the entry as a single line of text.
+func (e LogEntry) Text() string {
+	t := "-"
+	if !e.Time.IsZero() {
+		t = e.Time.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%s %s %s: %s", t, PriorityName(e.Priority), e.Unit, e.Message)
+}
+
+// PriorityName returns the name of the syslog priority.
+func PriorityName(p int) string {
+	if p < 0 || p >= len(priorityNames) {
+		return strconv.Itoa(p)
+	}
+	return priorityNames[p]
+}
+
+// ParsePriority parses a syslog priority given as a number or a name.
+func ParsePriority(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if n, err := strconv.Atoi(s); err == nil && n >= PriorityEmerg && n <= PriorityDebug {
+		return n, nil
+	}
+	switch s {
+	case "error":
+		return PriorityErr, nil
+	case "warn":
+		return PriorityWarning, nil
+	}
+	for n, i := range priorityNames {
+		if i == s {
+			return n, nil
+		}
+	}
+	return 0, errors.New(s + " is an invalid priority. Valid priorities are 0 to 7 or emerg, alert, crit, err, warning, notice, info and debug")
+}
+
+// LogQuery holds the filters applied when reading log entries.
+type LogQuery struct {
+	Unit     string         // The unit or log to read, empty reads the default
+	Since    time.Time      // Only entries logged at or after this time, zero for no limit
+	Until    time.Time      // Only entries logged before this time, zero for no limit
+	Priority int            // Only entries with this priority or a more severe one
+	Grep     *regexp.Regexp // Only entries whose message matches, nil for all entries
+	Lines    int            // The maximum number of entries, the most recent are returned
+	Follow   bool           // Keep returning new entries as they are logged
+}
+
+// NewLogQuery returns a query for the entries logged in the last hour.
+func NewLogQuery() LogQuery {
+	return LogQuery{Since: time.Now().Add(-time.Hour), Priority: PriorityDebug, Lines: 1000}
+}
+
+// ParseLogQuery reads a log query from the query parameters unit, since, until,
+// priority, grep, lines and follow.  Parameters that are missing keep the values
+// returned by NewLogQuery.
+func ParseLogQuery(v url.Values) (LogQuery, error) {
+	q := NewLogQuery()
+	now := time.Now()
+	q.Unit = v.Get("unit")
+	if s := v.Get("since"); s != "" {
+		t, err := ParseLogTime(s, now)
+		if err != nil {
+			return q, errors.New("Invalid since. " + err.Error())
+		}
+		q.Since = t
+	}
+	if s := v.Get("until"); s != "" {
+		t, err := ParseLogTime(s, now)
+		if err != nil {
+			return q, errors.New("Invalid until. " + err.Error())
+		}
+		q.Until = t
+	}
+	if s := v.Get("priority"); s != "" {
+		p, err := ParsePriority(s)
+		if err != nil {
+			return q, err
+		}
+		q.Priority = p
+	}
+	if s := v.Get("grep"); s != "" {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return q, errors.New("Invalid grep pattern. " + err.Error())
+		}
+		q.Grep = re
+	}
+	if s := v.Get("lines"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return q, errors.New("Invalid lines. Lines must be a number greater than 0")
+		}
+		q.Lines = n
+	}
+	if q.Lines > maxLogLines {
+		q.Lines = maxLogLines
+	}
+	if s := v.Get("follow"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return q, errors.New("Invalid follow. " + err.Error())
+		}
+		q.Follow = b
+	}
+	return q, nil
+}
+
+// Values returns the query as query parameters, as read by ParseLogQuery.
+func (q LogQuery) Values() url.Values {
+	v := url.Values{}
+	if q.Unit != "" {
+		v.Set("unit", q.Unit)
+	}
+	if !q.Since.IsZero() {
+		v.Set("since", q.Since.Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		v.Set("until", q.Until.Format(time.RFC3339))
+	}
+	v.Set("priority", strconv.Itoa(q.Priority))
+	if q.Grep != nil {
+		v.Set("grep", q.Grep.String())
+	}
+	if q.Lines > 0 {
+		v.Set("lines", strconv.Itoa(q.Lines))
+	}
+	if q.Follow {
+		v.Set("follow", "true")
+	}
+	return v
+}
+
+// Matches returns whether or not the entry passes the query's filters.
+func (q LogQuery) Matches(e LogEntry) bool {
+	if e.Priority > q.Priority {
+		return false
+	}
+	if !e.Time.IsZero() {
+		if !q.Since.IsZero() && e.Time.Before(q.Since) {
+			return false
+		}
+		if !q.Until.IsZero() && !e.Time.Before(q.Until) {
+			return false
+		}
+	}
+	return q.Grep == nil || q.Grep.MatchString(e.Message)
+}
+
+// ParseLogTime parses a time given as RFC 3339, as a date with an optional time,
+// as a duration before now like 90m, or as "N units ago" like "1 hour ago".
+// Dates without a time zone are in local time.
+func ParseLogTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if f := strings.Fields(s); len(f) == 3 && f[2] == "ago" {
+		n, err := strconv.Atoi(f[0])
+		if err == nil && n >= 0 {
+			unit := map[string]time.Duration{
+				"second": time.Second, "minute": time.Minute, "hour": time.Hour,
+				"day": 24 * time.Hour, "week": 7 * 24 * time.Hour,
+			}[strings.TrimSuffix(f[1], "s")]
+			if unit != 0 {
+				return now.Add(-time.Duration(n) * unit), nil
+			}
+		}
+	}
+	return time.Time{}, errors.New(s + " is not a time, a duration or a time ago")
+}
+
+// LogSource reads log entries.
+type LogSource interface {
+	// Read returns the entries that match the query, oldest first.
+	Read(q LogQuery) ([]LogEntry, error)
+	// Follow calls fn with the last matching entries and then with each new matching entry,
+	// until the context is cancelled or fn returns an error.
+	Follow(ctx context.Context, q LogQuery, fn func(LogEntry) error) error
+}
+
+// JournalSource reads the entries logged to the systemd journal by a unit.
+type JournalSource struct {
+	Unit string // The systemd unit
+}
+
+// Read returns the journal entries that match the query, oldest first.
+func (s *JournalSource) Read(q LogQuery) ([]LogEntry, error) {
+	cmd := exec.Command("journalctl", s.args(q, false)...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.New("Error reading journal. " + err.Error())
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.New("Error reading journal. " + err.Error())
+	}
+	l := []LogEntry{}
+	scanJournal(out, func(e LogEntry) error {
+		if q.Matches(e) {
+			l = appendLimited(l, e, q.Lines)
+		}
+		return nil
+	})
+	if err := cmd.Wait(); err != nil && len(l) == 0 {
+		return nil, errors.New("Error reading journal. " + err.Error())
+	}
+	return lastEntries(l, q.Lines), nil
+}
+
+// Follow returns the last matching journal entries and then each new entry.
+func (s *JournalSource) Follow(ctx context.Context, q LogQuery, fn func(LogEntry) error) error {
+	cmd := exec.CommandContext(ctx, "journalctl", s.args(q, true)...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return errors.New("Error following journal. " + err.Error())
+	}
+	if err := cmd.Start(); err != nil {
+		return errors.New("Error following journal. " + err.Error())
+	}
+	err = scanJournal(out, func(e LogEntry) error {
+		if q.Matches(e) {
+			return fn(e)
+		}
+		return nil
+	})
+	cmd.Process.Kill()
+	cmd.Wait()
+	return err
+}
+
+// args returns the journalctl arguments for the query.  The priority is applied by
+// journalctl, while the other filters are applied to the entries that are returned,
+// so that the query behaves the same for every source.
+func (s *JournalSource) args(q LogQuery, follow bool) []string {
+	a := []string{"--no-pager", "--output=json", "--unit=" + s.Unit, "--priority=" + strconv.Itoa(q.Priority)}
+	if !q.Since.IsZero() {
+		a = append(a, "--since="+q.Since.Local().Format("2006-01-02 15:04:05"))
+	}
+	if follow {
+		a = append(a, "--follow", "--lines="+strconv.Itoa(q.Lines))
+	} else if !q.Until.IsZero() {
+		a = append(a, "--until="+q.Until.Local().Format("2006-01-02 15:04:05"))
+	}
+	return a
+}
+
+// scanJournal reads the journal entries written by journalctl in its JSON output format.
+func scanJournal(r io.Reader, fn func(LogEntry) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		m := map[string]interface{}{}
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			continue
+		}
+		e := LogEntry{Priority: PriorityInfo}
+		if s, ok := m["__REALTIME_TIMESTAMP"].(string); ok {
+			if us, err := strconv.ParseInt(s, 10, 64); err == nil {
+				e.Time = time.Unix(0, us*int64(time.Microsecond))
+			}
+		}
+		if s, ok := m["PRIORITY"].(string); ok {
+			if p, err := strconv.Atoi(s); err == nil {
+				e.Priority = p
+			}
+		}
+		e.Unit, _ = m["_SYSTEMD_UNIT"].(string)
+		switch v := m["MESSAGE"].(type) {
+		case string:
+			e.Message = v
+		case []interface{}:
+			// Messages that are not valid UTF-8 are written as an array of bytes
+			b := make([]byte, 0, len(v))
+			for _, i := range v {
+				if f, ok := i.(float64); ok {
+					b = append(b, byte(f))
+				}
+			}
+			e.Message = string(b)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// FileSource reads the entries written to a log file, for systems without a journal.
+// The time and priority of each line are read from the start of the line where possible.
+// Lines without a time, such as the continuation of a message, are given the time and
+// priority of the line before them.
+type FileSource struct {
+	Unit string // The name the entries are reported under
+	Path string // The log file
+}
+
+// Read returns the lines of the file that match the query, oldest first.
+func (s *FileSource) Read(q LogQuery) ([]LogEntry, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, errors.New("Error reading log file. " + err.Error())
+	}
+	defer f.Close()
+	l := []LogEntry{}
+	last := LogEntry{Priority: PriorityInfo}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		e := s.parseLine(sc.Text(), last)
+		last = e
+		if q.Matches(e) {
+			l = appendLimited(l, e, q.Lines)
+		}
+	}
+	return lastEntries(l, q.Lines), sc.Err()
+}
+
+// Follow returns the last matching lines of the file and then each new line.
+// The file is polled every second, and read from the start again if it is truncated.
+func (s *FileSource) Follow(ctx context.Context, q LogQuery, fn func(LogEntry) error) error {
+	l, err := s.Read(q)
+	if err != nil {
+		return err
+	}
+	for _, e := range l {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	fi, err := os.Stat(s.Path)
+	if err != nil {
+		return errors.New("Error reading log file. " + err.Error())
+	}
+	offset := fi.Size()
+	partial := ""
+	last := LogEntry{Priority: PriorityInfo}
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+		fi, err := os.Stat(s.Path)
+		if err != nil || fi.Size() == offset {
+			continue
+		}
+		if fi.Size() < offset {
+			// The file has been truncated or rotated
+			offset, partial = 0, ""
+		}
+		f, err := os.Open(s.Path)
+		if err != nil {
+			continue
+		}
+		b := make([]byte, fi.Size()-offset)
+		n, _ := f.ReadAt(b, offset)
+		f.Close()
+		offset += int64(n)
+		lines := strings.Split(partial+string(b[:n]), "\n")
+		// The last line is incomplete until a newline is written after it
+		partial = lines[len(lines)-1]
+		for _, i := range lines[:len(lines)-1] {
+			e := s.parseLine(i, last)
+			last = e
+			if q.Matches(e) {
+				if err := fn(e); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// logLineTime matches the time stamps at the start of the lines written by this library,
+// the standard logger and syslog.
+var logLineTime = []struct {
+	re     *regexp.Regexp
+	layout string
+}{
+	{regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})`), time.RFC3339Nano},
+	{regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}`), "2006/01/02 15:04:05"},
+	{regexp.MustCompile(`^[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`), time.Stamp},
+}
+
+// logLineLevel matches the level written near the start of a line.
+var logLineLevel = regexp.MustCompile(`(?i)^\s*(?:[a-z]:\s+)?(?:\d{2}:\d{2}:\d{2}\s+)?\[?(debug|info|notice|warn|warning|error|err|crit|alert|emerg)\]?[\s:]`)
+
+// parseLine reads the time and priority from the start of the line.
+func (s *FileSource) parseLine(line string, last LogEntry) LogEntry {
+	e := LogEntry{Time: last.Time, Priority: last.Priority, Unit: s.Unit, Message: line}
+	rest := line
+	for _, i := range logLineTime {
+		if m := i.re.FindString(line); m != "" {
+			layout := i.layout
+			t, err := time.ParseInLocation(layout, m, time.Local)
+			if err != nil {
+				continue
+			}
+			if layout == time.Stamp {
+				// Syslog time stamps do not have a year
+				t = t.AddDate(time.Now().Year(), 0, 0)
+			}
+			e.Time = t
+			e.Priority = PriorityInfo
+			rest = line[len(m):]
+			break
+		}
+	}
+	if m := logLineLevel.FindStringSubmatch(rest); m != nil {
+		if p, err := ParsePriority(m[1]); err == nil {
+			e.Priority = p
+		}
+	} else if strings.HasPrefix(line, "E: ") {
+		e.Priority = PriorityErr
+	} else if strings.HasPrefix(line, "W: ") {
+		e.Priority = PriorityWarning
+	} else if strings.HasPrefix(line, "I: ") {
+		e.Priority = PriorityInfo
+	}
+	return e
+}
+
+// appendLimited appends the entry to the list.  Once the list holds twice the maximum
+// number of entries, the oldest entries are dropped, so lastEntries must be called
+// to get the final list.
+func appendLimited(l []LogEntry, e LogEntry, max int) []LogEntry {
+	l = append(l, e)
+	if max > 0 && len(l) >= 2*max {
+		l = append(l[:0], l[len(l)-max:]...)
+	}
+	return l
+}
+
+// lastEntries returns the last max entries of the list.
+func lastEntries(l []LogEntry, max int) []LogEntry {
+	if max > 0 && len(l) > max {
+		return l[len(l)-max:]
+	}
+	return l
+}
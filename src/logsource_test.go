@@ -0,0 +1,81 @@
+package gopifinder
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCanParseLogQuery(t *testing.T) {
+	v := url.Values{}
+	v.Set("unit", "FinderService")
+	v.Set("since", "2 hours ago")
+	v.Set("priority", "warning")
+	v.Set("grep", "device [0-9]+")
+	v.Set("lines", "50")
+	q, err := ParseLogQuery(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Unit != "FinderService" || q.Priority != PriorityWarning || q.Lines != 50 || q.Grep == nil {
+		t.Error("Unexpected query", q)
+	}
+	if d := time.Since(q.Since); d < 119*time.Minute || d > 121*time.Minute {
+		t.Error("Expected since to be 2 hours ago, got", q.Since)
+	}
+
+	for _, k := range []string{"since", "priority", "grep", "lines", "follow"} {
+		v := url.Values{}
+		v.Set(k, "(bad")
+		if _, err := ParseLogQuery(v); err == nil {
+			t.Error("Expected an error for an invalid", k)
+		}
+	}
+}
+
+func TestFileSourceFiltersLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "finder.log")
+	log := "2026-10-19T10:00:00.000Z INFO  server: Service starting\n" +
+		"2026-10-19T10:05:00.000Z ERROR server: Error finding devices\n" +
+		"  continued on the next line\n" +
+		"2026/10/19 10:10:00 device 12 joined\n" +
+		"2026-10-19T10:15:00.000Z DEBUG finder: Probing seed address\n"
+	if err := ioutil.WriteFile(fn, []byte(log), 0666); err != nil {
+		t.Fatal(err)
+	}
+	s := FileSource{Unit: "finder", Path: fn}
+
+	q := LogQuery{Priority: PriorityDebug}
+	l, err := s.Read(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l) != 5 {
+		t.Fatal("Expected 5 entries, got", len(l))
+	}
+	if l[1].Priority != PriorityErr || l[3].Priority != PriorityInfo || l[4].Priority != PriorityDebug {
+		t.Error("Unexpected priorities", l[1].Priority, l[3].Priority, l[4].Priority)
+	}
+	if !l[2].Time.Equal(l[1].Time) {
+		t.Error("Expected a line without a time to take the time of the line before it")
+	}
+
+	q = LogQuery{Priority: PriorityWarning}
+	if l, _ := s.Read(q); len(l) != 2 {
+		t.Error("Expected 2 error entries, got", len(l))
+	}
+
+	q = LogQuery{Priority: PriorityInfo, Since: time.Date(2026, 10, 19, 10, 4, 0, 0, time.UTC), Lines: 1}
+	l, _ = s.Read(q)
+	if len(l) != 1 || l[0].Message != "2026/10/19 10:10:00 device 12 joined" {
+		t.Error("Expected the last info entry since 10:04, got", l)
+	}
+}
@@ -0,0 +1,100 @@
+package gopifinder
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// MemberState is the state of a finder server in the gossip membership list.
+type MemberState int
+
+const (
+	// MemberAlive indicates the server is responding to probes.
+	MemberAlive MemberState = iota
+	// MemberSuspect indicates the server has failed a probe and will be declared
+	// dead unless it refutes the suspicion.
+	MemberSuspect
+	// MemberDead indicates the server has been removed from the membership list.
+	MemberDead
+)
+
+// String returns the name of the member state.
+func (s MemberState) String() string {
+	switch s {
+	case MemberAlive:
+		return "alive"
+	case MemberSuspect:
+		return "suspect"
+	case MemberDead:
+		return "dead"
+	default:
+		return "unknown"
+	}
+}
+
+// Member holds the gossip membership information about a finder server.
+// The Incarnation is only ever increased by the member itself, which it does to
+// refute a suspicion that it has failed.
+type Member struct {
+	Device      DeviceInfo  `json:"device"`
+	State       MemberState `json:"state"`
+	Incarnation int64       `json:"incarnation"`
+}
+
+// GossipMessage is the message exchanged by finder servers when probing each other.
+// Membership updates are piggybacked on every message.
+type GossipMessage struct {
+	From    Member      `json:"from"`             // The sender of the message
+	Target  *DeviceInfo `json:"target,omitempty"` // The device to probe on behalf of the sender of an indirect probe
+	Updates []Member    `json:"updates"`          // Membership updates
+}
+
+// MemberList holds a list of gossip members
+type MemberList struct {
+	Members []Member `json:"members"`
+}
+
+// ReadFrom reads the string from the reader and deserializes it into the entity values
+func (m *MemberList) ReadFrom(r io.ReadCloser) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if b != nil && len(b) != 0 {
+		if err := json.Unmarshal(b, &m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTo serializes the entity and writes it to the http response
+func (m *MemberList) WriteTo(w http.ResponseWriter) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+	return nil
+}
+
+// Serialize serializes the entity and returns the serialized string
+func (m *MemberList) Serialize() (string, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Deserialize deserializes the specified string into the entity values
+func (m *MemberList) Deserialize(v string) error {
+	err := json.Unmarshal([]byte(v), &m)
+	if err != nil {
+		return err
+	}
+	return nil
+}
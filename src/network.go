@@ -1,11 +1,13 @@
 package gopifinder
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"strings"
 
 	uuid "github.com/satori/go.uuid"
 )
@@ -43,12 +45,21 @@ func GetClientID() (string, error) {
 // GetLocalIPAddresses gets a list of valid IPv4 addresses for the local machine.
 // These are addresses for networks that are currently up.
 func GetLocalIPAddresses() ([]string, error) {
+	return GetInterfaceIPAddresses(nil)
+}
+
+// GetInterfaceIPAddresses gets a list of valid IPv4 addresses for the named network
+// interfaces.  If no names are specified, the addresses of all the interfaces are returned.
+func GetInterfaceIPAddresses(names []string) ([]string, error) {
 	ifaces, err := net.Interfaces()
 	if err != nil {
 		return nil, err
 	}
 	l := []string{}
 	for _, i := range ifaces {
+		if !matchesAny(i.Name, names) {
+			continue
+		}
 		if i.Flags&net.FlagUp != 0 {
 			adds, err := i.Addrs()
 			if err != nil {
@@ -99,3 +110,17 @@ func IsInternetOnline() bool {
 	}
 	return string(b) == "Microsoft NCSI"
 }
+
+// checkResponse returns an error if the http response does not have a successful
+// status code.  The response body is included in the error message.
+func checkResponse(r *http.Response) error {
+	if r.StatusCode >= 200 && r.StatusCode < 300 {
+		return nil
+	}
+	b, _ := ioutil.ReadAll(r.Body)
+	msg := strings.TrimSpace(string(b))
+	if msg == "" {
+		msg = http.StatusText(r.StatusCode)
+	}
+	return fmt.Errorf("Request failed with status %d. %s", r.StatusCode, msg)
+}
@@ -0,0 +1,63 @@
+package gopifinder
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Headers used to identify the owner of a service registration.
+const (
+	HeaderToken        = "X-Finder-Token"         // Token identifying the owner of the registrations
+	HeaderKey          = "X-Finder-Key"           // Base64 encoded public key of the node that signed the request
+	HeaderKeySignature = "X-Finder-Key-Signature" // ed25519 signature of the request by the node's private key
+)
+
+// NewToken creates a random owner token.
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.New("Error creating token. " + err.Error())
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ReadToken reads an owner token from the specified file.
+// An empty token is returned if the file does not exist.
+func ReadToken(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.New("Error reading token. " + err.Error())
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// WriteToken writes the owner token to the specified file, which only the
+// current user can read.
+func WriteToken(path string, token string) error {
+	if err := ioutil.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return errors.New("Error writing token. " + err.Error())
+	}
+	return nil
+}
+
+// TokenOwner returns the owner of registrations made with the specified token.
+// Only a hash of the token is stored, so that the token cannot be read from the
+// registrations served to other clients.
+func TokenOwner(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:])
+}
+
+// KeyOwner returns the owner of registrations made by the node with the specified
+// base64 encoded public key.
+func KeyOwner(publicKey string) string {
+	return "key:" + publicKey
+}
@@ -0,0 +1,21 @@
+package gopifinder
+
+import "errors"
+
+// ErrRegistrationPending is returned in a RegisterResult for a device that had not
+// answered by the time the required number of acknowledgements were received.
+var ErrRegistrationPending = errors.New("Registration is still in progress")
+
+// RegisterResult holds the outcome of registering a list of services with a device.
+type RegisterResult struct {
+	Device     DeviceInfo // The device the services were registered with
+	IPAddress  string     // The IP address of the last registration attempt
+	StatusCode int        // The HTTP status code returned by the device, 0 if there was no response
+	Attempts   int        // The number of registration attempts made
+	Err        error      // The error, if the registration failed
+}
+
+// Acknowledged returns whether or not the device accepted the registration.
+func (r *RegisterResult) Acknowledged() bool {
+	return r.Err == nil
+}
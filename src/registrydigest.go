@@ -0,0 +1,101 @@
+package gopifinder
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// RegistryDigest holds a compact summary of a finder server's device and service tables.
+// Two servers holding the same registrations produce the same digest, so only the
+// entries that differ need to be exchanged.
+type RegistryDigest struct {
+	Services map[string]string `json:"services"` // Hash of the service registrations for each origin server
+	Devices  map[string]int64  `json:"devices"`  // Created time, in Unix nanoseconds, for each device MachineID
+	Removed  map[string]int64  `json:"removed"`  // Removed time, in Unix nanoseconds, for each device tombstone
+}
+
+// RegistrySync holds the entries exchanged by two finder servers during a registry sync.
+type RegistrySync struct {
+	Digest   *RegistryDigest   `json:"digest,omitempty"` // The sender's digest, if it wants the entries it is missing
+	Devices  []DeviceInfo      `json:"devices"`          // Devices the receiver is missing
+	Services []ServiceInfo     `json:"services"`         // Service registrations the receiver is missing
+	Removed  []DeviceTombstone `json:"removed"`          // Device tombstones the receiver is missing
+}
+
+// NewRegistryDigest creates the digest for the specified device, service and
+// device tombstone tables.  The service list must include removed registrations.
+func NewRegistryDigest(dl []DeviceInfo, sl []ServiceInfo, tl []DeviceTombstone) RegistryDigest {
+	d := RegistryDigest{
+		Services: map[string]string{},
+		Devices:  map[string]int64{},
+		Removed:  map[string]int64{},
+	}
+	for _, i := range dl {
+		d.Devices[i.MachineID] = i.Created.UnixNano()
+	}
+	for origin, l := range groupByOrigin(sl) {
+		d.Services[origin] = hashServices(l)
+	}
+	for _, i := range tl {
+		d.Removed[i.MachineID] = i.Removed.UnixNano()
+	}
+	return d
+}
+
+// Diff returns the devices, service registrations and device tombstones from the
+// specified tables that the owner of the digest is missing or holds an older version of.
+// Service registrations are returned for every origin whose hash differs from the digest.
+func (d *RegistryDigest) Diff(dl []DeviceInfo, sl []ServiceInfo, tl []DeviceTombstone) RegistrySync {
+	rs := RegistrySync{
+		Devices:  []DeviceInfo{},
+		Services: []ServiceInfo{},
+		Removed:  []DeviceTombstone{},
+	}
+	for _, i := range dl {
+		if c, ok := d.Devices[i.MachineID]; !ok || i.Created.UnixNano() > c {
+			rs.Devices = append(rs.Devices, i)
+		}
+	}
+	for origin, l := range groupByOrigin(sl) {
+		if d.Services[origin] != hashServices(l) {
+			rs.Services = append(rs.Services, l...)
+		}
+	}
+	for _, i := range tl {
+		if r, ok := d.Removed[i.MachineID]; !ok || i.Removed.UnixNano() > r {
+			rs.Removed = append(rs.Removed, i)
+		}
+	}
+	return rs
+}
+
+// IsEmpty returns whether or not the sync holds no entries.
+func (rs *RegistrySync) IsEmpty() bool {
+	return len(rs.Devices) == 0 && len(rs.Services) == 0 && len(rs.Removed) == 0
+}
+
+// groupByOrigin groups the service registrations by their origin server.
+func groupByOrigin(sl []ServiceInfo) map[string][]ServiceInfo {
+	m := map[string][]ServiceInfo{}
+	for _, i := range sl {
+		m[i.Origin] = append(m[i.Origin], i)
+	}
+	return m
+}
+
+// hashServices returns a hash of the identity and version of the service registrations.
+func hashServices(sl []ServiceInfo) string {
+	keys := make([]string, len(sl))
+	for n, i := range sl {
+		keys[n] = fmt.Sprintf("%s|%s|%d|%t", i.MachineID, i.ServiceName, i.Version, i.Deleted)
+	}
+	sort.Strings(keys)
+	h := sha1.New()
+	for _, k := range keys {
+		io.WriteString(h, k)
+		io.WriteString(h, "\n")
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)[:8])
+}
@@ -0,0 +1,87 @@
+package gopifinder
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegistryDigestIsEqualForSameEntries(t *testing.T) {
+	sl := []ServiceInfo{
+		{ServiceName: "A", MachineID: "m1", Origin: "o1", Version: 1},
+		{ServiceName: "B", MachineID: "m1", Origin: "o2", Version: 2},
+	}
+	d := NewRegistryDigest(nil, sl, nil)
+	// Order must not matter
+	rs := d.Diff(nil, []ServiceInfo{sl[1], sl[0]}, nil)
+	if !rs.IsEmpty() {
+		t.Error("Expected no differences, got", rs)
+	}
+}
+
+func TestRegistryDigestDiffReturnsChangedOrigins(t *testing.T) {
+	now := time.Now()
+	local := []ServiceInfo{
+		{ServiceName: "A", MachineID: "m1", Origin: "o1", Version: 1},
+		{ServiceName: "B", MachineID: "m1", Origin: "o2", Version: 2},
+	}
+	remote := []ServiceInfo{
+		{ServiceName: "A", MachineID: "m1", Origin: "o1", Version: 1},
+		{ServiceName: "B", MachineID: "m1", Origin: "o2", Version: 3, Deleted: true},
+		{ServiceName: "C", MachineID: "m2", Origin: "o3", Version: 1},
+	}
+	d := NewRegistryDigest([]DeviceInfo{{MachineID: "m1", Created: now}}, local, nil)
+	rs := d.Diff([]DeviceInfo{
+		{MachineID: "m1", Created: now},
+		{MachineID: "m2", Created: now},
+	}, remote, []DeviceTombstone{{MachineID: "m3", Removed: now}})
+	if len(rs.Devices) != 1 || rs.Devices[0].MachineID != "m2" {
+		t.Error("Expected only device m2 to be returned, got", rs.Devices)
+	}
+	if len(rs.Removed) != 1 || rs.Removed[0].MachineID != "m3" {
+		t.Error("Expected the tombstone for m3 to be returned, got", rs.Removed)
+	}
+	if len(rs.Services) != 2 {
+		t.Fatal("Expected 2 services to be returned, got", rs.Services)
+	}
+	for _, i := range rs.Services {
+		if i.Origin == "o1" {
+			t.Error("Did not expect unchanged origin o1 to be returned.")
+		}
+	}
+}
+
+func TestDeviceTombstoneSuppressesOlderDeviceInfo(t *testing.T) {
+	now := time.Now()
+	ts := DeviceTombstone{MachineID: "m1", Incarnation: 5, Removed: now, Expires: now.Add(time.Hour)}
+	// A refreshed Created time, or a device clock ahead of the remover's, does not bring the device back
+	if !ts.Suppresses(DeviceInfo{MachineID: "m1", Incarnation: 5, Created: now.Add(time.Hour)}) {
+		t.Error("Expected device information from the removed incarnation to be suppressed.")
+	}
+	if !ts.Suppresses(DeviceInfo{MachineID: "m1", Incarnation: 4}) {
+		t.Error("Expected older device information to be suppressed.")
+	}
+	if ts.Suppresses(DeviceInfo{MachineID: "m1", Incarnation: 6}) {
+		t.Error("Did not expect a restarted device to be suppressed.")
+	}
+	if !ts.Supersedes(DeviceTombstone{MachineID: "m1", Incarnation: 4, Expires: now.Add(2 * time.Hour)}) {
+		t.Error("Expected the tombstone to replace one for an older incarnation.")
+	}
+	ts.Expires = now.Add(-time.Second)
+	if ts.Suppresses(DeviceInfo{MachineID: "m1", Incarnation: 5}) {
+		t.Error("Did not expect an expired tombstone to suppress the device.")
+	}
+}
+
+func TestTombstoneWithoutIncarnationSuppressesDevicesStartedBeforeTheRemoval(t *testing.T) {
+	now := time.Now()
+	ts := DeviceTombstone{MachineID: "m1", Removed: now, Expires: now.Add(time.Hour)}
+	if !ts.Suppresses(DeviceInfo{MachineID: "m1", Incarnation: now.Add(-time.Minute).UnixNano()}) {
+		t.Error("Expected a device started before the removal to be suppressed.")
+	}
+	if ts.Suppresses(DeviceInfo{MachineID: "m1", Incarnation: now.Add(time.Minute).UnixNano()}) {
+		t.Error("Did not expect a device started after the removal to be suppressed.")
+	}
+	if ts.Supersedes(DeviceTombstone{MachineID: "m1", Incarnation: now.Add(time.Minute).UnixNano(), Expires: now.Add(time.Hour)}) {
+		t.Error("Did not expect the tombstone to replace one for a later incarnation.")
+	}
+}
@@ -0,0 +1,79 @@
+package gopifinder
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ReplicateServices sends the list of service registrations to the specified
+// finder server.  Each of the device's IP addresses is tried until one accepts the list.
+func (f *Finder) ReplicateServices(d DeviceInfo, sl []ServiceInfo) error {
+	siList := ServiceInfoList{Services: sl}
+	b, err := json.Marshal(siList)
+	if err != nil {
+		return err
+	}
+	client := f.newClient(f.getTimeout())
+	for n := 0; n < len(d.IPAddress) || n == 0; n++ {
+		var response *http.Response
+		response, err = f.post(client, d.GetURL(n, "/replica/push"), b)
+		if err == nil {
+			err = checkResponse(response)
+			response.Body.Close()
+			if err == nil {
+				return nil
+			}
+		}
+	}
+	return errors.New("Error replicating services to " + d.HostName + ". " + err.Error())
+}
+
+// PullServices gets the full list of service registrations, including removed
+// registrations, from the specified finder server.
+func (f *Finder) PullServices(d DeviceInfo) ([]ServiceInfo, error) {
+	var err error
+	client := f.newClient(f.getTimeout())
+	for n := 0; n < len(d.IPAddress) || n == 0; n++ {
+		var response *http.Response
+		response, err = f.get(client, d.GetURL(n, "/replica/get"))
+		if err == nil {
+			if err = checkResponse(response); err == nil {
+				siList := ServiceInfoList{}
+				err = siList.ReadFrom(response.Body)
+				response.Body.Close()
+				if err == nil {
+					return siList.Services, nil
+				}
+			} else {
+				response.Body.Close()
+			}
+		}
+	}
+	return nil, errors.New("Error pulling services from " + d.HostName + ". " + err.Error())
+}
+
+// SyncRegistry sends the registry sync to the specified finder server and
+// returns the entries the server holds that the sender is missing.
+func (f *Finder) SyncRegistry(d DeviceInfo, rs RegistrySync) (RegistrySync, error) {
+	res := RegistrySync{}
+	b, err := json.Marshal(rs)
+	if err != nil {
+		return res, err
+	}
+	client := f.newClient(f.getTimeout())
+	for n := 0; n < len(d.IPAddress) || n == 0; n++ {
+		var response *http.Response
+		response, err = f.post(client, d.GetURL(n, "/replica/sync"), b)
+		if err == nil {
+			if err = checkResponse(response); err == nil {
+				err = json.NewDecoder(response.Body).Decode(&res)
+			}
+			response.Body.Close()
+			if err == nil {
+				return res, nil
+			}
+		}
+	}
+	return res, errors.New("Error syncing registry with " + d.HostName + ". " + err.Error())
+}
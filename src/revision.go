@@ -0,0 +1,155 @@
+package gopifinder
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RevisionInfo holds the hardware details decoded from a Raspberry Pi revision code.
+type RevisionInfo struct {
+	Code         string `json:"code"`         // The revision code, as reported in /proc/cpuinfo
+	Model        string `json:"model"`        // The model name, as reported in /proc/device-tree/model without the revision
+	Type         int    `json:"type"`         // The model type number
+	Processor    string `json:"processor"`    // The Broadcom processor
+	MemoryMB     int    `json:"memoryMB"`     // The memory size in MB
+	Manufacturer string `json:"manufacturer"` // The manufacturer of the board
+	Revision     string `json:"revision"`     // The PCB revision, such as 1.2
+	NewStyle     bool   `json:"newStyle"`     // Indicates the code uses the new style bit fields
+	WarrantyVoid bool   `json:"warrantyVoid"` // Indicates the board has been overvolted, voiding the warranty
+}
+
+// Raspberry Pi model types.
+const (
+	TypeA       = 0x00
+	TypeB       = 0x01
+	TypeAPlus   = 0x02
+	TypeBPlus   = 0x03
+	Type2B      = 0x04
+	TypeCM1     = 0x06
+	Type3B      = 0x08
+	TypeZero    = 0x09
+	TypeCM3     = 0x0a
+	TypeZeroW   = 0x0c
+	Type3BPlus  = 0x0d
+	Type3APlus  = 0x0e
+	TypeCM3Plus = 0x10
+	Type4B      = 0x11
+	TypeZero2W  = 0x12
+	Type400     = 0x13
+	TypeCM4     = 0x14
+	TypeCM4S    = 0x15
+	Type5       = 0x17
+	TypeCM5     = 0x18
+	Type500     = 0x19
+	TypeCM5Lite = 0x1a
+)
+
+// revisionModels holds the model name of each type, as it appears in the device tree.
+var revisionModels = map[int]string{
+	TypeA:       "Raspberry Pi Model A",
+	TypeB:       "Raspberry Pi Model B",
+	TypeAPlus:   "Raspberry Pi Model A Plus",
+	TypeBPlus:   "Raspberry Pi Model B Plus",
+	Type2B:      "Raspberry Pi 2 Model B",
+	0x05:        "Raspberry Pi Alpha",
+	TypeCM1:     "Raspberry Pi Compute Module",
+	Type3B:      "Raspberry Pi 3 Model B",
+	TypeZero:    "Raspberry Pi Zero",
+	TypeCM3:     "Raspberry Pi Compute Module 3",
+	TypeZeroW:   "Raspberry Pi Zero W",
+	Type3BPlus:  "Raspberry Pi 3 Model B Plus",
+	Type3APlus:  "Raspberry Pi 3 Model A Plus",
+	TypeCM3Plus: "Raspberry Pi Compute Module 3 Plus",
+	Type4B:      "Raspberry Pi 4 Model B",
+	TypeZero2W:  "Raspberry Pi Zero 2 W",
+	Type400:     "Raspberry Pi 400",
+	TypeCM4:     "Raspberry Pi Compute Module 4",
+	TypeCM4S:    "Raspberry Pi Compute Module 4S",
+	Type5:       "Raspberry Pi 5 Model B",
+	TypeCM5:     "Raspberry Pi Compute Module 5",
+	Type500:     "Raspberry Pi 500",
+	TypeCM5Lite: "Raspberry Pi Compute Module 5 Lite",
+}
+
+var (
+	revisionProcessors    = []string{"BCM2835", "BCM2836", "BCM2837", "BCM2711", "BCM2712"}
+	revisionManufacturers = []string{"Sony UK", "Egoman", "Embest", "Sony Japan", "Embest", "Stadium"}
+	revisionMemory        = []int{256, 512, 1024, 2048, 4096, 8192, 16384}
+)
+
+// oldRevisions holds the boards with an old style revision code, which is a plain
+// index into this table.  All of them have a BCM2835 processor.
+var oldRevisions = map[uint64]RevisionInfo{
+	0x02: {Type: TypeB, Revision: "1.0", MemoryMB: 256, Manufacturer: "Egoman"},
+	0x03: {Type: TypeB, Revision: "1.0", MemoryMB: 256, Manufacturer: "Egoman"},
+	0x04: {Type: TypeB, Revision: "2.0", MemoryMB: 256, Manufacturer: "Sony UK"},
+	0x05: {Type: TypeB, Revision: "2.0", MemoryMB: 256, Manufacturer: "Qisda"},
+	0x06: {Type: TypeB, Revision: "2.0", MemoryMB: 256, Manufacturer: "Egoman"},
+	0x07: {Type: TypeA, Revision: "2.0", MemoryMB: 256, Manufacturer: "Egoman"},
+	0x08: {Type: TypeA, Revision: "2.0", MemoryMB: 256, Manufacturer: "Sony UK"},
+	0x09: {Type: TypeA, Revision: "2.0", MemoryMB: 256, Manufacturer: "Qisda"},
+	0x0d: {Type: TypeB, Revision: "2.0", MemoryMB: 512, Manufacturer: "Egoman"},
+	0x0e: {Type: TypeB, Revision: "2.0", MemoryMB: 512, Manufacturer: "Sony UK"},
+	0x0f: {Type: TypeB, Revision: "2.0", MemoryMB: 512, Manufacturer: "Egoman"},
+	0x10: {Type: TypeBPlus, Revision: "1.2", MemoryMB: 512, Manufacturer: "Sony UK"},
+	0x11: {Type: TypeCM1, Revision: "1.0", MemoryMB: 512, Manufacturer: "Sony UK"},
+	0x12: {Type: TypeAPlus, Revision: "1.1", MemoryMB: 256, Manufacturer: "Sony UK"},
+	0x13: {Type: TypeBPlus, Revision: "1.2", MemoryMB: 512, Manufacturer: "Embest"},
+	0x14: {Type: TypeCM1, Revision: "1.0", MemoryMB: 512, Manufacturer: "Embest"},
+	0x15: {Type: TypeAPlus, Revision: "1.1", MemoryMB: 256, Manufacturer: "Embest"},
+}
+
+// DecodeRevision decodes a Raspberry Pi revision code given in hexadecimal, as reported
+// in /proc/cpuinfo.  New style codes hold the model, processor, memory size, manufacturer
+// and PCB revision in bit fields, while old style codes are looked up in a table.
+func DecodeRevision(code string) (RevisionInfo, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	v, err := strconv.ParseUint(code, 16, 32)
+	if err != nil {
+		return RevisionInfo{}, errors.New("Error parsing revision code " + code + ". " + err.Error())
+	}
+	if v&(1<<23) == 0 {
+		// Bit 24 is set on overvolted boards
+		r, ok := oldRevisions[v&0xffffff]
+		if !ok {
+			return RevisionInfo{}, errors.New("Unknown revision code " + code)
+		}
+		r.Code = code
+		r.Model = revisionModels[r.Type]
+		r.Processor = "BCM2835"
+		r.WarrantyVoid = v&(1<<24) != 0
+		return r, nil
+	}
+
+	r := RevisionInfo{
+		Code:         code,
+		Type:         int(v>>4) & 0xff,
+		Revision:     fmt.Sprintf("1.%d", v&0xf),
+		NewStyle:     true,
+		WarrantyVoid: v&(1<<25) != 0,
+	}
+	model, ok := revisionModels[r.Type]
+	if !ok {
+		return r, fmt.Errorf("Unknown model type 0x%x in revision code %s", r.Type, code)
+	}
+	r.Model = model
+	if n := int(v>>12) & 0xf; n < len(revisionProcessors) {
+		r.Processor = revisionProcessors[n]
+	}
+	if n := int(v>>16) & 0xf; n < len(revisionManufacturers) {
+		r.Manufacturer = revisionManufacturers[n]
+	}
+	if n := int(v>>20) & 0x7; n < len(revisionMemory) {
+		r.MemoryMB = revisionMemory[n]
+	}
+	return r, nil
+}
+
+// MatchesModel returns whether or not the model read from /proc/device-tree/model,
+// such as "Raspberry Pi 4 Model B Rev 1.1", is the decoded model.
+func (r RevisionInfo) MatchesModel(model string) bool {
+	model = strings.TrimSpace(model)
+	return model == r.Model || strings.HasPrefix(model, r.Model+" Rev ")
+}
@@ -0,0 +1,41 @@
+package gopifinder
+
+import "testing"
+
+func TestCanDecodeRevisionCodes(t *testing.T) {
+	for _, tc := range []struct {
+		code string
+		want RevisionInfo
+	}{
+		{"0010", RevisionInfo{Model: "Raspberry Pi Model B Plus", Type: TypeBPlus, Processor: "BCM2835", MemoryMB: 512, Manufacturer: "Sony UK", Revision: "1.2"}},
+		{"1000002", RevisionInfo{Model: "Raspberry Pi Model B", Type: TypeB, Processor: "BCM2835", MemoryMB: 256, Manufacturer: "Egoman", Revision: "1.0", WarrantyVoid: true}},
+		{"9000c1", RevisionInfo{Model: "Raspberry Pi Zero W", Type: TypeZeroW, Processor: "BCM2835", MemoryMB: 512, Manufacturer: "Sony UK", Revision: "1.1", NewStyle: true}},
+		{"a020d3", RevisionInfo{Model: "Raspberry Pi 3 Model B Plus", Type: Type3BPlus, Processor: "BCM2837", MemoryMB: 1024, Manufacturer: "Sony UK", Revision: "1.3", NewStyle: true}},
+		{"902120", RevisionInfo{Model: "Raspberry Pi Zero 2 W", Type: TypeZero2W, Processor: "BCM2837", MemoryMB: 512, Manufacturer: "Sony UK", Revision: "1.0", NewStyle: true}},
+		{"C03130", RevisionInfo{Model: "Raspberry Pi 400", Type: Type400, Processor: "BCM2711", MemoryMB: 4096, Manufacturer: "Sony UK", Revision: "1.0", NewStyle: true}},
+		{"b03141", RevisionInfo{Model: "Raspberry Pi Compute Module 4", Type: TypeCM4, Processor: "BCM2711", MemoryMB: 2048, Manufacturer: "Sony UK", Revision: "1.1", NewStyle: true}},
+		{"e04171", RevisionInfo{Model: "Raspberry Pi 5 Model B", Type: Type5, Processor: "BCM2712", MemoryMB: 16384, Manufacturer: "Sony UK", Revision: "1.1", NewStyle: true}},
+		{"2a22082", RevisionInfo{Model: "Raspberry Pi 3 Model B", Type: Type3B, Processor: "BCM2837", MemoryMB: 1024, Manufacturer: "Embest", Revision: "1.2", NewStyle: true, WarrantyVoid: true}},
+	} {
+		r, err := DecodeRevision(tc.code)
+		if err != nil {
+			t.Error(tc.code, err)
+			continue
+		}
+		r.Code = ""
+		if r != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.code, r, tc.want)
+		}
+	}
+
+	for _, code := range []string{"0001", "a0fff0", "pi"} {
+		if _, err := DecodeRevision(code); err == nil {
+			t.Error("Expected an error for revision code", code)
+		}
+	}
+
+	r, _ := DecodeRevision("c03111")
+	if !r.MatchesModel("Raspberry Pi 4 Model B Rev 1.1") || r.MatchesModel("Raspberry Pi 400 Rev 1.0") {
+		t.Error("Expected the model to only match the Pi 4 device tree model")
+	}
+}
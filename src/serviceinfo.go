@@ -1,35 +1,58 @@
 package gopifinder
 
 import (
-	"bytes"
 	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"time"
 )
 
 // ServiceInfo holds the information about a service provided by
 // a device.
 // The information holds the ServiceName, the Port No on the device and
 // the API url stub of the service controller.
+// Registrations replicated between finder servers are versioned by the server
+// they originated on, which allows the newest version of a registration to win.
 type ServiceInfo struct {
-	ServiceName string `json:"serviceName"`
-	MachineID   string `json:"machineID"`
-	HostName    string `json:"hostName"`
-	IPAddress   string `json:"ip"`
-	PortNo      int    `json:"portNo"`
-	APIStub     string `json:"apiStub"`
+	ServiceName string            `json:"serviceName"`
+	MachineID   string            `json:"machineID"`
+	HostName    string            `json:"hostName"`
+	IPAddress   string            `json:"ip"`
+	PortNo      int               `json:"portNo"`
+	APIStub     string            `json:"apiStub"`
+	Origin      string            `json:"origin,omitempty"`   // MachineID of the server the registration originated on
+	Version     int64             `json:"version,omitempty"`  // Version of the registration assigned by the origin server
+	Deleted     bool              `json:"deleted,omitempty"`  // Indicates the registration has been removed
+	Updated     time.Time         `json:"updated"`            // The date and time the origin server last changed the registration
+	Clusters    []string          `json:"clusters,omitempty"` // Names of the clusters the service is registered in, empty for the default cluster
+	Owner       string            `json:"owner,omitempty"`    // The owner credential of the caller that registered the service
+	Tags        []string          `json:"tags,omitempty"`     // Tags used to select the service
+	Metadata    map[string]string `json:"metadata,omitempty"` // Additional information about the service
+}
+
+// IsSameService returns whether or not the specified ServiceInfo is for the same
+// service on the same machine.
+func (s *ServiceInfo) IsSameService(o ServiceInfo) bool {
+	return s.MachineID == o.MachineID && s.ServiceName == o.ServiceName
+}
+
+// IsNewerThan returns whether or not this registration supersedes the specified registration.
+// The Version is compared first, with the Origin used to break ties.
+func (s *ServiceInfo) IsNewerThan(o ServiceInfo) bool {
+	if s.Version != o.Version {
+		return s.Version > o.Version
+	}
+	return s.Origin > o.Origin
 }
 
 // RegisterWith will register the Service with the specified device.
-func (s *ServiceInfo) RegisterWith(d DeviceInfo, ipNo int) error {
-	l := ServiceInfoList{}
-	l.Services = append(l.Services, *s)
-	b := new(bytes.Buffer)
-	json.NewEncoder(b).Encode(l)
-	client := http.Client{}
-	_, err := client.Post(d.GetURL(ipNo, "/service/add"), "application/json;charset=utf-8", b)
-	return err
+// The request is sent by the Finder, which signs it with its Secret or Identity and
+// owns the Service with its Token.  A nil Finder sends an unsigned request owned by
+// a Token that is only kept while the process runs.
+func (s *ServiceInfo) RegisterWith(f *Finder, d DeviceInfo, ipNo int) error {
+	l := ServiceInfoList{Services: []ServiceInfo{*s}}
+	return l.RegisterWith(f, d, ipNo)
 }
 
 // ReadFrom reads the string from the reader and deserializes it into the entity values
@@ -1,7 +1,6 @@
 package gopifinder
 
 import (
-	"bytes"
 	"encoding/json"
 	"io"
 	"io/ioutil"
@@ -13,13 +12,19 @@ type ServiceInfoList struct {
 	Services []ServiceInfo `json:"services"`
 }
 
+// defaultFinder sends the registrations made without a Finder, so that they share
+// a Token for the life of the process.
+var defaultFinder = &Finder{}
+
 // RegisterWith will register the Services with the specified device.
-func (s *ServiceInfoList) RegisterWith(d DeviceInfo, ipNo int) error {
-	b := new(bytes.Buffer)
-	json.NewEncoder(b).Encode(s)
-	client := http.Client{}
-	_, err := client.Post(d.GetURL(ipNo, "/service/add"), "application/json;charset=utf-8", b)
-	return err
+// The request is sent by the Finder, which signs it with its Secret or Identity and
+// owns the Services with its Token.  A nil Finder sends an unsigned request owned by
+// a Token that is only kept while the process runs.
+func (s *ServiceInfoList) RegisterWith(f *Finder, d DeviceInfo, ipNo int) error {
+	if f == nil {
+		f = defaultFinder
+	}
+	return f.RegisterServicesWith(d, ipNo, s.Services)
 }
 
 // ReadFrom reads the string from the reader and deserializes it into the entity values
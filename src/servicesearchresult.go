@@ -0,0 +1,115 @@
+package gopifinder
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// FoundService holds a service found by a service search, along with the
+// devices that reported it.
+type FoundService struct {
+	ServiceInfo
+	ReportedBy []string  `json:"reportedBy"` // MachineIDs of the devices that reported the service
+	LastSeen   time.Time `json:"lastSeen"`   // The date and time the service was last reported
+}
+
+// ServiceSearchResult holds the services found by a service search.
+// Each service appears once, no matter how many devices reported it.
+type ServiceSearchResult struct {
+	Services []FoundService `json:"services"` // The services found
+	TimedOut bool           `json:"timedOut"` // Indicates the search timed out before every device had answered
+}
+
+// Add adds the services reported by the specified device to the result.
+// A service that is already in the result is tagged with the device, and is
+// replaced if the reported registration is newer.
+func (r *ServiceSearchResult) Add(machineID string, sl []ServiceInfo, seen time.Time) {
+	for _, s := range sl {
+		found := false
+		for n := range r.Services {
+			f := &r.Services[n]
+			if f.IsSameService(s) {
+				found = true
+				if s.IsNewerThan(f.ServiceInfo) {
+					f.ServiceInfo = s
+				}
+				if seen.After(f.LastSeen) {
+					f.LastSeen = seen
+				}
+				f.addReporter(machineID)
+				break
+			}
+		}
+		if !found {
+			r.Services = append(r.Services, FoundService{
+				ServiceInfo: s,
+				ReportedBy:  []string{machineID},
+				LastSeen:    seen,
+			})
+		}
+	}
+}
+
+// ServiceInfos returns the services found, without the devices that reported them.
+func (r *ServiceSearchResult) ServiceInfos() []ServiceInfo {
+	l := make([]ServiceInfo, len(r.Services))
+	for n, i := range r.Services {
+		l[n] = i.ServiceInfo
+	}
+	return l
+}
+
+func (f *FoundService) addReporter(machineID string) {
+	for _, i := range f.ReportedBy {
+		if i == machineID {
+			return
+		}
+	}
+	f.ReportedBy = append(f.ReportedBy, machineID)
+}
+
+// ReadFrom reads the string from the reader and deserializes it into the entity values
+func (r *ServiceSearchResult) ReadFrom(rd io.ReadCloser) error {
+	b, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	if b != nil && len(b) != 0 {
+		if err := json.Unmarshal(b, &r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTo serializes the entity and writes it to the http response
+func (r *ServiceSearchResult) WriteTo(w http.ResponseWriter) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(b)
+	return nil
+}
+
+// Serialize serializes the entity and returns the serialized string
+func (r *ServiceSearchResult) Serialize() (string, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Deserialize deserializes the specified string into the entity values
+func (r *ServiceSearchResult) Deserialize(v string) error {
+	err := json.Unmarshal([]byte(v), &r)
+	if err != nil {
+		return err
+	}
+	return nil
+}
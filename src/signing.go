@@ -0,0 +1,140 @@
+package gopifinder
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers used to sign requests between finder servers and clients.
+const (
+	HeaderTimestamp = "X-Finder-Timestamp" // Unix time the request was signed
+	HeaderNonce     = "X-Finder-Nonce"     // Random value that stops the request from being replayed
+	HeaderSignature = "X-Finder-Signature" // HMAC-SHA256 signature of the request
+)
+
+// SignRequest signs the request with the shared cluster secret.
+// The body must hold the same bytes as the request body.
+func SignRequest(r *http.Request, secret string, body []byte) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return errors.New("Error creating request nonce. " + err.Error())
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := hex.EncodeToString(b)
+	r.Header.Set(HeaderTimestamp, ts)
+	r.Header.Set(HeaderNonce, nonce)
+	r.Header.Set(HeaderSignature, computeSignature(secret, r.Method, r.URL.RequestURI(), ts, nonce, body))
+	return nil
+}
+
+// computeSignature returns the hex encoded HMAC-SHA256 signature of the request values.
+func computeSignature(secret string, method string, uri string, ts string, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%x", method, uri, ts, nonce, sum)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RequestVerifier verifies requests signed with the shared cluster secret.
+// Requests signed outside of the allowed clock skew, and requests that reuse a
+// nonce, are rejected.
+type RequestVerifier struct {
+	Secret  string        // The shared cluster secret
+	MaxSkew time.Duration // The maximum age of a signed request
+	nonces  nonceCache
+}
+
+// Verify verifies the signature of the request.  The request body is read and
+// replaced so that it can be read again by the handler.
+func (v *RequestVerifier) Verify(r *http.Request) error {
+	ts := r.Header.Get(HeaderTimestamp)
+	nonce := r.Header.Get(HeaderNonce)
+	sig := r.Header.Get(HeaderSignature)
+	if ts == "" || nonce == "" || sig == "" {
+		return errors.New("Request is not signed")
+	}
+
+	skew := v.getMaxSkew()
+	t, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.New("Invalid request timestamp")
+	}
+	age := time.Since(time.Unix(t, 0))
+	if age > skew || age < -skew {
+		return errors.New("Request timestamp is outside the allowed clock skew")
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, err = ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return err
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	expected := computeSignature(v.Secret, r.Method, r.URL.RequestURI(), ts, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return errors.New("Invalid request signature")
+	}
+
+	// Reject replayed requests
+	return v.nonces.use(nonce, 2*skew)
+}
+
+func (v *RequestVerifier) getMaxSkew() time.Duration {
+	if v.MaxSkew <= 0 {
+		return 5 * time.Minute
+	}
+	return v.MaxSkew
+}
+
+// maxNonces is the maximum number of nonces remembered by a verifier.
+const maxNonces = 10000
+
+// nonceCache remembers the nonces of verified requests until their signature
+// can no longer be accepted, so that a request cannot be replayed.
+type nonceCache struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+// use records the nonce for the ttl, or returns an error if it has already been used.
+// Once maxNonces are held, the nonce closest to expiring is forgotten to make room.
+func (c *nonceCache) use(nonce string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if c.expires == nil {
+		c.expires = map[string]time.Time{}
+	}
+	for n, exp := range c.expires {
+		if now.After(exp) {
+			delete(c.expires, n)
+		}
+	}
+	if _, ok := c.expires[nonce]; ok {
+		return errors.New("Request nonce has already been used")
+	}
+	if len(c.expires) >= maxNonces {
+		oldest := ""
+		for n, exp := range c.expires {
+			if oldest == "" || exp.Before(c.expires[oldest]) {
+				oldest = n
+			}
+		}
+		delete(c.expires, oldest)
+	}
+	c.expires[nonce] = now.Add(ttl)
+	return nil
+}
@@ -0,0 +1,99 @@
+package gopifinder
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newSignedRequest(t *testing.T, secret string, body string) *http.Request {
+	r, err := http.NewRequest("POST", "http://localhost:20502/service/add", bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SignRequest(r, secret, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestCanVerifySignedRequest(t *testing.T) {
+	v := RequestVerifier{Secret: "secret"}
+	r := newSignedRequest(t, "secret", `{"services":[]}`)
+	if err := v.Verify(r); err != nil {
+		t.Error(err)
+	}
+	// The body must still be readable by the handler
+	l := ServiceInfoList{}
+	if err := l.ReadFrom(r.Body); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerifyRejectsInvalidRequests(t *testing.T) {
+	v := RequestVerifier{Secret: "secret"}
+
+	r := newSignedRequest(t, "other", `{}`)
+	if err := v.Verify(r); err == nil {
+		t.Error("Expected a request signed with the wrong secret to be rejected.")
+	}
+
+	r = newSignedRequest(t, "secret", `{}`)
+	r.Body = http.NoBody
+	if err := v.Verify(r); err == nil {
+		t.Error("Expected a request with a changed body to be rejected.")
+	}
+
+	r = newSignedRequest(t, "secret", `{}`)
+	if err := v.Verify(r); err != nil {
+		t.Fatal(err)
+	}
+	r.Body = http.NoBody
+	r2, _ := http.NewRequest("POST", r.URL.String(), bytes.NewReader([]byte(`{}`)))
+	r2.Header = r.Header
+	if err := v.Verify(r2); err == nil {
+		t.Error("Expected a replayed request to be rejected.")
+	}
+
+	r, _ = http.NewRequest("POST", "http://localhost:20502/service/add", nil)
+	if err := v.Verify(r); err == nil {
+		t.Error("Expected an unsigned request to be rejected.")
+	}
+}
+
+func TestRegisterWithSignsTheRequest(t *testing.T) {
+	v := RequestVerifier{Secret: "secret"}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := v.Verify(r); err != nil {
+			http.Error(w, err.Error(), 401)
+		}
+	}))
+	defer ts.Close()
+	d := newTestDevice(t, "server", ts)
+
+	s := ServiceInfo{ServiceName: "Test", MachineID: "m1"}
+	if err := s.RegisterWith(&Finder{Secret: "secret"}, d, 0); err != nil {
+		t.Error(err)
+	}
+	if err := s.RegisterWith(nil, d, 0); err == nil {
+		t.Error("Expected an unsigned registration to be rejected")
+	}
+}
+
+func TestNonceCacheIsBounded(t *testing.T) {
+	c := nonceCache{}
+	for i := 0; i < maxNonces+10; i++ {
+		if err := c.use(strconv.Itoa(i), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c.expires) != maxNonces {
+		t.Error("Expected the cache to hold at most", maxNonces, "nonces, got", len(c.expires))
+	}
+	if err := c.use(strconv.Itoa(maxNonces+9), time.Minute); err == nil {
+		t.Error("Expected a recent nonce to be rejected.")
+	}
+}
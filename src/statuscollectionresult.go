@@ -0,0 +1,33 @@
+package gopifinder
+
+import "sort"
+
+// HostStatus holds the status read from a device.
+type HostStatus struct {
+	Device DeviceInfo   `json:"device"` // The device
+	Status DeviceStatus `json:"status"` // The status of the device
+}
+
+// StatusCollectionResult holds the status read from a set of devices.
+type StatusCollectionResult struct {
+	Devices []HostStatus  `json:"devices"` // The status of every device that answered, sorted by host name
+	Failed  []DeviceError `json:"failed"`  // The devices that failed to answer
+}
+
+// Sort sorts the devices by host name.
+func (r *StatusCollectionResult) Sort() {
+	sort.SliceStable(r.Devices, func(i, j int) bool {
+		return r.Devices[i].Device.HostName < r.Devices[j].Device.HostName
+	})
+}
+
+// UnderVoltage returns the devices that are under-voltage, or have been since they booted.
+func (r StatusCollectionResult) UnderVoltage() []HostStatus {
+	l := []HostStatus{}
+	for _, i := range r.Devices {
+		if DecodeThrottled(i.Status.Throttled).EverUnderVoltage() {
+			l = append(l, i)
+		}
+	}
+	return l
+}
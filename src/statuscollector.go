@@ -0,0 +1,375 @@
+package gopifinder
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatusCollector reads part of the device status, such as the CPU temperature
+// or the memory usage.
+// The collector reads the device's files and runs its commands through the System.
+type StatusCollector interface {
+	Name() string                               // The name of the collector, reported with its errors
+	Collect(sys *System, d *DeviceStatus) error // Reads the collector's values into the status
+}
+
+// StatusError holds the error returned by a status collector.
+type StatusError struct {
+	Collector string `json:"collector"` // The name of the collector
+	Message   string `json:"message"`   // The error message
+}
+
+// statusCollectorFunc is a StatusCollector that calls a function.
+type statusCollectorFunc struct {
+	name    string
+	collect func(sys *System, d *DeviceStatus) error
+}
+
+func (c statusCollectorFunc) Name() string {
+	return c.name
+}
+
+func (c statusCollectorFunc) Collect(sys *System, d *DeviceStatus) error {
+	return c.collect(sys, d)
+}
+
+// NewStatusCollector creates a status collector that calls the function.
+func NewStatusCollector(name string, collect func(sys *System, d *DeviceStatus) error) StatusCollector {
+	return statusCollectorFunc{name: name, collect: collect}
+}
+
+var (
+	collectorMu      sync.RWMutex
+	statusCollectors = map[string][]StatusCollector{}
+)
+
+// RegisterStatusCollector registers a collector for the platform, which is the OS
+// reported in DeviceStatus, such as Linux or WindowsNT.  A collector replaces the
+// platform's collector with the same name, otherwise it is run after the others.
+func RegisterStatusCollector(platform string, c StatusCollector) {
+	collectorMu.Lock()
+	defer collectorMu.Unlock()
+	l := statusCollectors[platform]
+	for n, i := range l {
+		if i.Name() == c.Name() {
+			l[n] = c
+			return
+		}
+	}
+	statusCollectors[platform] = append(l, c)
+}
+
+// StatusCollectors returns the collectors registered for the platform, in the order they are run.
+func StatusCollectors(platform string) []StatusCollector {
+	collectorMu.RLock()
+	defer collectorMu.RUnlock()
+	return append([]StatusCollector{}, statusCollectors[platform]...)
+}
+
+func init() {
+	for _, c := range []StatusCollector{
+		NewStatusCollector("os", collectLinuxOS),
+		NewStatusCollector("hardware", collectLinuxHardware),
+		NewStatusCollector("model", collectDeviceTreeModel),
+		NewStatusCollector("cpu", collectLinuxCPUTemp),
+		NewStatusCollector("gpu", collectGPUTemp),
+		NewStatusCollector("throttling", collectThrottling),
+		NewStatusCollector("disk", collectLinuxDisk),
+		NewStatusCollector("memory", collectLinuxMemory),
+		NewStatusCollector("uptime", collectLinuxUptime),
+	} {
+		RegisterStatusCollector("Linux", c)
+	}
+	for _, c := range []StatusCollector{
+		NewStatusCollector("os", collectWindowsOS),
+		NewStatusCollector("hardware", collectWindowsHardware),
+		NewStatusCollector("disk", collectWindowsDisk),
+	} {
+		RegisterStatusCollector("WindowsNT", c)
+	}
+}
+
+// collectStatus runs each of the collectors.  A collector's values are only kept if it
+// succeeds, so a failing collector leaves its values empty and adds its error to Errors.
+// Returns the number of collectors that failed.
+func (d *DeviceStatus) collectStatus(sys *System, l []StatusCollector) int {
+	failed := 0
+	for _, c := range l {
+		v := *d
+		if err := c.Collect(sys, &v); err != nil {
+			d.Errors = append(d.Errors, StatusError{Collector: c.Name(), Message: err.Error()})
+			failed++
+			continue
+		}
+		*d = v
+	}
+	return failed
+}
+
+// getOS returns the operating system of the device, as reported by uname.
+func getOS(sys *System) (string, error) {
+	out, err := sys.Output("uname")
+	if err != nil {
+		if isNotFound(err) {
+			return "WindowsNT", nil
+		}
+		return "", errors.New("Error getting device Operating System. " + err.Error())
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func collectHostName(sys *System, d *DeviceStatus) error {
+	out, err := sys.Output("hostname")
+	if err != nil {
+		return errors.New("Error getting HostName. " + err.Error())
+	}
+	d.HostName = strings.TrimSpace(string(out))
+	return nil
+}
+
+func collectLinuxOS(sys *System, d *DeviceStatus) error {
+	txt, err := sys.ReadFile("/etc/os-release")
+	if err != nil {
+		return errors.New("Error getting OS Information. " + err.Error())
+	}
+	if m := regexp.MustCompile(`PRETTY_NAME="([^"]+)"`).FindStringSubmatch(txt); len(m) >= 2 {
+		d.OSName = m[1]
+	}
+	// Debian based systems hold the point release in debian_version, others
+	// only report the version in os-release
+	if v, err := sys.ReadFile("/etc/debian_version"); err == nil {
+		d.OSVersion = strings.TrimSpace(v)
+	} else if m := regexp.MustCompile(`(?m)^VERSION_ID="?([^"\n]+)"?$`).FindStringSubmatch(txt); len(m) >= 2 {
+		d.OSVersion = m[1]
+	}
+	return nil
+}
+
+func collectLinuxHardware(sys *System, d *DeviceStatus) error {
+	txt, err := sys.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return errors.New("Error getting Hardware type. " + err.Error())
+	}
+	if m := regexp.MustCompile(`Revision\s*:\s*([a-f\d]+)`).FindStringSubmatch(txt); len(m) >= 2 {
+		d.HWRevisionCode = m[1]
+		d.HWType = getHardwareType(m[1])
+		if r, err := DecodeRevision(m[1]); err == nil {
+			d.HWModel = r.Model
+			d.HWProcessor = r.Processor
+			d.HWMemory = r.MemoryMB
+			d.HWManufacturer = r.Manufacturer
+			d.HWRevision = r.Revision
+		}
+	}
+	if m := regexp.MustCompile(`Serial\s*:\s*([a-f\d]*)`).FindStringSubmatch(txt); len(m) >= 2 {
+		d.HWSerialNo = m[1]
+	}
+	return nil
+}
+
+// collectDeviceTreeModel reads the model from the device tree, as a cross-check of the
+// model decoded from the revision code.
+func collectDeviceTreeModel(sys *System, d *DeviceStatus) error {
+	txt, err := sys.ReadFile("/proc/device-tree/model")
+	if err != nil {
+		// Only boards with a device tree have a model
+		return nil
+	}
+	model := strings.TrimSpace(strings.TrimRight(txt, "\x00"))
+	if d.HWModel != "" && !(RevisionInfo{Model: d.HWModel}).MatchesModel(model) {
+		return errors.New("Revision code " + d.HWRevisionCode + " is a " + d.HWModel + " but the device tree model is " + model)
+	}
+	d.HWDeviceModel = model
+	return nil
+}
+
+func collectLinuxCPUTemp(sys *System, d *DeviceStatus) error {
+	txt, err := sys.ReadFile("/sys/class/thermal/thermal_zone0/temp")
+	if err != nil {
+		return errors.New("Error getting CPU temperature. " + err.Error())
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(txt), 64)
+	if err != nil {
+		return errors.New("Could not parse CPU Temperature. " + txt)
+	}
+	d.CPUTemp = v / 1000
+	return nil
+}
+
+// runVcgencmd runs vcgencmd with the arguments and returns its trimmed output.
+func runVcgencmd(sys *System, arg ...string) (string, error) {
+	vcgencmd, err := findVcgencmd(sys)
+	if err != nil {
+		return "", err
+	}
+	out, err := sys.Output(vcgencmd, arg...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func collectGPUTemp(sys *System, d *DeviceStatus) error {
+	out, err := runVcgencmd(sys, "measure_temp")
+	if err != nil {
+		return errors.New("Error getting GPU temperature. " + err.Error())
+	}
+	// The output looks like temp=48.3'C
+	m := regexp.MustCompile(`temp=([\d.]+)`).FindStringSubmatch(out)
+	if len(m) < 2 {
+		return errors.New("Error parsing GPU temperature. " + out)
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return errors.New("Error parsing GPU temperature. " + err.Error())
+	}
+	d.GPUTemp = v
+	return nil
+}
+
+func collectThrottling(sys *System, d *DeviceStatus) error {
+	out, err := runVcgencmd(sys, "get_throttled")
+	if err != nil {
+		return errors.New("Error getting Throttled state. " + err.Error())
+	}
+	// The output looks like throttled=0x50000
+	u, err := strconv.ParseUint(strings.TrimPrefix(out, "throttled="), 0, 64)
+	if err != nil {
+		return errors.New("Error parsing Throttled State. " + err.Error())
+	}
+	d.Throttled = u
+	d.ThrottleState = DecodeThrottled(u)
+	d.IsThrottled = d.ThrottleState.Throttled
+	return nil
+}
+
+func collectLinuxDisk(sys *System, d *DeviceStatus) error {
+	out, err := sys.Output("df")
+	if err != nil {
+		return errors.New("Error getting Disk space. " + err.Error())
+	}
+	// Find the line of the root file system
+	m := regexp.MustCompile(`(?m)^\S+\s+(\d+)\s+(\d+)\s+(\d+)\s+(\d+)%\s+/$`).FindStringSubmatch(string(out))
+	if len(m) < 5 {
+		return errors.New("Error getting Disk space. The root file system was not found")
+	}
+	v, err := strconv.ParseInt(m[3], 10, 64)
+	if err != nil {
+		return errors.New("Error parsing Disk space. " + err.Error())
+	}
+	d.DiskUsed = v
+	n, err := strconv.Atoi(m[4])
+	if err != nil {
+		return errors.New("Error parsing Disk percentage. " + err.Error())
+	}
+	d.DiskUsedPerc = n
+	return nil
+}
+
+func collectLinuxMemory(sys *System, d *DeviceStatus) error {
+	txt, err := sys.ReadFile("/proc/meminfo")
+	if err != nil {
+		return errors.New("Error getting available memory. " + err.Error())
+	}
+	if m := regexp.MustCompile(`MemAvailable:\s*(\d+)`).FindStringSubmatch(txt); len(m) >= 2 {
+		v, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return errors.New("Error parsing available memory. " + err.Error())
+		}
+		d.AvailMem = v
+	}
+	if m := regexp.MustCompile(`MemTotal:\s*(\d+)`).FindStringSubmatch(txt); len(m) >= 2 {
+		v, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return errors.New("Error parsing total memory. " + err.Error())
+		}
+		d.TotalMem = v
+	}
+	return nil
+}
+
+func collectLinuxUptime(sys *System, d *DeviceStatus) error {
+	txt, err := sys.ReadFile("/proc/uptime")
+	if err != nil {
+		return errors.New("Error getting system uptime. " + err.Error())
+	}
+	if i := strings.IndexRune(txt, '.'); i >= 0 {
+		v, err := strconv.Atoi(txt[:i])
+		if err != nil {
+			return errors.New("Error parsing system uptime. " + err.Error())
+		}
+		d.Uptime = v
+	}
+	return nil
+}
+
+// wmicValues runs wmic to get the values of the class and returns its lines.
+func wmicValues(sys *System, class string) ([]string, error) {
+	out, err := sys.Output("wmic", class, "get", "/value")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSpace(string(out)), "\n"), nil
+}
+
+func collectWindowsOS(sys *System, d *DeviceStatus) error {
+	arr, err := wmicValues(sys, "os")
+	if err != nil {
+		return errors.New("Error getting Operating System information. " + err.Error())
+	}
+	for _, i := range arr {
+		if strings.HasPrefix(i, "Caption=") {
+			d.OSName = strings.TrimSpace(i[8:])
+		}
+		if strings.HasPrefix(i, "FreePhysicalMemory=") {
+			d.AvailMem = ConvToInt64(i[19:], 0)
+		}
+		if strings.HasPrefix(i, "LastBootUpTime=") {
+			t := ConvToDate(i[15:])
+			d.Uptime = int(time.Since(t).Seconds())
+		}
+		if strings.HasPrefix(i, "Version=") {
+			d.OSVersion = strings.TrimSpace(i[8:])
+		}
+	}
+	return nil
+}
+
+func collectWindowsHardware(sys *System, d *DeviceStatus) error {
+	arr, err := wmicValues(sys, "baseboard")
+	if err != nil {
+		return errors.New("Error getting Baseboard information. " + err.Error())
+	}
+	for _, i := range arr {
+		if strings.HasPrefix(i, "SerialNumber=") {
+			d.HWSerialNo = strings.TrimSpace(i[13:])
+			break
+		}
+		if strings.HasPrefix(i, "Manufacturer=") {
+			d.HWType = strings.TrimSpace(i[13:])
+		}
+	}
+	return nil
+}
+
+func collectWindowsDisk(sys *System, d *DeviceStatus) error {
+	arr, err := wmicValues(sys, "logicaldisk")
+	if err != nil {
+		return errors.New("Error getting Logical disk information. " + err.Error())
+	}
+	for _, i := range arr {
+		if strings.HasPrefix(i, "FreeSpace=") {
+			d.DiskUsed = ConvToInt64(i[10:], 0)
+		}
+		if strings.HasPrefix(i, "Size=") {
+			n := ConvToInt64(i[5:], 0)
+			d.DiskUsedPerc = int(float64(d.DiskUsed) / float64(n) * float64(100))
+			break
+		}
+	}
+	return nil
+}
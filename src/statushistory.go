@@ -0,0 +1,205 @@
+package gopifinder
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// StatusHistory holds the most recent device status samples in a fixed size ring buffer.
+// Once the buffer is full, each new sample replaces the oldest one.
+// A StatusHistory is safe for concurrent use.
+type StatusHistory struct {
+	mu      sync.RWMutex
+	samples []DeviceStatus // The ring buffer
+	next    int            // The index the next sample is written to
+	count   int            // The number of samples held
+}
+
+// NewStatusHistory creates a status history that holds up to size samples.
+func NewStatusHistory(size int) *StatusHistory {
+	if size < 1 {
+		size = 1
+	}
+	return &StatusHistory{samples: make([]DeviceStatus, size)}
+}
+
+// Size returns the maximum number of samples held.
+func (h *StatusHistory) Size() int {
+	return len(h.samples)
+}
+
+// Len returns the number of samples held.
+func (h *StatusHistory) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.count
+}
+
+// Add adds a sample to the history, replacing the oldest sample if the history is full.
+func (h *StatusHistory) Add(s DeviceStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.samples[h.next] = s
+	h.next = (h.next + 1) % len(h.samples)
+	if h.count < len(h.samples) {
+		h.count++
+	}
+}
+
+// All returns every sample held, oldest first.
+func (h *StatusHistory) All() []DeviceStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	l := make([]DeviceStatus, 0, h.count)
+	start := (h.next - h.count + len(h.samples)) % len(h.samples)
+	for i := 0; i < h.count; i++ {
+		l = append(l, h.samples[(start+i)%len(h.samples)])
+	}
+	return l
+}
+
+// Samples returns the samples created at or after since and before until, oldest first.
+// A zero since or until does not limit the range.  If step is greater than zero, the
+// samples are downsampled with DownsampleStatus.
+func (h *StatusHistory) Samples(since time.Time, until time.Time, step time.Duration) []DeviceStatus {
+	l := []DeviceStatus{}
+	for _, s := range h.All() {
+		if !since.IsZero() && s.Created.Before(since) {
+			continue
+		}
+		if !until.IsZero() && !s.Created.Before(until) {
+			continue
+		}
+		l = append(l, s)
+	}
+	if step > 0 {
+		l = DownsampleStatus(l, step)
+	}
+	return l
+}
+
+// DownsampleStatus merges the samples, which must be oldest first, into one sample
+// for each period of step.  The temperatures, disk and memory values of a merged sample
+// are the averages over the period, the throttled bits are the bits set in any of the
+// samples, and the remaining values are taken from the last sample in the period.
+// Samples in which a collector failed are left out of that collector's values.
+func DownsampleStatus(l []DeviceStatus, step time.Duration) []DeviceStatus {
+	res := []DeviceStatus{}
+	if step <= 0 {
+		return append(res, l...)
+	}
+	for i := 0; i < len(l); {
+		period := l[i].Created.Truncate(step)
+		j := i + 1
+		for j < len(l) && l[j].Created.Truncate(step).Equal(period) {
+			j++
+		}
+		res = append(res, mergeStatus(l[i:j]))
+		i = j
+	}
+	return res
+}
+
+// mergeStatus merges the samples into a single sample, as described in DownsampleStatus.
+func mergeStatus(l []DeviceStatus) DeviceStatus {
+	s := l[len(l)-1]
+	if len(l) == 1 {
+		return s
+	}
+	var cpu, gpu float64
+	var diskUsed, diskPerc, totalMem, availMem int64
+	n := map[string]int64{"cpu": 0, "gpu": 0, "disk": 0, "memory": 0, "throttling": 0}
+	s.IsThrottled = false
+	s.Throttled = 0
+	for _, i := range l {
+		if !i.CollectorFailed("cpu") {
+			cpu += i.CPUTemp
+			n["cpu"]++
+		}
+		if !i.CollectorFailed("gpu") {
+			gpu += i.GPUTemp
+			n["gpu"]++
+		}
+		if !i.CollectorFailed("disk") {
+			diskUsed += i.DiskUsed
+			diskPerc += int64(i.DiskUsedPerc)
+			n["disk"]++
+		}
+		if !i.CollectorFailed("memory") {
+			totalMem += i.TotalMem
+			availMem += i.AvailMem
+			n["memory"]++
+		}
+		if !i.CollectorFailed("throttling") {
+			s.IsThrottled = s.IsThrottled || i.IsThrottled
+			s.Throttled |= i.Throttled
+			n["throttling"]++
+		}
+	}
+	if n["cpu"] != 0 {
+		s.CPUTemp = cpu / float64(n["cpu"])
+	}
+	if n["gpu"] != 0 {
+		s.GPUTemp = gpu / float64(n["gpu"])
+	}
+	if n["disk"] != 0 {
+		s.DiskUsed = diskUsed / n["disk"]
+		s.DiskUsedPerc = int(diskPerc / n["disk"])
+	}
+	if n["memory"] != 0 {
+		s.TotalMem = totalMem / n["memory"]
+		s.AvailMem = availMem / n["memory"]
+	}
+	s.ThrottleState = DecodeThrottled(s.Throttled)
+
+	// The last sample's error for a merged collector only stands if it failed in every sample
+	errs := []StatusError{}
+	for _, e := range s.Errors {
+		if c, ok := n[e.Collector]; !ok || c == 0 {
+			errs = append(errs, e)
+		}
+	}
+	if len(errs) == 0 {
+		errs = nil
+	}
+	s.Errors = errs
+	return s
+}
+
+// WriteFile writes the samples held to the file as JSON.
+func (h *StatusHistory) WriteFile(fn string) error {
+	b, err := json.Marshal(h.All())
+	if err != nil {
+		return errors.New("Error serializing status history. " + err.Error())
+	}
+	// Write to a temporary file first, so an interrupted write does not lose the history
+	tmp := fn + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return errors.New("Error writing status history. " + err.Error())
+	}
+	if err := os.Rename(tmp, fn); err != nil {
+		return errors.New("Error writing status history. " + err.Error())
+	}
+	return nil
+}
+
+// ReadFile adds the samples saved in the file by WriteFile to the history.
+// If the file holds more samples than the history can, the oldest are dropped.
+func (h *StatusHistory) ReadFile(fn string) error {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	l := []DeviceStatus{}
+	if err := json.Unmarshal(b, &l); err != nil {
+		return errors.New("Error parsing status history. " + err.Error())
+	}
+	for _, s := range l {
+		h.Add(s)
+	}
+	return nil
+}
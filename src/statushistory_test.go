@@ -0,0 +1,84 @@
+package gopifinder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStatusHistoryKeepsTheMostRecentSamples(t *testing.T) {
+	t0 := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	h := NewStatusHistory(4)
+	for i := 0; i < 6; i++ {
+		h.Add(DeviceStatus{Created: t0.Add(time.Duration(i) * time.Minute), CPUTemp: float64(40 + i)})
+	}
+	l := h.All()
+	if len(l) != 4 || l[0].CPUTemp != 42 || l[3].CPUTemp != 45 {
+		t.Fatal("Expected the last 4 samples, oldest first, got", l)
+	}
+
+	l = h.Samples(t0.Add(3*time.Minute), t0.Add(5*time.Minute), 0)
+	if len(l) != 2 || l[0].CPUTemp != 43 || l[1].CPUTemp != 44 {
+		t.Error("Expected the samples from 10:03 to before 10:05, got", l)
+	}
+
+	// 10:02 and 10:03 fall in one period, 10:04 and 10:05 in the next
+	h.Add(DeviceStatus{Created: t0.Add(6 * time.Minute), CPUTemp: 50, Throttled: 0x50000})
+	h.Add(DeviceStatus{Created: t0.Add(7 * time.Minute), CPUTemp: 52, Throttled: 0x4})
+	l = h.Samples(time.Time{}, time.Time{}, 2*time.Minute)
+	if len(l) != 2 {
+		t.Fatal("Expected 2 downsampled samples, got", l)
+	}
+	if l[0].CPUTemp != 44.5 || !l[0].Created.Equal(t0.Add(5*time.Minute)) {
+		t.Error("Expected the average temperature and the time of the last sample, got", l[0].CPUTemp, l[0].Created)
+	}
+	if l[1].CPUTemp != 51 || l[1].Throttled != 0x50004 {
+		t.Error("Expected the throttled bits of both samples, got", l[1].CPUTemp, l[1].Throttled)
+	}
+
+	dir, err := ioutil.TempDir("", "statushistory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "status.json")
+	if err := h.WriteFile(fn); err != nil {
+		t.Fatal(err)
+	}
+	r := NewStatusHistory(2)
+	if err := r.ReadFile(fn); err != nil {
+		t.Fatal(err)
+	}
+	if l := r.All(); len(l) != 2 || l[0].CPUTemp != 50 || !l[1].Created.Equal(t0.Add(7*time.Minute)) {
+		t.Error("Expected the 2 most recent samples to be read back, got", l)
+	}
+}
+
+func TestDownsampleSkipsFailedCollectors(t *testing.T) {
+	t0 := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	l := DownsampleStatus([]DeviceStatus{
+		{Created: t0, CPUTemp: 40, GPUTemp: 50, AvailMem: 100, Throttled: 0x1},
+		{Created: t0.Add(time.Minute), CPUTemp: 42, Errors: []StatusError{{Collector: "gpu"}, {Collector: "memory"}, {Collector: "throttling"}}},
+		{Created: t0.Add(2 * time.Minute), CPUTemp: 44, GPUTemp: 52, Errors: []StatusError{{Collector: "memory"}}},
+	}, time.Hour)
+	if len(l) != 1 {
+		t.Fatal("Expected 1 downsampled sample, got", l)
+	}
+	s := l[0]
+	if s.CPUTemp != 42 || s.GPUTemp != 51 || s.AvailMem != 100 || s.Throttled != 0x1 {
+		t.Error("Expected only the samples that were read to be merged, got", s.CPUTemp, s.GPUTemp, s.AvailMem, s.Throttled)
+	}
+	if len(s.Errors) != 0 {
+		t.Error("Expected no errors, as every collector succeeded in a sample, got", s.Errors)
+	}
+
+	l = DownsampleStatus([]DeviceStatus{
+		{Created: t0, Errors: []StatusError{{Collector: "gpu", Message: "failed"}}},
+		{Created: t0.Add(time.Minute), Errors: []StatusError{{Collector: "gpu", Message: "failed"}}},
+	}, time.Hour)
+	if len(l) != 1 || !l[0].CollectorFailed("gpu") {
+		t.Error("Expected the error of a collector that failed in every sample, got", l)
+	}
+}
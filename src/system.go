@@ -0,0 +1,85 @@
+package gopifinder
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// CommandRunner runs the commands used to read the device status and information.
+type CommandRunner interface {
+	Output(name string, arg ...string) ([]byte, error) // Runs the command and returns its standard output
+	LookPath(name string) (string, error)              // Finds the named executable
+}
+
+// execRunner runs commands on the device.
+type execRunner struct{}
+
+func (execRunner) Output(name string, arg ...string) ([]byte, error) {
+	return exec.Command(name, arg...).Output()
+}
+
+func (execRunner) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+// System gives access to the files and commands the device status and information are
+// read from.  Reading them through a System lets the status of a fake device be read
+// from a directory holding copies of its /proc, /sys and /etc files.
+type System struct {
+	Root      string                   // The directory the absolute file paths are relative to, empty for the real root
+	Runner    CommandRunner            // Runs commands, nil runs them on the device
+	Addresses func() ([]string, error) // Returns the device's IP addresses, nil uses GetLocalIPAddresses
+}
+
+// LocalSystem is the System of the device the program is running on.
+var LocalSystem = &System{}
+
+// ReadFile reads the text of the file at the absolute path, relative to the Root.
+func (s *System) ReadFile(path string) (string, error) {
+	return ReadAllText(s.path(path))
+}
+
+// Exists returns whether or not the file at the absolute path, relative to the Root, exists.
+func (s *System) Exists(path string) bool {
+	_, err := os.Stat(s.path(path))
+	return err == nil
+}
+
+// Output runs the command and returns its standard output.
+func (s *System) Output(name string, arg ...string) ([]byte, error) {
+	return s.runner().Output(name, arg...)
+}
+
+// LookPath finds the named executable.
+func (s *System) LookPath(name string) (string, error) {
+	return s.runner().LookPath(name)
+}
+
+// IPAddresses returns the IPv4 addresses of the device.
+func (s *System) IPAddresses() ([]string, error) {
+	if s.Addresses != nil {
+		return s.Addresses()
+	}
+	return GetLocalIPAddresses()
+}
+
+func (s *System) path(path string) string {
+	if s.Root == "" {
+		return path
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(path))
+}
+
+func (s *System) runner() CommandRunner {
+	if s.Runner == nil {
+		return execRunner{}
+	}
+	return s.Runner
+}
+
+// isNotFound returns whether or not the error was returned because a command was not found.
+func isNotFound(err error) bool {
+	return errors.Is(err, exec.ErrNotFound)
+}
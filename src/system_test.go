@@ -0,0 +1,149 @@
+package gopifinder
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fixtureRunner returns the output of commands from the files in a fixture directory.
+// The output of "vcgencmd measure_temp" is read from the file vcgencmd_measure_temp.
+type fixtureRunner struct {
+	dir string
+}
+
+func (r fixtureRunner) Output(name string, arg ...string) ([]byte, error) {
+	fn := strings.Join(append([]string{filepath.Base(name)}, arg...), "_")
+	b, err := ioutil.ReadFile(filepath.Join(r.dir, fn))
+	if os.IsNotExist(err) {
+		return nil, &exec.Error{Name: name, Err: exec.ErrNotFound}
+	}
+	return b, err
+}
+
+func (r fixtureRunner) LookPath(name string) (string, error) {
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// newFixtureSystem returns the System of the named fixture in testdata/system.
+func newFixtureSystem(name string) *System {
+	dir := filepath.Join("testdata", "system", name)
+	return &System{
+		Root:      filepath.Join(dir, "root"),
+		Runner:    fixtureRunner{dir: filepath.Join(dir, "commands")},
+		Addresses: func() ([]string, error) { return []string{"192.168.1.20"}, nil },
+	}
+}
+
+func TestCanReadStatusFromFixtures(t *testing.T) {
+	for _, tc := range []struct {
+		fixture string
+		want    DeviceStatus
+		failed  []string
+	}{
+		{"pi3", DeviceStatus{HostName: "pi3", OS: "Linux", OSName: "Raspbian GNU/Linux 10 (buster)", OSVersion: "10.13", HWType: "Raspberry Pi 3B", HWSerialNo: "00000000a1b2c3d4",
+			HWModel: "Raspberry Pi 3 Model B", HWProcessor: "BCM2837", HWMemory: 1024, HWManufacturer: "Sony UK", HWRevision: "1.2", HWRevisionCode: "a02082", HWDeviceModel: "Raspberry Pi 3 Model B Rev 1.2",
+			CPUTemp: 48.312, GPUTemp: 48.3, DiskUsed: 9849212, DiskUsedPerc: 32, TotalMem: 945512, AvailMem: 702824, Uptime: 86400}, nil},
+		{"pi4", DeviceStatus{HostName: "pi4", OS: "Linux", OSName: "Raspbian GNU/Linux 11 (bullseye)", OSVersion: "11.9", HWType: "Raspberry Pi 4 4Gb", HWSerialNo: "10000000e5f6a7b8",
+			HWModel: "Raspberry Pi 4 Model B", HWProcessor: "BCM2711", HWMemory: 4096, HWManufacturer: "Sony UK", HWRevision: "1.1", HWRevisionCode: "c03111", HWDeviceModel: "Raspberry Pi 4 Model B Rev 1.1",
+			CPUTemp: 61.835, GPUTemp: 61.8, IsThrottled: true, Throttled: 0x50005,
+			ThrottleState: ThrottleState{UnderVoltage: true, Throttled: true, UnderVoltageOccurred: true, ThrottlingOccurred: true}, DiskUsed: 21697740, DiskUsedPerc: 26, TotalMem: 3884200, AvailMem: 3301516, Uptime: 3600}, nil},
+		{"pi5", DeviceStatus{HostName: "pi5", OS: "Linux", OSName: "Debian GNU/Linux 12 (bookworm)", OSVersion: "12.7", HWType: "Unknown Model", HWSerialNo: "a1b2c3d4e5f60718",
+			HWModel: "Raspberry Pi 5 Model B", HWProcessor: "BCM2712", HWMemory: 8192, HWManufacturer: "Sony UK", HWRevision: "1.0", HWRevisionCode: "d04170", HWDeviceModel: "Raspberry Pi 5 Model B Rev 1.0",
+			CPUTemp: 52.65, GPUTemp: 52.1, DiskUsed: 52749836, DiskUsedPerc: 11, TotalMem: 8245632, AvailMem: 7634500, Uptime: 172800}, nil},
+		{"debian-x86", DeviceStatus{HostName: "nas", OS: "Linux", OSName: "Debian GNU/Linux 12 (bookworm)", OSVersion: "12.12",
+			CPUTemp: 38, DiskUsed: 358580488, DiskUsedPerc: 22, TotalMem: 16302536, AvailMem: 13006872, Uptime: 7021}, []string{"gpu", "throttling"}},
+		{"alpine", DeviceStatus{HostName: "alpine", OS: "Linux", OSName: "Alpine Linux v3.20", OSVersion: "3.20.3",
+			DiskUsed: 6583596, DiskUsedPerc: 3, TotalMem: 1002416, AvailMem: 790112, Uptime: 542}, []string{"cpu", "gpu", "throttling"}},
+	} {
+		d, err := NewDeviceStatusFrom(newFixtureSystem(tc.fixture))
+		if err != nil {
+			t.Error(tc.fixture, err)
+			continue
+		}
+		failed := []string{}
+		for _, i := range d.Errors {
+			failed = append(failed, i.Collector)
+		}
+		if fmt.Sprint(failed) != fmt.Sprint(append([]string{}, tc.failed...)) {
+			t.Error(tc.fixture, "expected the failed collectors", tc.failed, "got", d.Errors)
+		}
+		d.Created, d.Errors = tc.want.Created, nil
+		if fmt.Sprintf("%+v", d) != fmt.Sprintf("%+v", tc.want) {
+			t.Errorf("%s: unexpected status\n got %+v\nwant %+v", tc.fixture, d, tc.want)
+		}
+	}
+}
+
+func TestCanReadDeviceInfoFromFixtures(t *testing.T) {
+	for _, name := range []string{"pi3", "pi4", "pi5", "debian-x86", "alpine"} {
+		sys := newFixtureSystem(name)
+		d, err := NewDeviceInfoFrom(sys)
+		if err != nil {
+			t.Error(name, err)
+			continue
+		}
+		id, _ := sys.ReadFile("/etc/machine-id")
+		if d.MachineID != fmt.Sprintf("%x", sha1.Sum([]byte(id))) {
+			t.Error(name, "expected the hash of the machine id, got", d.MachineID)
+		}
+		if d.OS != "Linux" || d.HostName == "" || len(d.IPAddress) != 1 {
+			t.Error(name, "unexpected device info", d)
+		}
+	}
+}
+
+func TestDeviceTreeModelMustMatchRevisionCode(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "proc", "device-tree"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "proc", "device-tree", "model"), []byte("Raspberry Pi 400 Rev 1.0\x00"), 0644)
+	sys := &System{Root: dir}
+
+	d := DeviceStatus{HWModel: "Raspberry Pi 4 Model B", HWRevisionCode: "c03111"}
+	if err := collectDeviceTreeModel(sys, &d); err == nil {
+		t.Error("Expected an error for a device tree model that does not match the revision code")
+	}
+
+	d = DeviceStatus{HWType: "Unknown Model"}
+	if err := collectDeviceTreeModel(sys, &d); err != nil {
+		t.Error(err)
+	} else if d.HWType != "Unknown Model" || d.HWDeviceModel != "Raspberry Pi 400 Rev 1.0" {
+		t.Error("Expected the device tree model without changing the hardware type, got", d.HWType, d.HWDeviceModel)
+	}
+}
+
+// throttledRunner returns the throttled bits from vcgencmd get_throttled.
+type throttledRunner string
+
+func (r throttledRunner) Output(name string, arg ...string) ([]byte, error) {
+	return []byte("throttled=" + string(r) + "\n"), nil
+}
+
+func (r throttledRunner) LookPath(name string) (string, error) {
+	return "/usr/bin/vcgencmd", nil
+}
+
+func TestIsThrottledOnlyReportsCurrentThrottling(t *testing.T) {
+	tests := []struct {
+		bits      string
+		throttled bool
+	}{
+		{"0x2", false}, // ARM frequency capped, which earlier versions reported as throttled
+		{"0x4", true},
+		{"0x40000", false}, // Throttling has occurred, but is not happening now
+	}
+	for _, tc := range tests {
+		d := DeviceStatus{}
+		if err := collectThrottling(&System{Runner: throttledRunner(tc.bits)}, &d); err != nil {
+			t.Fatal(err)
+		}
+		if d.IsThrottled != tc.throttled {
+			t.Errorf("Throttled bits %s: expected IsThrottled %v, got %v", tc.bits, tc.throttled, d.IsThrottled)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package gopifinder
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TargetGroup holds a group of scrape targets in the Prometheus http_sd_config format.
+type TargetGroup struct {
+	Targets []string          `json:"targets"` // The host:port addresses of the targets
+	Labels  map[string]string `json:"labels"`  // Labels added to each of the targets
+}
+
+// HasTag returns whether or not the service has been tagged with the specified tag.
+func (s *ServiceInfo) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// NewTargetGroups creates a Prometheus target group for each of the services.
+// If names are specified, only services with one of the names are included.  If tags
+// are specified, only services with all of the tags are included.
+// The service name, host name and machine ID are added as target labels.  All of the
+// service details are also added as __meta_finder_ labels, which can be used in
+// Prometheus relabelling rules and are dropped once relabelling is done.  Tags are joined into a single label with a comma
+// before and after each tag, so that a tag can be matched with a regex like .*,tag,.*
+func NewTargetGroups(sl []ServiceInfo, names []string, tags []string) []TargetGroup {
+	l := []TargetGroup{}
+	for _, s := range sl {
+		if s.Deleted || !matchesAny(s.ServiceName, names) || !s.hasAllTags(tags) {
+			continue
+		}
+		host := s.IPAddress
+		if host == "" {
+			host = s.HostName
+		}
+		if host == "" {
+			continue
+		}
+		target := host
+		if s.PortNo > 0 {
+			target = net.JoinHostPort(host, strconv.Itoa(s.PortNo))
+		} else if strings.Contains(host, ":") {
+			// An IPv6 address must be bracketed for Prometheus to add the default port
+			target = "[" + host + "]"
+		}
+
+		labels := map[string]string{
+			"service":                    s.ServiceName,
+			"hostname":                   s.HostName,
+			"machine_id":                 s.MachineID,
+			"__meta_finder_service_name": s.ServiceName,
+			"__meta_finder_host_name":    s.HostName,
+			"__meta_finder_machine_id":   s.MachineID,
+			"__meta_finder_api_stub":     s.APIStub,
+		}
+		if len(s.Tags) != 0 {
+			labels["__meta_finder_tags"] = "," + strings.Join(s.Tags, ",") + ","
+		}
+		for k, v := range s.Metadata {
+			labels["__meta_finder_metadata_"+labelName(k)] = v
+		}
+		l = append(l, TargetGroup{Targets: []string{target}, Labels: labels})
+	}
+	sort.Slice(l, func(i, j int) bool {
+		a, b := l[i].Labels, l[j].Labels
+		if a["__meta_finder_service_name"] != b["__meta_finder_service_name"] {
+			return a["__meta_finder_service_name"] < b["__meta_finder_service_name"]
+		}
+		return a["__meta_finder_machine_id"] < b["__meta_finder_machine_id"]
+	})
+	return l
+}
+
+// hasAllTags returns whether or not the service has been tagged with all of the tags.
+func (s *ServiceInfo) hasAllTags(tags []string) bool {
+	for _, t := range tags {
+		if !s.HasTag(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAny returns whether or not the value is in the list.  An empty list matches any value.
+func matchesAny(v string, l []string) bool {
+	if len(l) == 0 {
+		return true
+	}
+	for _, i := range l {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
+
+// labelName replaces the characters that are not allowed in a Prometheus label name.
+func labelName(s string) string {
+	b := []byte(s)
+	for n, c := range b {
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			b[n] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,52 @@
+package gopifinder
+
+import "testing"
+
+func TestNewTargetGroupsFiltersByNameAndTag(t *testing.T) {
+	sl := []ServiceInfo{
+		{ServiceName: "web", MachineID: "m1", HostName: "pi1", IPAddress: "10.0.0.1", PortNo: 8080, Tags: []string{"prod", "http"},
+			Metadata: map[string]string{"metrics-path": "/stats"}},
+		{ServiceName: "web", MachineID: "m2", HostName: "pi2", IPAddress: "10.0.0.2", PortNo: 8080, Tags: []string{"test"}},
+		{ServiceName: "mqtt", MachineID: "m1", HostName: "pi1", IPAddress: "10.0.0.1", PortNo: 1883},
+		{ServiceName: "web", MachineID: "m3", HostName: "pi3", IPAddress: "10.0.0.3", PortNo: 8080, Deleted: true},
+	}
+
+	if l := NewTargetGroups(sl, nil, nil); len(l) != 3 {
+		t.Error("Expected 3 target groups, got", len(l))
+	}
+	if l := NewTargetGroups(sl, []string{"web"}, nil); len(l) != 2 {
+		t.Error("Expected 2 web target groups, got", len(l))
+	}
+
+	l := NewTargetGroups(sl, []string{"web"}, []string{"prod"})
+	if len(l) != 1 {
+		t.Fatal("Expected 1 target group, got", len(l))
+	}
+	g := l[0]
+	if len(g.Targets) != 1 || g.Targets[0] != "10.0.0.1:8080" {
+		t.Error("Unexpected targets", g.Targets)
+	}
+	if g.Labels["__meta_finder_machine_id"] != "m1" || g.Labels["__meta_finder_host_name"] != "pi1" {
+		t.Error("Unexpected labels", g.Labels)
+	}
+	if g.Labels["service"] != "web" || g.Labels["hostname"] != "pi1" || g.Labels["machine_id"] != "m1" {
+		t.Error("Expected the service, host name and machine ID target labels, got", g.Labels)
+	}
+	if g.Labels["__meta_finder_tags"] != ",prod,http," {
+		t.Error("Unexpected tags label", g.Labels["__meta_finder_tags"])
+	}
+	if g.Labels["__meta_finder_metadata_metrics_path"] != "/stats" {
+		t.Error("Expected the metadata label, got", g.Labels)
+	}
+}
+
+func TestNewTargetGroupsBracketsIPv6Addresses(t *testing.T) {
+	sl := []ServiceInfo{
+		{ServiceName: "web", MachineID: "m1", IPAddress: "fe80::1", PortNo: 8080},
+		{ServiceName: "web", MachineID: "m2", IPAddress: "fe80::2"},
+	}
+	l := NewTargetGroups(sl, nil, nil)
+	if len(l) != 2 || l[0].Targets[0] != "[fe80::1]:8080" || l[1].Targets[0] != "[fe80::2]" {
+		t.Error("Unexpected targets", l)
+	}
+}
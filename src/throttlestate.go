@@ -0,0 +1,54 @@
+package gopifinder
+
+// ThrottleState holds the flags reported by vcgencmd get_throttled.  The flags without
+// the Occurred suffix hold the current state, while the Occurred flags are set if the
+// condition has happened at any time since the device booted.
+type ThrottleState struct {
+	UnderVoltage                 bool `json:"underVoltage"`                 // Under-voltage detected
+	ArmFrequencyCapped           bool `json:"armFrequencyCapped"`           // ARM frequency capped
+	Throttled                    bool `json:"throttled"`                    // Currently throttled
+	SoftTemperatureLimit         bool `json:"softTemperatureLimit"`         // Soft temperature limit active
+	UnderVoltageOccurred         bool `json:"underVoltageOccurred"`         // Under-voltage has occurred
+	ArmFrequencyCappingOccurred  bool `json:"armFrequencyCappingOccurred"`  // ARM frequency capping has occurred
+	ThrottlingOccurred           bool `json:"throttlingOccurred"`           // Throttling has occurred
+	SoftTemperatureLimitOccurred bool `json:"softTemperatureLimitOccurred"` // Soft temperature limit has occurred
+}
+
+// ThrottleFlag names one of the bits reported by vcgencmd get_throttled.
+type ThrottleFlag struct {
+	Bit  uint   // The bit number
+	Name string // The name of the flag, such as under_voltage
+}
+
+// ThrottleFlags lists the bits reported by vcgencmd get_throttled, current state first.
+var ThrottleFlags = []ThrottleFlag{
+	{0, "under_voltage"},
+	{1, "arm_frequency_capped"},
+	{2, "throttled"},
+	{3, "soft_temperature_limit"},
+	{16, "under_voltage_occurred"},
+	{17, "arm_frequency_capping_occurred"},
+	{18, "throttling_occurred"},
+	{19, "soft_temperature_limit_occurred"},
+}
+
+// DecodeThrottled decodes the value reported by vcgencmd get_throttled.
+func DecodeThrottled(u uint64) ThrottleState {
+	bit := func(n uint) bool { return u&(1<<n) != 0 }
+	return ThrottleState{
+		UnderVoltage:                 bit(0),
+		ArmFrequencyCapped:           bit(1),
+		Throttled:                    bit(2),
+		SoftTemperatureLimit:         bit(3),
+		UnderVoltageOccurred:         bit(16),
+		ArmFrequencyCappingOccurred:  bit(17),
+		ThrottlingOccurred:           bit(18),
+		SoftTemperatureLimitOccurred: bit(19),
+	}
+}
+
+// EverUnderVoltage returns whether or not the device is under-voltage now or has been
+// since it booted, which usually points to a poor power supply or cable.
+func (t ThrottleState) EverUnderVoltage() bool {
+	return t.UnderVoltage || t.UnderVoltageOccurred
+}
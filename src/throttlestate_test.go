@@ -0,0 +1,23 @@
+package gopifinder
+
+import "testing"
+
+func TestCanDecodeThrottled(t *testing.T) {
+	s := DecodeThrottled(0x50005)
+	want := ThrottleState{UnderVoltage: true, Throttled: true, UnderVoltageOccurred: true, ThrottlingOccurred: true}
+	if s != want {
+		t.Errorf("got %+v, want %+v", s, want)
+	}
+	if !s.EverUnderVoltage() {
+		t.Error("Expected the device to have been under-voltage")
+	}
+
+	for _, i := range ThrottleFlags {
+		if DecodeThrottled(1<<i.Bit) == (ThrottleState{}) {
+			t.Error("Flag was not decoded", i.Name)
+		}
+	}
+	if DecodeThrottled(0xa000a).EverUnderVoltage() {
+		t.Error("Expected the device to never have been under-voltage")
+	}
+}